@@ -1,7 +1,6 @@
 package build
 
 import (
-	"context"
 	"fmt"
 
 	"github.com/arnarg/lila/internal/nix"
@@ -43,16 +42,13 @@ func run(ctx *cli.Context) error {
 	}
 
 	// Get current system
-	system, err := nix.CurrentSystem()
+	system, err := nix.CurrentSystem(ctx.Context)
 	if err != nil {
 		return err
 	}
 
 	// Build args for nix build
-	nargs := []string{
-		"-f", "nilla.nix",
-		fmt.Sprintf("packages.%s.result.%s", name, system),
-	}
+	nargs := []string{}
 
 	if ctx.Bool("no-link") {
 		nargs = append(nargs, "--no-link")
@@ -62,10 +58,13 @@ func run(ctx *cli.Context) error {
 	}
 
 	// Run nix build
-	out, err := nix.Command("build").
-		Args(nargs).
-		Reporter(tui.NewBuildReporter(ctx.Bool("verbose"))).
-		Run(context.Background())
+	out, err := tui.BuildAttrs(
+		ctx.Context,
+		[]string{fmt.Sprintf("packages.%s.result.%s", name, system)},
+		nargs,
+		tui.NewBuildReporter(ctx.Bool("verbose")).
+			SummaryFile(ctx.String("summary-file")),
+	)
 	if err != nil {
 		return err
 	}
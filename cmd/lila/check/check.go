@@ -0,0 +1,260 @@
+package check
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/arnarg/lila/internal/nix"
+	"github.com/arnarg/lila/internal/runner"
+	"github.com/arnarg/lila/internal/store"
+	"github.com/arnarg/lila/internal/tui"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/urfave/cli/v2"
+)
+
+var Command = &cli.Command{
+	Name:        "check",
+	Usage:       "Build checks",
+	Description: "Builds checks defined in a nilla project for the current system",
+	Args:        true,
+	ArgsUsage:   "[check name...]",
+	Flags: []cli.Flag{
+		&cli.IntFlag{
+			Name:  "log-lines",
+			Usage: "Show the last `N` lines of the logs of failed builds",
+			Value: 10,
+		},
+	},
+	Action: run,
+}
+
+// checksExpr maps every check available for a system to its
+// derivation and output paths.
+const checksExpr = `checks: builtins.listToAttrs (builtins.concatMap (name:
+  let result = checks.${name}.result; in
+  if result ? %[1]q then [{
+    inherit name;
+    value = { drvPath = result.%[1]q.drvPath; outPath = result.%[1]q.outPath; };
+  }] else []
+) (builtins.attrNames checks))`
+
+func printSection(text string) {
+	fmt.Fprintf(os.Stderr, "\033[32m>\033[0m %s\n", text)
+}
+
+type check struct {
+	Name    string `json:"-"`
+	DrvPath string `json:"drvPath"`
+	OutPath string `json:"outPath"`
+}
+
+// listChecks returns the checks of the project available for
+// the system, sorted by name.
+func listChecks(ctx *cli.Context, system string) ([]check, error) {
+	out, err := runner.Output(ctx.Context, runner.Cmd{
+		Name: "nix",
+		Args: []string{
+			"eval", "-f", "nilla.nix", "checks",
+			"--apply", fmt.Sprintf(checksExpr, system), "--json",
+		},
+		Stderr: os.Stderr,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	checks := map[string]check{}
+	if err := json.Unmarshal(out, &checks); err != nil {
+		return nil, err
+	}
+
+	res := []check{}
+	for name, c := range checks {
+		c.Name = name
+		res = append(res, c)
+	}
+
+	slices.SortFunc(res, func(a, b check) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return res, nil
+}
+
+// selectChecks returns the checks with the names, or all of them
+// if no names are given.
+func selectChecks(checks []check, names []string) ([]check, error) {
+	if len(names) < 1 {
+		return checks, nil
+	}
+
+	selected := []check{}
+	for _, name := range names {
+		i := slices.IndexFunc(checks, func(c check) bool {
+			return c.Name == name
+		})
+		if i < 0 {
+			return nil, fmt.Errorf("check %q not found", name)
+		}
+		selected = append(selected, checks[i])
+	}
+
+	return selected, nil
+}
+
+// logTail returns the last lines of the build log of a derivation.
+func logTail(ctx *cli.Context, drv string, lines int) string {
+	out, err := runner.Output(ctx.Context, runner.Cmd{
+		Name: "nix",
+		Args: []string{"log", drv},
+	})
+	if err != nil {
+		return "no build log available"
+	}
+
+	l := strings.Split(strings.TrimRight(string(out), "\n"), "\n")
+	if len(l) > lines {
+		l = l[len(l)-lines:]
+	}
+
+	return strings.Join(l, "\n")
+}
+
+func run(ctx *cli.Context) error {
+	// Get current system
+	system, err := nix.CurrentSystem(ctx.Context)
+	if err != nil {
+		return err
+	}
+
+	// Listing the checks evaluates their derivations, so that
+	// evaluation is timed apart from building them
+	start := time.Now()
+	all, err := listChecks(ctx, system)
+	if err != nil {
+		return err
+	}
+	checks, err := selectChecks(all, ctx.Args().Slice())
+	if err != nil {
+		return err
+	}
+	if len(checks) < 1 {
+		return fmt.Errorf("no checks found for %s", system)
+	}
+
+	//
+	// Build all checks together
+	//
+	nargs := []string{}
+	for _, c := range checks {
+		nargs = append(nargs, c.DrvPath+"^*")
+	}
+	nargs = append(nargs, "--no-link", "--keep-going")
+
+	printSection(fmt.Sprintf("Building %d checks", len(checks)))
+
+	reporter := tui.NewBuildReporter(ctx.Bool("verbose")).
+		SummaryFile(ctx.String("summary-file")).
+		KeepGoing(true).
+		EvaluatedSince(start)
+
+	_, berr := nix.Command("build").
+		Args(nargs).
+		Reporter(reporter).
+		Run(ctx.Context)
+
+	//
+	// Find out which checks were built
+	//
+	s, err := store.Open(ctx.Context)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	outs := []string{}
+	for _, c := range checks {
+		outs = append(outs, c.OutPath)
+	}
+	valid, err := s.QueryValidPaths(ctx.Context, outs)
+	if err != nil {
+		return err
+	}
+
+	// Nothing was built and no derivation failed, so
+	// nix failed before building anything
+	if berr != nil && len(valid) < 1 {
+		errs := reporter.Errors()
+		if len(errs) > 0 && !slices.ContainsFunc(errs, func(e string) bool {
+			return strings.Contains(e, ".drv")
+		}) {
+			return fmt.Errorf("%w: %s", berr, strings.Join(errs, "\n"))
+		}
+	}
+
+	fmt.Fprintln(os.Stderr)
+	printSection("Results")
+
+	width := 0
+	for _, c := range checks {
+		width = max(width, len(c.Name))
+	}
+
+	name := lipgloss.NewStyle().Width(width + 2)
+	passed := lipgloss.NewStyle().Foreground(lipgloss.Color("10")).Render("✓ passed")
+	failed := lipgloss.NewStyle().Foreground(lipgloss.Color("9")).Render("✗ failed")
+	faint := lipgloss.NewStyle().Faint(true)
+
+	// Checks may fail because their dependencies failed to build,
+	// so the logs of every failed derivation are shown
+	failedDrvs := reporter.FailedBuilds()
+	printLog := func(drv string) {
+		for _, l := range strings.Split(logTail(ctx, drv, ctx.Int("log-lines")), "\n") {
+			fmt.Println(faint.Render("  " + l))
+		}
+	}
+
+	failures := []string{}
+	for _, c := range checks {
+		if slices.Contains(valid, c.OutPath) {
+			fmt.Printf("%s%s\n", name.Render(c.Name), passed)
+			continue
+		}
+
+		failures = append(failures, c.Name)
+		fmt.Printf("%s%s\n", name.Render(c.Name), failed)
+
+		// Fall back to the check's own log if nix didn't say
+		// what failed
+		if len(failedDrvs) < 1 || slices.Contains(failedDrvs, c.DrvPath) {
+			printLog(c.DrvPath)
+		}
+	}
+
+	for _, drv := range failedDrvs {
+		if slices.ContainsFunc(checks, func(c check) bool { return c.DrvPath == drv }) {
+			continue
+		}
+
+		fmt.Printf("%s dependency %s\n", failed, strings.TrimSuffix(nix.StoreName(drv), ".drv"))
+		printLog(drv)
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("%d of %d checks failed: %s", len(failures), len(checks), strings.Join(failures, ", "))
+	}
+
+	// All checks were built but nix still failed
+	if berr != nil {
+		if errs := reporter.Errors(); len(errs) > 0 {
+			return fmt.Errorf("%w: %s", berr, strings.Join(errs, "\n"))
+		}
+		return berr
+	}
+
+	return nil
+}
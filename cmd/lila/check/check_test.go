@@ -0,0 +1,141 @@
+package check
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/arnarg/lila/internal/runner"
+	"github.com/arnarg/lila/internal/runner/runnertest"
+	"github.com/arnarg/lila/internal/store"
+)
+
+func runApp(t *testing.T, fake *runner.Fake, s store.Store, args ...string) error {
+	t.Helper()
+	return runnertest.Run(t, store.WithStore(context.Background(), s), fake, Command, args...)
+}
+
+const testChecks = `{
+  "fmt": {
+    "drvPath": "/nix/store/aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa-check-fmt.drv",
+    "outPath": "/nix/store/bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb-check-fmt"
+  },
+  "unit": {
+    "drvPath": "/nix/store/cccccccccccccccccccccccccccccccc-check-unit.drv",
+    "outPath": "/nix/store/dddddddddddddddddddddddddddddddd-check-unit"
+  }
+}`
+
+const testFailedBuildLog = `@nix {"action":"start","id":1,"level":0,"parent":0,"text":"","type":104}
+@nix {"action":"msg","level":0,"msg":"error: builder for '/nix/store/cccccccccccccccccccccccccccccccc-check-unit.drv' failed with exit code 1"}
+@nix {"action":"stop","id":1}
+`
+
+func TestCheck(t *testing.T) {
+	fake := runner.NewFake(
+		runner.Response{
+			Name:   "nix",
+			Args:   []string{"eval", "--expr", "builtins.currentSystem"},
+			Stdout: "x86_64-linux",
+		},
+		runner.Response{
+			Name:   "nix",
+			Args:   []string{"eval", "-f", "nilla.nix", "checks"},
+			Stdout: testChecks,
+		},
+		runner.Response{
+			Name: "nix",
+			Args: []string{
+				"build", "--print-out-paths",
+				"/nix/store/aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa-check-fmt.drv^*",
+				"/nix/store/cccccccccccccccccccccccccccccccc-check-unit.drv^*",
+				"--no-link", "--keep-going",
+			},
+			Stderr:   testFailedBuildLog,
+			ExitCode: 1,
+		},
+		runner.Response{
+			Name:   "nix",
+			Args:   []string{"log", "/nix/store/cccccccccccccccccccccccccccccccc-check-unit.drv"},
+			Stdout: "running tests\nFAIL: TestSomething\n",
+		},
+	)
+
+	s := store.NewFake(&store.PathInfo{Path: "/nix/store/bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb-check-fmt"})
+
+	err := runApp(t, fake, s)
+	if err == nil {
+		t.Fatal("expected an error for a failed check")
+	}
+	if !strings.Contains(err.Error(), "1 of 2 checks failed: unit") {
+		t.Errorf("error is '%s' but the failed check was expected", err)
+	}
+
+	runnertest.AssertAllUsed(t, fake)
+}
+
+const testFailedDependencyLog = `@nix {"action":"start","id":1,"level":0,"parent":0,"text":"","type":104}
+@nix {"action":"msg","level":0,"msg":"error: builder for '/nix/store/eeeeeeeeeeeeeeeeeeeeeeeeeeeeeeee-test-data.drv' failed with exit code 1"}
+@nix {"action":"msg","level":0,"msg":"error: 1 dependencies of derivation '/nix/store/cccccccccccccccccccccccccccccccc-check-unit.drv' failed to build"}
+@nix {"action":"stop","id":1}
+`
+
+func TestCheckFailedDependency(t *testing.T) {
+	fake := runner.NewFake(
+		runner.Response{
+			Name:   "nix",
+			Args:   []string{"eval", "--expr", "builtins.currentSystem"},
+			Stdout: "x86_64-linux",
+		},
+		runner.Response{
+			Name:   "nix",
+			Args:   []string{"eval", "-f", "nilla.nix", "checks"},
+			Stdout: testChecks,
+		},
+		runner.Response{
+			Name:     "nix",
+			Args:     []string{"build"},
+			Stderr:   testFailedDependencyLog,
+			ExitCode: 1,
+		},
+		runner.Response{
+			Name:   "nix",
+			Args:   []string{"log", "/nix/store/eeeeeeeeeeeeeeeeeeeeeeeeeeeeeeee-test-data.drv"},
+			Stdout: "generating test data\nout of disk space\n",
+		},
+	)
+
+	s := store.NewFake(&store.PathInfo{Path: "/nix/store/bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb-check-fmt"})
+
+	if err := runApp(t, fake, s); err == nil {
+		t.Fatal("expected an error for a failed check")
+	}
+
+	runnertest.AssertAllUsed(t, fake)
+
+	// Only the log of the dependency that failed is shown
+	if calls := fake.Calls(); len(calls) != 4 {
+		t.Errorf("expected only 4 commands to run but %d were run", len(calls))
+	}
+}
+
+func TestCheckNotFound(t *testing.T) {
+	fake := runner.NewFake(
+		runner.Response{
+			Name:   "nix",
+			Args:   []string{"eval", "--expr", "builtins.currentSystem"},
+			Stdout: "x86_64-linux",
+		},
+		runner.Response{
+			Name:   "nix",
+			Args:   []string{"eval", "-f", "nilla.nix", "checks"},
+			Stdout: testChecks,
+		},
+	)
+
+	if err := runApp(t, fake, store.NewFake(), "lint"); err == nil {
+		t.Fatal("expected an error for a missing check")
+	}
+
+	runnertest.AssertAllUsed(t, fake)
+}
@@ -0,0 +1,103 @@
+package eval
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/arnarg/lila/internal/nix"
+	"github.com/arnarg/lila/internal/runner"
+	"github.com/arnarg/lila/internal/tui"
+	"github.com/urfave/cli/v2"
+)
+
+var (
+	errNoAttrPath     = errors.New("no attribute path given")
+	errJSONAndRawUsed = errors.New("--json and --raw can't be used together")
+	errNegativeTop    = errors.New("--top can't be negative")
+)
+
+var Command = &cli.Command{
+	Name:        "eval",
+	Usage:       "Evaluate an attribute",
+	Description: "Evaluates an attribute of a nilla project and prints the result",
+	Args:        true,
+	ArgsUsage:   "<attr-path>",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "json",
+			Usage: "Print the result as JSON",
+		},
+		&cli.BoolFlag{
+			Name:  "raw",
+			Usage: "Print the result, which must be a string, without quotes",
+		},
+		&cli.StringFlag{
+			Name:  "apply",
+			Usage: "Apply the function `EXPR` to the result before printing it",
+		},
+		&cli.BoolFlag{
+			Name:  "profile",
+			Usage: "Show evaluation statistics and the hottest files, functions and attributes",
+		},
+		&cli.IntFlag{
+			Name:  "top",
+			Usage: "Show the `N` hottest entries of the profile",
+			Value: 10,
+		},
+	},
+	Action: run,
+}
+
+func run(ctx *cli.Context) error {
+	attr := ctx.Args().First()
+	if attr == "" {
+		return errNoAttrPath
+	}
+
+	if ctx.Bool("json") && ctx.Bool("raw") {
+		return errJSONAndRawUsed
+	}
+
+	if ctx.Int("top") < 0 {
+		return errNegativeTop
+	}
+
+	nargs := []string{"-f", "nilla.nix", attr}
+	if expr := ctx.String("apply"); expr != "" {
+		nargs = append(nargs, "--apply", expr)
+	}
+	if ctx.Bool("json") {
+		nargs = append(nargs, "--json")
+	}
+	if ctx.Bool("raw") {
+		nargs = append(nargs, "--raw")
+	}
+
+	if ctx.Bool("profile") {
+		return profile(ctx, nargs)
+	}
+
+	// Warnings can only be told apart from the rest of what nix
+	// prints with its internal-json log
+	if tui.WarningsAsErrors(ctx.Context) {
+		out, err := nix.Command("eval").
+			Args(nargs).
+			PrintOutPaths(false).
+			Reporter(tui.NewEvalReporter(ctx.Bool("verbose"))).
+			Run(ctx.Context)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(string(out))
+		return nil
+	}
+
+	return runner.Run(ctx.Context, runner.Cmd{
+		Name:   "nix",
+		Args:   append([]string{"eval"}, nargs...),
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+	})
+}
@@ -0,0 +1,119 @@
+package eval
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/arnarg/lila/internal/runner"
+	"github.com/arnarg/lila/internal/runner/runnertest"
+	"github.com/arnarg/lila/internal/tui"
+)
+
+func runApp(t *testing.T, fake *runner.Fake, args ...string) error {
+	t.Helper()
+	return runnertest.Run(t, context.Background(), fake, Command, args...)
+}
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		name         string
+		args         []string
+		expectedArgs []string
+		expectError  bool
+	}{
+		{
+			name:         "attribute",
+			args:         []string{"systems.nixos.laptop.result.config.networking.hostName"},
+			expectedArgs: []string{"eval", "-f", "nilla.nix", "systems.nixos.laptop.result.config.networking.hostName"},
+		},
+		{
+			name:         "json with apply",
+			args:         []string{"--json", "--apply", "builtins.attrNames", "systems.nixos"},
+			expectedArgs: []string{"eval", "-f", "nilla.nix", "systems.nixos", "--apply", "builtins.attrNames", "--json"},
+		},
+		{
+			name:         "raw",
+			args:         []string{"--raw", "systems.nixos.laptop.result.config.system.stateVersion"},
+			expectedArgs: []string{"eval", "-f", "nilla.nix", "systems.nixos.laptop.result.config.system.stateVersion", "--raw"},
+		},
+		{
+			name:        "json and raw",
+			args:        []string{"--json", "--raw", "systems.nixos"},
+			expectError: true,
+		},
+		{
+			name:        "no attribute",
+			expectError: true,
+		},
+		{
+			name:        "negative top",
+			args:        []string{"--profile", "--top=-1", "systems.nixos"},
+			expectError: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := runner.NewFake(runner.Response{Name: "nix"})
+
+			err := runApp(t, fake, test.args...)
+			if test.expectError {
+				if err == nil {
+					t.Fatal("expected an error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			calls := fake.Calls()
+			if len(calls) != 1 {
+				t.Fatalf("%d commands were run but 1 was expected", len(calls))
+			}
+			if runner.FormatCmd(calls[0]) != runner.FormatCmd(runner.Cmd{Name: "nix", Args: test.expectedArgs}) {
+				t.Errorf("command is '%s' but '%s' was expected", runner.FormatCmd(calls[0]), runner.FormatCmd(runner.Cmd{Name: "nix", Args: test.expectedArgs}))
+			}
+		})
+	}
+}
+
+func TestEvalProfileWithoutStats(t *testing.T) {
+	fake := runner.NewFake(runner.Response{
+		Name:   "nix",
+		Args:   []string{"eval", "-f", "nilla.nix", "systems.nixos.laptop.result.config.system.build.toplevel.drvPath"},
+		Stdout: "/nix/store/aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa-nixos-system-laptop.drv",
+	})
+
+	err := runApp(t, fake, "--profile", "systems.nixos.laptop.result.config.system.build.toplevel.drvPath")
+	if !errors.Is(err, errNoEvalStats) {
+		t.Fatalf("error is '%v' but '%s' was expected", err, errNoEvalStats)
+	}
+
+	calls := fake.Calls()
+	if len(calls) != 1 {
+		t.Fatalf("%d commands were run but 1 was expected", len(calls))
+	}
+	if !slices.Contains(calls[0].Env, "NIX_COUNT_CALLS=1") {
+		t.Errorf("environment is '%v' but call counting was expected", calls[0].Env)
+	}
+}
+
+func TestEvalWarningsAsErrors(t *testing.T) {
+	fake := runner.NewFake(runner.Response{
+		Name:   "nix",
+		Args:   []string{"eval", "-f", "nilla.nix", "systems.nixos.laptop.result.config.networking.hostName", "--log-format", "internal-json"},
+		Stdout: "\"laptop\"\n",
+		Stderr: `@nix {"action":"msg","level":1,"msg":"evaluation warning: The option ` + "`services.foo.bar'" + ` is unused"}` + "\n",
+	})
+
+	ctx := tui.WithWarningsAsErrors(context.Background(), true)
+	err := runnertest.Run(t, ctx, fake, Command, "systems.nixos.laptop.result.config.networking.hostName")
+	if !errors.Is(err, tui.ErrWarnings) {
+		t.Fatalf("error is '%v' but '%s' was expected", err, tui.ErrWarnings)
+	}
+
+	runnertest.AssertAllUsed(t, fake)
+}
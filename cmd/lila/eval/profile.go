@@ -0,0 +1,129 @@
+package eval
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/arnarg/lila/internal/nix"
+	"github.com/arnarg/lila/internal/tui"
+	"github.com/arnarg/lila/internal/util"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/urfave/cli/v2"
+)
+
+var errNoEvalStats = errors.New("nix did not write evaluation statistics")
+
+func printSection(text string) {
+	fmt.Fprintf(os.Stderr, "\033[32m>\033[0m %s\n", text)
+}
+
+// shortenPath makes a file path in the profile easier to read by
+// removing the store path hash or the current directory.
+func shortenPath(path string) string {
+	if rest, ok := strings.CutPrefix(path, "/nix/store/"); ok && len(rest) > 33 {
+		return rest[33:]
+	}
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, path); err == nil && !strings.HasPrefix(rel, "..") {
+			return rel
+		}
+	}
+	return path
+}
+
+func fmtPosition(p nix.PositionCount) string {
+	return fmt.Sprintf("%s:%d:%d", shortenPath(p.File), p.Line, p.Column)
+}
+
+// printProfile prints a summary of the evaluation statistics with
+// the n hottest files, functions and attribute selections.
+func printProfile(stats *nix.EvalStats, n int) {
+	bold := lipgloss.NewStyle().Bold(true)
+	count := lipgloss.NewStyle().Foreground(lipgloss.Color("12"))
+	faint := lipgloss.NewStyle().Faint(true)
+
+	allocated, unit := util.ConvertBytes(stats.GC.TotalBytes)
+	cpu := time.Duration(stats.CPUTime * float64(time.Second)).Round(time.Millisecond)
+
+	fmt.Fprintf(
+		os.Stderr,
+		"CPU time %s, %d function calls, %d thunks, %.2f %s allocated\n",
+		cpu, stats.NrFunctionCalls, stats.NrThunks, allocated, unit,
+	)
+
+	if files := stats.HottestFiles(n); len(files) > 0 {
+		fmt.Fprintln(os.Stderr, bold.Render("Hottest files:"))
+		for _, f := range files {
+			fmt.Fprintf(os.Stderr, "  %s %s\n", count.Render(fmt.Sprintf("%10d", f.Count)), shortenPath(f.File))
+		}
+	}
+
+	if functions := stats.HottestFunctions(n); len(functions) > 0 {
+		fmt.Fprintln(os.Stderr, bold.Render("Hottest functions:"))
+		for _, f := range functions {
+			name := f.Name
+			if name == "" {
+				name = "«lambda»"
+			}
+			fmt.Fprintf(
+				os.Stderr, "  %s %s %s\n",
+				count.Render(fmt.Sprintf("%10d", f.Count)), name, faint.Render(fmtPosition(f)),
+			)
+		}
+	}
+
+	if attrs := stats.HottestAttributes(n); len(attrs) > 0 {
+		fmt.Fprintln(os.Stderr, bold.Render("Hottest attribute selections:"))
+		for _, a := range attrs {
+			fmt.Fprintf(os.Stderr, "  %s %s\n", count.Render(fmt.Sprintf("%10d", a.Count)), fmtPosition(a))
+		}
+	}
+}
+
+// profile evaluates with statistics and call counting enabled and
+// prints the result followed by a summary of the statistics.
+func profile(ctx *cli.Context, nargs []string) error {
+	f, err := os.CreateTemp("", "lila-eval-stats-*.json")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	out, err := nix.Command("eval").
+		Args(nargs).
+		Env(nix.EvalStatsEnv(f.Name())).
+		PrintOutPaths(false).
+		Reporter(
+			tui.NewEvalReporter(ctx.Bool("verbose")),
+		).
+		Run(ctx.Context)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(string(out))
+
+	data, err := os.ReadFile(f.Name())
+	if err != nil {
+		return err
+	}
+	if len(data) < 1 {
+		return errNoEvalStats
+	}
+
+	stats, err := nix.ParseEvalStats(data)
+	if err != nil {
+		return fmt.Errorf("could not parse evaluation statistics: %w", err)
+	}
+
+	fmt.Fprintln(os.Stderr)
+	printSection("Evaluation profile")
+	printProfile(stats, ctx.Int("top"))
+
+	return nil
+}
@@ -7,9 +7,15 @@ import (
 	"fmt"
 	"io/fs"
 	"os"
-	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 
+	"github.com/arnarg/lila/internal/flags"
 	"github.com/arnarg/lila/internal/nix"
+	"github.com/arnarg/lila/internal/runner"
+	"github.com/arnarg/lila/internal/store"
 	"github.com/arnarg/lila/internal/tui"
 	"github.com/urfave/cli/v2"
 )
@@ -24,7 +30,9 @@ const (
 var (
 	errNoUserFound               = errors.New("no user found")
 	errHomeConfigurationNotFound = errors.New("home configuration not found")
-	errHomeCurrentGenNotFound    = errors.New("current generation not found")
+	errHomeProfileNotFound       = errors.New("home manager profile not found")
+	errNoPreviousGeneration      = errors.New("no previous generation to roll back to")
+	errNoSpecialisations         = errors.New("configuration has no specialisations")
 )
 
 var Command = &cli.Command{
@@ -53,6 +61,11 @@ var Command = &cli.Command{
 					Aliases: []string{"o"},
 					Usage:   "Use path as prefix for the symlinks to the build results",
 				},
+				&cli.StringFlag{
+					Name:    "specialisation",
+					Aliases: []string{"s"},
+					Usage:   "Use the specialisation `NAME` of the configuration",
+				},
 			},
 			Action: func(ctx *cli.Context) error {
 				return run(ctx, subCmdBuild)
@@ -66,10 +79,46 @@ var Command = &cli.Command{
 			Description: "Build Home Manager configuration and activate it",
 			Args:        true,
 			ArgsUsage:   "[system name]",
+			Flags: append(
+				flags.Activation(),
+				&cli.StringFlag{
+					Name:    "specialisation",
+					Aliases: []string{"s"},
+					Usage:   "Use the specialisation `NAME` of the configuration",
+				},
+			),
 			Action: func(ctx *cli.Context) error {
 				return run(ctx, subCmdSwitch)
 			},
 		},
+
+		// Specialisations
+		{
+			Name:        "specialisations",
+			Usage:       "List specialisations of a Home Manager configuration",
+			Description: "List specialisations of a Home Manager configuration",
+			Args:        true,
+			ArgsUsage:   "[configuration name]",
+			Action:      specialisations,
+		},
+
+		// Generations
+		{
+			Name:        "generations",
+			Usage:       "List Home Manager generations",
+			Description: "List Home Manager generations",
+			Action:      generations,
+		},
+
+		// Rollback
+		{
+			Name:        "rollback",
+			Usage:       "Activate a previous Home Manager generation",
+			Description: "Activate the generation before the current one, or the one given",
+			Args:        true,
+			ArgsUsage:   "[generation]",
+			Action:      rollback,
+		},
 	},
 }
 
@@ -95,12 +144,13 @@ func inferNames(name string) ([]string, error) {
 	return []string{name}, nil
 }
 
-func findHomeConfiguration(names []string) (string, error) {
+func findHomeConfiguration(ctx context.Context, names []string) (string, error) {
 	for _, name := range names {
 		code := fmt.Sprintf("x: x ? \"%s\"", name)
-		out, err := exec.Command(
-			"nix", "eval", "-f", "nilla.nix", "systems.home", "--apply", code,
-		).Output()
+		out, err := runner.Output(ctx, runner.Cmd{
+			Name: "nix",
+			Args: []string{"eval", "-f", "nilla.nix", "systems.home", "--apply", code},
+		})
 		if err != nil {
 			continue
 		}
@@ -111,36 +161,69 @@ func findHomeConfiguration(names []string) (string, error) {
 	return "", errHomeConfigurationNotFound
 }
 
-func findCurrentGeneration() (string, error) {
-	// Check in /nix/var/nix/profiles
+// profileCandidates returns the locations Home Manager may keep
+// its profile in, in order of preference.
+func profileCandidates() []string {
+	candidates := []string{}
+
+	// $XDG_STATE_HOME/nix/profiles, which defaults
+	// to ~/.local/state/nix/profiles
+	if state := os.Getenv("XDG_STATE_HOME"); state != "" {
+		candidates = append(candidates, filepath.Join(state, "nix/profiles/home-manager"))
+	}
+	if home := os.Getenv("HOME"); home != "" {
+		candidates = append(candidates, filepath.Join(home, ".local/state/nix/profiles/home-manager"))
+	}
+
+	// Legacy per-user profiles in /nix/var/nix/profiles
 	if user := os.Getenv("USER"); user != "" {
-		perUser := fmt.Sprintf("/nix/car/nix/profiles/per-user/%s/home-manager", user)
-		if _, err := os.Stat(perUser); err == nil {
-			return perUser, nil
-		} else if !errors.Is(err, fs.ErrNotExist) {
-			return "", err
-		}
+		candidates = append(candidates, fmt.Sprintf("/nix/var/nix/profiles/per-user/%s/home-manager", user))
 	}
 
-	// Check ~/.local/state/nix/profiles
-	if home := os.Getenv("HOME"); home != "" {
-		homeProfile := fmt.Sprintf("%s/.local/state/nix/profiles/home-manager", home)
-		if _, err := os.Stat(homeProfile); err == nil {
-			return homeProfile, nil
+	return candidates
+}
+
+// findProfile returns the location of the Home Manager profile.
+func findProfile() (string, error) {
+	for _, p := range profileCandidates() {
+		// The profile is a symlink to a generation which may
+		// itself have been garbage collected, so it's not
+		// followed
+		if _, err := os.Lstat(p); err == nil {
+			return p, nil
 		} else if !errors.Is(err, fs.ErrNotExist) {
 			return "", err
 		}
 	}
-	return "", errHomeCurrentGenNotFound
+	return "", errHomeProfileNotFound
 }
 
-func run(ctx *cli.Context, sc subCmd) error {
-	// Try to find current generation
-	current, err := findCurrentGeneration()
+// diffClosures prints how the closure of the generation to
+// activate differs from the current one.
+func diffClosures(ctx context.Context, current, target string) error {
+	s, err := store.Open(ctx)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	diff, err := store.DiffClosures(ctx, s, current, target)
 	if err != nil {
 		return err
 	}
 
+	tui.PrintClosureDiff(os.Stderr, diff)
+	return nil
+}
+
+func run(ctx *cli.Context, sc subCmd) error {
+	// Try to find the current profile, which doesn't
+	// exist on a first activation
+	current, err := findProfile()
+	if err != nil && !errors.Is(err, errHomeProfileNotFound) {
+		return err
+	}
+
 	// Try to infer names to try for the home-manager configuration
 	names, err := inferNames(ctx.Args().First())
 	if err != nil {
@@ -148,7 +231,7 @@ func run(ctx *cli.Context, sc subCmd) error {
 	}
 
 	// Find home configuration from candidates
-	name, err := findHomeConfiguration(names)
+	name, err := findHomeConfiguration(ctx.Context, names)
 	if err != nil {
 		return err
 	}
@@ -156,11 +239,30 @@ func run(ctx *cli.Context, sc subCmd) error {
 	// Attribute of home-manager's activation package
 	attr := fmt.Sprintf("systems.home.%s.result.config.home.activationPackage", name)
 
+	// Use a specialisation's activation package instead
+	if spec := ctx.String("specialisation"); spec != "" {
+		specs, err := nix.ListSpecialisations(ctx.Context, fmt.Sprintf("systems.home.%s.result.config", name))
+		if err != nil {
+			return err
+		}
+		if !slices.Contains(specs, spec) {
+			return fmt.Errorf(
+				"specialisation %q not found, available specialisations: %s",
+				spec, strings.Join(specs, ", "),
+			)
+		}
+
+		attr = fmt.Sprintf(
+			"systems.home.%s.result.config.specialisation.%s.configuration.home.activationPackage",
+			name, spec,
+		)
+	}
+
 	//
 	// Home Manager configuration build
 	//
-	// Build args for nix build
-	nargs := []string{"-f", "nilla.nix", attr}
+	// Extra args for nix build
+	nargs := []string{}
 
 	// Add extra args depending on the sub command
 	if sc == subCmdBuild {
@@ -178,26 +280,57 @@ func run(ctx *cli.Context, sc subCmd) error {
 
 	// Run nix build
 	printSection("Building configuration")
-	out, err := nix.Command("build").
-		Args(nargs).
-		Reporter(tui.NewBuildReporter(ctx.Bool("verbose"))).
-		Run(context.Background())
+	out, err := tui.BuildAttrs(
+		ctx.Context, []string{attr}, nargs,
+		tui.NewBuildReporter(ctx.Bool("verbose")).
+			SummaryFile(ctx.String("summary-file")),
+	)
 	if err != nil {
 		return err
 	}
 
 	//
-	// Run generation diff using nvd
+	// Compare the closures of the previous and new generation
 	//
 	fmt.Fprintln(os.Stderr)
 	printSection("Comparing changes")
 
-	// Run nvd diff
-	diff := exec.Command("nvd", "diff", current, string(out))
-	diff.Stderr = os.Stderr
-	diff.Stdout = os.Stderr
-	if err := diff.Run(); err != nil {
-		return err
+	if current != "" {
+		if err := diffClosures(ctx.Context, current, string(out)); err != nil {
+			return err
+		}
+	} else {
+		fmt.Fprintln(os.Stderr, "No previous generation found")
+	}
+
+	//
+	// Show what would change on activation
+	//
+	if ctx.Bool("dry-activate") {
+		fmt.Fprintln(os.Stderr)
+		printSection("Dry activating configuration")
+
+		return runner.Run(ctx.Context, runner.Cmd{
+			Name:   fmt.Sprintf("%s/activate", out),
+			Env:    []string{"DRY_RUN=1"},
+			Stdout: os.Stdout,
+			Stderr: os.Stderr,
+		})
+	}
+
+	//
+	// Ask for confirmation
+	//
+	if ctx.Bool("ask") {
+		fmt.Fprintln(os.Stderr)
+		ok, err := tui.Confirm(ctx.App.Reader, os.Stderr, "Activate?")
+		if err != nil {
+			return err
+		}
+		if !ok {
+			fmt.Fprintln(os.Stderr, "Not activating configuration")
+			return nil
+		}
 	}
 
 	//
@@ -209,14 +342,101 @@ func run(ctx *cli.Context, sc subCmd) error {
 
 		// Run switch_to_configuration
 		switchp := fmt.Sprintf("%s/activate", out)
-		switchc := exec.Command(switchp)
-		switchc.Stderr = os.Stderr
-		switchc.Stdout = os.Stdout
-
-		if err := switchc.Run(); err != nil {
+		err := runner.Run(ctx.Context, runner.Cmd{
+			Name:   switchp,
+			Stdout: os.Stdout,
+			Stderr: os.Stderr,
+		})
+		if err != nil {
 			return err
 		}
 	}
 
 	return nil
 }
+
+func generations(ctx *cli.Context) error {
+	profile, err := findProfile()
+	if err != nil {
+		return err
+	}
+
+	return nix.PrintGenerations(os.Stdout, profile)
+}
+
+func rollback(ctx *cli.Context) error {
+	profile, err := findProfile()
+	if err != nil {
+		return err
+	}
+
+	gens, err := nix.ListGenerations(profile)
+	if err != nil {
+		return err
+	}
+
+	// Find the generation to roll back to
+	var target *nix.Generation
+	if arg := ctx.Args().First(); arg != "" {
+		id, err := strconv.Atoi(arg)
+		if err != nil {
+			return fmt.Errorf("invalid generation %q", arg)
+		}
+
+		for i := range gens {
+			if gens[i].ID == id {
+				target = &gens[i]
+			}
+		}
+		if target == nil {
+			return fmt.Errorf("generation %d not found", id)
+		}
+	} else {
+		for i := range gens {
+			if gens[i].Current {
+				break
+			}
+			target = &gens[i]
+		}
+		if target == nil {
+			return errNoPreviousGeneration
+		}
+	}
+
+	printSection(fmt.Sprintf("Activating generation %d", target.ID))
+
+	// Activating an older generation makes it the current one
+	return runner.Run(ctx.Context, runner.Cmd{
+		Name:   fmt.Sprintf("%s/activate", target.Target),
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+	})
+}
+
+func specialisations(ctx *cli.Context) error {
+	// Try to infer names to try for the home-manager configuration
+	names, err := inferNames(ctx.Args().First())
+	if err != nil {
+		return err
+	}
+
+	// Find home configuration from candidates
+	name, err := findHomeConfiguration(ctx.Context, names)
+	if err != nil {
+		return err
+	}
+
+	specs, err := nix.ListSpecialisations(ctx.Context, fmt.Sprintf("systems.home.%s.result.config", name))
+	if err != nil {
+		return err
+	}
+	if len(specs) < 1 {
+		return errNoSpecialisations
+	}
+
+	for _, spec := range specs {
+		fmt.Println(spec)
+	}
+
+	return nil
+}
@@ -0,0 +1,257 @@
+package home
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/arnarg/lila/internal/runner"
+	"github.com/arnarg/lila/internal/runner/runnertest"
+	"github.com/arnarg/lila/internal/store"
+)
+
+func runApp(t *testing.T, fake *runner.Fake, args ...string) error {
+	t.Helper()
+
+	ctx := store.WithStore(context.Background(), store.NewFake(
+		&store.PathInfo{Path: testGeneration1, NarSize: 100},
+		&store.PathInfo{Path: testActivation, NarSize: 200},
+	))
+
+	return runnertest.Run(t, ctx, fake, Command, args...)
+}
+
+const (
+	testActivation = "/nix/store/aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa-home-manager-generation"
+	testDrv        = "/nix/store/dddddddddddddddddddddddddddddddd-home-manager-generation.drv"
+)
+
+const (
+	testGeneration1 = "/nix/store/bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb-home-manager-generation"
+	testGeneration2 = "/nix/store/cccccccccccccccccccccccccccccccc-home-manager-generation"
+)
+
+// setupHome creates a home directory with a home-manager profile
+// with the given generations, where the last one is current.
+func setupHome(t *testing.T, generations ...string) string {
+	t.Helper()
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USER", "alice")
+	t.Setenv("XDG_STATE_HOME", "")
+
+	profiles := filepath.Join(home, ".local/state/nix/profiles")
+	profile := filepath.Join(profiles, "home-manager")
+
+	if len(generations) < 1 {
+		return profile
+	}
+
+	if err := os.MkdirAll(profiles, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	link := ""
+	for i, gen := range generations {
+		link = fmt.Sprintf("home-manager-%d-link", i+1)
+		if err := os.Symlink(gen, filepath.Join(profiles, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.Symlink(link, profile); err != nil {
+		t.Fatal(err)
+	}
+
+	return profile
+}
+
+func TestSwitch(t *testing.T) {
+	setupHome(t, testGeneration1)
+
+	fake := runner.NewFake(
+		runner.Response{
+			Name:   "nix",
+			Args:   []string{"eval", "-f", "nilla.nix", "systems.home", "--apply", `x: x ? "alice"`},
+			Stdout: "true\n",
+		},
+		runner.Response{
+			Name:   "nix",
+			Args:   []string{"eval", "-f", "nilla.nix", "systems.home.alice.result.config.home.activationPackage.drvPath", "--raw"},
+			Stdout: testDrv + "\n",
+		},
+		runner.Response{
+			Name:   "nix",
+			Args:   []string{"build", "--print-out-paths", testDrv + "^*", "--no-link"},
+			Stdout: testActivation + "\n",
+		},
+		runner.Response{
+			Name: testActivation + "/activate",
+		},
+	)
+
+	if err := runApp(t, fake, "switch", "alice"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	runnertest.AssertAllUsed(t, fake)
+}
+
+func TestSwitchConfigurationNotFound(t *testing.T) {
+	setupHome(t, testGeneration1)
+
+	fake := runner.NewFake(
+		runner.Response{
+			Name:   "nix",
+			Args:   []string{"eval", "-f", "nilla.nix", "systems.home"},
+			Stdout: "false\n",
+		},
+	)
+
+	err := runApp(t, fake, "switch", "bob")
+	if err != errHomeConfigurationNotFound {
+		t.Fatalf("error is '%v' but '%v' was expected", err, errHomeConfigurationNotFound)
+	}
+}
+
+func TestSwitchFirstActivation(t *testing.T) {
+	setupHome(t)
+
+	fake := runner.NewFake(
+		runner.Response{
+			Name:   "nix",
+			Args:   []string{"eval", "-f", "nilla.nix", "systems.home", "--apply", `x: x ? "alice"`},
+			Stdout: "true\n",
+		},
+		runner.Response{
+			Name:   "nix",
+			Args:   []string{"eval", "-f", "nilla.nix", "systems.home.alice.result.config.home.activationPackage.drvPath"},
+			Stdout: testDrv + "\n",
+		},
+		runner.Response{
+			Name:   "nix",
+			Args:   []string{"build"},
+			Stdout: testActivation + "\n",
+		},
+		runner.Response{
+			Name: testActivation + "/activate",
+		},
+	)
+
+	if err := runApp(t, fake, "switch", "alice"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// No diff should be run without a previous generation
+	runnertest.AssertAllUsed(t, fake)
+	if calls := fake.Calls(); len(calls) != 4 {
+		t.Errorf("expected only 4 commands to run but %d were run", len(calls))
+	}
+}
+
+func TestRollback(t *testing.T) {
+	tests := []struct {
+		name   string
+		args   []string
+		target string
+	}{
+		{
+			name:   "previous generation",
+			target: testGeneration2,
+		},
+		{
+			name:   "specific generation",
+			args:   []string{"1"},
+			target: testGeneration1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupHome(t, testGeneration1, testGeneration2, testActivation)
+
+			fake := runner.NewFake(
+				runner.Response{Name: tt.target + "/activate"},
+			)
+
+			if err := runApp(t, fake, append([]string{"rollback"}, tt.args...)...); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			runnertest.AssertAllUsed(t, fake)
+		})
+	}
+}
+
+func TestRollbackWithoutPrevious(t *testing.T) {
+	setupHome(t, testGeneration1)
+
+	err := runApp(t, runner.NewFake(), "rollback")
+	if err != errNoPreviousGeneration {
+		t.Fatalf("error is '%v' but '%v' was expected", err, errNoPreviousGeneration)
+	}
+}
+
+func TestSwitchSpecialisation(t *testing.T) {
+	setupHome(t, testGeneration1)
+
+	fake := runner.NewFake(
+		runner.Response{
+			Name:   "nix",
+			Args:   []string{"eval", "-f", "nilla.nix", "systems.home", "--apply", `x: x ? "alice"`},
+			Stdout: "true\n",
+		},
+		runner.Response{
+			Name:   "nix",
+			Args:   []string{"eval", "-f", "nilla.nix", "systems.home.alice.result.config.specialisation"},
+			Stdout: `["dark","light"]`,
+		},
+		runner.Response{
+			Name: "nix",
+			Args: []string{
+				"eval", "-f", "nilla.nix",
+				"systems.home.alice.result.config.specialisation.dark.configuration.home.activationPackage.drvPath",
+			},
+			Stdout: testDrv + "\n",
+		},
+		runner.Response{
+			Name:   "nix",
+			Args:   []string{"build", "--print-out-paths", testDrv + "^*"},
+			Stdout: testActivation + "\n",
+		},
+		runner.Response{
+			Name: testActivation + "/activate",
+		},
+	)
+
+	if err := runApp(t, fake, "switch", "--specialisation", "dark", "alice"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	runnertest.AssertAllUsed(t, fake)
+}
+
+func TestSwitchSpecialisationNotFound(t *testing.T) {
+	setupHome(t, testGeneration1)
+
+	fake := runner.NewFake(
+		runner.Response{
+			Name:   "nix",
+			Args:   []string{"eval", "-f", "nilla.nix", "systems.home", "--apply", `x: x ? "alice"`},
+			Stdout: "true\n",
+		},
+		runner.Response{
+			Name:   "nix",
+			Args:   []string{"eval", "-f", "nilla.nix", "systems.home.alice.result.config.specialisation"},
+			Stdout: `["dark","light"]`,
+		},
+	)
+
+	err := runApp(t, fake, "switch", "--specialisation", "work", "alice")
+	if err == nil || err.Error() != `specialisation "work" not found, available specialisations: dark, light` {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
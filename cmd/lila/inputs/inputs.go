@@ -0,0 +1,196 @@
+package inputs
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/arnarg/lila/internal/npins"
+	"github.com/arnarg/lila/internal/util"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/urfave/cli/v2"
+)
+
+var Command = &cli.Command{
+	Name:        "inputs",
+	Usage:       "List pinned inputs",
+	Description: "Lists inputs of the nilla project pinned with npins",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "json",
+			Usage: "Print inputs as JSON",
+		},
+		&cli.StringFlag{
+			Name:  "stale",
+			Usage: "Only list inputs locked longer than `DURATION` ago (e.g. 30d) and fail if there are any",
+		},
+		&cli.StringFlag{
+			Name:  "sources",
+			Usage: "Path to the npins sources `FILE`",
+			Value: npins.DefaultSources,
+		},
+	},
+	Action: run,
+}
+
+// input is a pinned input with its lock status.
+type input struct {
+	Name     string    `json:"name"`
+	Type     string    `json:"type"`
+	URL      string    `json:"url"`
+	Branch   string    `json:"branch,omitempty"`
+	Version  string    `json:"version,omitempty"`
+	Revision string    `json:"revision"`
+	Locked   time.Time `json:"locked"`
+	// Newest revision fetched by lila, if it differs
+	// from the locked revision
+	Newer string `json:"newer,omitempty"`
+}
+
+func (i input) age() time.Duration {
+	return time.Since(i.Locked)
+}
+
+// fmtAge formats the age of a lock in days.
+func fmtAge(d time.Duration) string {
+	days := int(d / util.Day)
+	switch {
+	case days < 1:
+		return "today"
+	case days == 1:
+		return "1 day"
+	}
+	return fmt.Sprintf("%d days", days)
+}
+
+func printInputs(inputs []input) {
+	headers := []string{"Name", "Type", "Source", "Ref", "Revision", "Age", ""}
+	rows := [][]string{}
+
+	for _, in := range inputs {
+		ref := in.Branch
+		if in.Version != "" {
+			ref = in.Version
+		}
+
+		rev := in.Revision
+		if len(rev) > 12 {
+			rev = rev[:12]
+		}
+
+		status := ""
+		if in.Newer != "" {
+			status = "update available"
+		}
+
+		rows = append(rows, []string{in.Name, in.Type, in.URL, ref, rev, fmtAge(in.age()), status})
+	}
+
+	// Width of every column
+	widths := make([]int, len(headers))
+	for i, h := range headers {
+		widths[i] = len(h)
+	}
+	for _, row := range rows {
+		for i, col := range row {
+			widths[i] = max(widths[i], lipgloss.Width(col))
+		}
+	}
+
+	hdr := lipgloss.NewStyle().Bold(true)
+	newer := lipgloss.NewStyle().Foreground(lipgloss.Color("11"))
+
+	for i, h := range headers {
+		fmt.Print(hdr.Width(widths[i] + 2).Render(h))
+	}
+	fmt.Println()
+
+	for _, row := range rows {
+		for i, col := range row {
+			style := lipgloss.NewStyle().Width(widths[i] + 2)
+			if i == len(row)-1 {
+				style = newer
+			}
+			fmt.Print(style.Render(col))
+		}
+		fmt.Println()
+	}
+}
+
+func run(ctx *cli.Context) error {
+	path := ctx.String("sources")
+
+	var stale time.Duration
+	if ctx.IsSet("stale") {
+		var err error
+		if stale, err = util.ParseDuration(ctx.String("stale")); err != nil {
+			return err
+		}
+		// Zero would turn the filter off instead
+		if stale <= 0 {
+			return fmt.Errorf("--stale must be a positive duration, got %q", ctx.String("stale"))
+		}
+	}
+
+	srcs, err := npins.Load(path)
+	if err != nil {
+		return err
+	}
+
+	// Revisions fetched by lila update are
+	// used to tell if updates are available
+	var cache *npins.Cache
+	if dir, err := npins.DefaultCacheDir(); err == nil {
+		cache = npins.NewCache(dir)
+	}
+
+	inputs := []input{}
+	for _, pin := range srcs.Pins() {
+		in := input{
+			Name:     pin.Name,
+			Type:     pin.Type,
+			URL:      pin.URL,
+			Branch:   pin.Branch,
+			Version:  pin.Version,
+			Revision: pin.Revision,
+		}
+		if remote, err := pin.Remote(); err == nil {
+			in.URL = remote
+		}
+
+		if in.Locked, err = npins.LockTime(ctx.Context, path, pin); err != nil {
+			return err
+		}
+
+		if cache != nil {
+			if rev, ok := cache.Latest(ctx.Context, pin); ok && rev != pin.Revision {
+				in.Newer = rev
+			}
+		}
+
+		if stale > 0 && in.age() < stale {
+			continue
+		}
+
+		inputs = append(inputs, in)
+	}
+
+	if ctx.Bool("json") {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(inputs); err != nil {
+			return err
+		}
+	} else if len(inputs) > 0 {
+		printInputs(inputs)
+	}
+
+	if stale > 0 && len(inputs) < 1 {
+		fmt.Fprintf(os.Stderr, "All inputs were locked within %s\n", ctx.String("stale"))
+	} else if stale > 0 {
+		return fmt.Errorf("%d inputs were locked more than %s ago", len(inputs), ctx.String("stale"))
+	}
+
+	return nil
+}
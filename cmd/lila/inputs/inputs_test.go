@@ -0,0 +1,137 @@
+package inputs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arnarg/lila/internal/runner"
+	"github.com/arnarg/lila/internal/runner/runnertest"
+)
+
+func runApp(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+
+	// Capture stdout
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	err = runnertest.Run(t, context.Background(), runner.Local{}, Command, args...)
+	w.Close()
+
+	b := &bytes.Buffer{}
+	if _, cerr := io.Copy(b, r); cerr != nil {
+		t.Fatal(cerr)
+	}
+
+	return b.String(), err
+}
+
+// setupProject creates a project with the sources file committed
+// at the given time.
+func setupProject(t *testing.T, locked time.Time) string {
+	t.Helper()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("GIT_AUTHOR_NAME", "lila")
+	t.Setenv("GIT_AUTHOR_EMAIL", "lila@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "lila")
+	t.Setenv("GIT_COMMITTER_EMAIL", "lila@example.com")
+	t.Setenv("GIT_COMMITTER_DATE", locked.Format(time.RFC3339))
+
+	dir := t.TempDir()
+	git := func(args ...string) {
+		out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s failed: %s\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+
+	data, err := os.ReadFile("../../../npins/sources.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "npins", "sources.json")
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	git("init", "--quiet")
+	git("add", ".")
+	git("commit", "--quiet", "-m", "Lock inputs")
+
+	return path
+}
+
+func TestInputsJSON(t *testing.T) {
+	locked := time.Now().Add(-60 * 24 * time.Hour).Truncate(time.Second)
+	path := setupProject(t, locked)
+
+	out, err := runApp(t, "--sources", path, "--json")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	inputs := []input{}
+	if err := json.Unmarshal([]byte(out), &inputs); err != nil {
+		t.Fatalf("invalid JSON output: %s\n%s", err, out)
+	}
+
+	if len(inputs) != 3 {
+		t.Fatalf("expected 3 inputs but got %d", len(inputs))
+	}
+
+	nilla := inputs[1]
+	if nilla.Name != "nilla" || nilla.URL != "https://github.com/nilla-nix/nilla.git" || nilla.Branch != "main" {
+		t.Errorf("input is '%+v' but nilla was expected", nilla)
+	}
+	if !nilla.Locked.Equal(locked) {
+		t.Errorf("lock time is '%s' but '%s' was expected", nilla.Locked, locked)
+	}
+}
+
+func TestInputsStale(t *testing.T) {
+	path := setupProject(t, time.Now().Add(-60*24*time.Hour))
+
+	if _, err := runApp(t, "--sources", path, "--stale", "30d"); err == nil {
+		t.Error("expected an error for stale inputs")
+	}
+
+	out, err := runApp(t, "--sources", path, "--stale", "90d")
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if out != "" {
+		t.Errorf("expected no inputs to be listed but got\n%s", out)
+	}
+}
+
+func TestInputsStaleNotPositive(t *testing.T) {
+	path := setupProject(t, time.Now().Add(-60*24*time.Hour))
+
+	for _, stale := range []string{"0d", "0", ""} {
+		if _, err := runApp(t, "--sources", path, "--stale", stale); err == nil {
+			t.Errorf("expected an error for --stale %q", stale)
+		}
+	}
+}
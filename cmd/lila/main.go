@@ -1,38 +1,86 @@
 package main
 
 import (
+	"context"
 	"log"
 	gos "os"
 
 	"github.com/arnarg/lila/cmd/lila/build"
+	"github.com/arnarg/lila/cmd/lila/check"
+	"github.com/arnarg/lila/cmd/lila/eval"
 	"github.com/arnarg/lila/cmd/lila/home"
+	"github.com/arnarg/lila/cmd/lila/inputs"
 	"github.com/arnarg/lila/cmd/lila/os"
+	"github.com/arnarg/lila/cmd/lila/repl"
 	"github.com/arnarg/lila/cmd/lila/shell"
+	"github.com/arnarg/lila/cmd/lila/size"
+	"github.com/arnarg/lila/cmd/lila/test"
+	"github.com/arnarg/lila/cmd/lila/tree"
+	"github.com/arnarg/lila/cmd/lila/update"
+	"github.com/arnarg/lila/cmd/lila/why"
+	"github.com/arnarg/lila/internal/elevate"
+	"github.com/arnarg/lila/internal/flags"
+	"github.com/arnarg/lila/internal/runner"
+	"github.com/arnarg/lila/internal/tui"
 	"github.com/urfave/cli/v2"
 )
 
 var version = "unknown"
 
+// RECORD_FIXTURES_VAR can be set to a path to record all external
+// commands run, and their output, as test fixtures.
+const RECORD_FIXTURES_VAR = "LILA_RECORD_FIXTURES"
+
 func main() {
 	app := &cli.App{
 		Name:        "lila",
 		Version:     version,
 		Description: "Alternative CLI for nilla projects.",
-		Flags: []cli.Flag{
-			&cli.BoolFlag{
-				Name:  "verbose",
-				Usage: "Set log level to verbose",
-			},
+		Flags:       flags.Global(),
+		Before: func(ctx *cli.Context) error {
+			method, err := elevate.Parse(ctx.String("elevate"))
+			if err != nil {
+				return err
+			}
+			ctx.Context = elevate.WithMethod(ctx.Context, method)
+			ctx.Context = tui.WithWarningsAsErrors(ctx.Context, ctx.Bool("warnings-as-errors"))
+			return nil
 		},
 		Commands: cli.Commands{
 			build.Command,
+			check.Command,
 			os.Command,
 			home.Command,
 			shell.Command,
+			test.Command,
+			update.Command,
+			inputs.Command,
+			eval.Command,
+			repl.Command,
+			why.Command,
+			tree.Command,
+			size.Command,
 		},
 	}
 
-	if err := app.Run(gos.Args); err != nil {
+	ctx := context.Background()
+
+	// Record all commands run as fixtures for tests
+	var rec *runner.Recorder
+	if path := gos.Getenv(RECORD_FIXTURES_VAR); path != "" {
+		rec = runner.NewRecorder(runner.Local{}, path)
+		ctx = runner.WithRunner(ctx, rec)
+	}
+
+	err := app.RunContext(ctx, gos.Args)
+
+	if rec != nil {
+		if serr := rec.Save(); serr != nil {
+			log.Print(serr)
+		}
+	}
+
+	if err != nil {
 		log.Fatal(err)
 	}
 }
@@ -0,0 +1,320 @@
+package os
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arnarg/lila/internal/runner"
+	"github.com/arnarg/lila/internal/tui"
+	"github.com/urfave/cli/v2"
+)
+
+// hostsExpr maps every NixOS system of the project to its
+// deployment metadata, set in the system's configuration.
+const hostsExpr = `systems: builtins.mapAttrs (name: system: {
+  targetHost = system.result.config.deployment.targetHost or name;
+  targetUser = system.result.config.deployment.targetUser or "root";
+  tags = system.result.config.deployment.tags or [];
+}) systems`
+
+// outputTailLines is how many lines of a failed command's output
+// are shown with the error.
+const outputTailLines = 10
+
+type host struct {
+	Name       string   `json:"-"`
+	TargetHost string   `json:"targetHost"`
+	TargetUser string   `json:"targetUser"`
+	Tags       []string `json:"tags"`
+}
+
+// destination returns the SSH destination of the host.
+func (h host) destination() string {
+	if h.TargetUser == "" {
+		return h.TargetHost
+	}
+	return fmt.Sprintf("%s@%s", h.TargetUser, h.TargetHost)
+}
+
+// isDeploy returns true when switch should deploy to
+// multiple hosts.
+func isDeploy(ctx *cli.Context) bool {
+	return len(ctx.StringSlice("hosts")) > 0 ||
+		ctx.Bool("all") ||
+		len(ctx.StringSlice("tag")) > 0
+}
+
+// listHosts returns the deployment metadata of all NixOS
+// systems in the project.
+func listHosts(ctx context.Context) (map[string]host, error) {
+	out, err := runner.Output(ctx, runner.Cmd{
+		Name: "nix",
+		Args: []string{"eval", "-f", "nilla.nix", "systems.nixos", "--apply", hostsExpr, "--json"},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	hosts := map[string]host{}
+	if err := json.Unmarshal(out, &hosts); err != nil {
+		return nil, err
+	}
+
+	for name, h := range hosts {
+		h.Name = name
+		hosts[name] = h
+	}
+
+	return hosts, nil
+}
+
+// selectHosts returns the hosts selected by name, by tag or all
+// of them, sorted by name.
+func selectHosts(hosts map[string]host, names []string, all bool, tags []string) ([]host, error) {
+	selected := []host{}
+
+	for name, h := range hosts {
+		if all || slices.Contains(names, name) {
+			selected = append(selected, h)
+			continue
+		}
+		for _, tag := range tags {
+			if slices.Contains(h.Tags, tag) {
+				selected = append(selected, h)
+				break
+			}
+		}
+	}
+
+	for _, name := range names {
+		if _, ok := hosts[name]; !ok {
+			return nil, fmt.Errorf("NixOS system %q not found", name)
+		}
+	}
+
+	if len(selected) < 1 {
+		return nil, fmt.Errorf("no hosts selected")
+	}
+
+	slices.SortFunc(selected, func(a, b host) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return selected, nil
+}
+
+// remoteRun runs a command on a host over SSH, with elevated
+// privileges unless logging in as root. SSH runs in batch mode
+// without a terminal, so other users need passwordless sudo
+// (NOPASSWD) on the host.
+func remoteRun(ctx context.Context, h host, args ...string) error {
+	if h.TargetUser != "root" {
+		args = append([]string{"sudo", "--non-interactive"}, args...)
+	}
+
+	return outputRun(ctx, runner.Cmd{
+		Name: "ssh",
+		Args: append([]string{"-o", "BatchMode=yes", h.destination(), "--"}, args...),
+	})
+}
+
+// outputRun runs a command and captures its output, which is
+// added to the error if the command fails.
+func outputRun(ctx context.Context, cmd runner.Cmd) error {
+	b := &bytes.Buffer{}
+	cmd.Stdout = b
+	cmd.Stderr = b
+
+	if err := runner.Run(ctx, cmd); err != nil {
+		lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+		if len(lines) > outputTailLines {
+			lines = lines[len(lines)-outputTailLines:]
+		}
+		return fmt.Errorf("%s: %w\n%s", runner.FormatCmd(cmd), err, strings.Join(lines, "\n"))
+	}
+
+	return nil
+}
+
+// deployOptions are the options of a deployment that apply
+// to every host.
+type deployOptions struct {
+	magicRollback  bool
+	confirmTimeout time.Duration
+}
+
+// deployHost copies the toplevel to the host, sets it as the
+// system profile and switches to it.
+func deployHost(ctx context.Context, h host, toplevel string, opts deployOptions, updates chan<- tui.HostUpdate) error {
+	updates <- tui.HostUpdate{Host: h.Name, State: tui.HostCopying}
+
+	err := outputRun(ctx, runner.Cmd{
+		Name: "nix",
+		Args: []string{
+			"copy", "--to", "ssh-ng://" + h.destination(),
+			"--substitute-on-destination", toplevel,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	if opts.magicRollback {
+		return activateWithRollback(ctx, h, toplevel, opts.confirmTimeout, updates)
+	}
+
+	updates <- tui.HostUpdate{Host: h.Name, State: tui.HostActivating}
+
+	err = remoteRun(ctx, h, "nix-env", "-p", SYSTEM_PROFILE, "--set", toplevel)
+	if err != nil {
+		return err
+	}
+
+	return remoteRun(ctx, h, toplevel+"/bin/switch-to-configuration", "switch")
+}
+
+// deployUnsupported are the flags of switch that only apply to
+// the local system.
+var deployUnsupported = []string{"dry-activate", "json", "specialisation", "no-specialisation"}
+
+// checkDeployArgs returns an error if switch is given arguments
+// that can't be used when deploying to hosts.
+func checkDeployArgs(ctx *cli.Context) error {
+	if ctx.Args().Present() {
+		return fmt.Errorf("a system name can't be given when deploying, use --hosts instead")
+	}
+	for _, name := range deployUnsupported {
+		if ctx.IsSet(name) {
+			return fmt.Errorf("--%s can't be used when deploying to hosts", name)
+		}
+	}
+	return nil
+}
+
+func deploy(ctx *cli.Context) error {
+	if err := checkDeployArgs(ctx); err != nil {
+		return err
+	}
+
+	all, err := listHosts(ctx.Context)
+	if err != nil {
+		return err
+	}
+
+	hosts, err := selectHosts(all, ctx.StringSlice("hosts"), ctx.Bool("all"), ctx.StringSlice("tag"))
+	if err != nil {
+		return err
+	}
+
+	//
+	// NixOS configurations build
+	//
+	// All toplevels are built in a single nix build
+	attrs := []string{}
+	for _, h := range hosts {
+		attrs = append(attrs, fmt.Sprintf("systems.nixos.%s.result.config.system.build.toplevel", h.Name))
+	}
+
+	printSection(fmt.Sprintf("Building configurations of %d hosts", len(hosts)))
+	out, err := tui.BuildAttrs(
+		ctx.Context, attrs, []string{"--no-link"},
+		tui.NewBuildReporter(ctx.Bool("verbose")).
+			SummaryFile(ctx.String("summary-file")),
+	)
+	if err != nil {
+		return err
+	}
+
+	// Output paths are printed in the order of the installables
+	toplevels := strings.Fields(string(out))
+	if len(toplevels) != len(hosts) {
+		return fmt.Errorf("expected %d output paths but got %d", len(hosts), len(toplevels))
+	}
+
+	//
+	// Ask for confirmation
+	//
+	if ctx.Bool("ask") {
+		fmt.Fprintln(os.Stderr)
+		for _, h := range hosts {
+			fmt.Fprintf(os.Stderr, "%s (%s)\n", h.Name, h.destination())
+		}
+		ok, err := tui.Confirm(ctx.App.Reader, os.Stderr, "Deploy?")
+		if err != nil {
+			return err
+		}
+		if !ok {
+			fmt.Fprintln(os.Stderr, "Not deploying configurations")
+			return nil
+		}
+	}
+
+	//
+	// Deploy to every host with a bounded number
+	// of workers
+	//
+	fmt.Fprintln(os.Stderr)
+	printSection("Deploying configurations")
+
+	names := []string{}
+	for _, h := range hosts {
+		names = append(names, h.Name)
+	}
+
+	opts := deployOptions{
+		magicRollback:  ctx.Bool("magic-rollback"),
+		confirmTimeout: ctx.Duration("confirm-timeout"),
+	}
+
+	jobs := make(chan int)
+	updates := make(chan tui.HostUpdate)
+
+	var wg sync.WaitGroup
+	for range max(ctx.Int("parallel"), 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				err := deployHost(ctx.Context, hosts[i], toplevels[i], opts, updates)
+				if err != nil {
+					updates <- tui.HostUpdate{Host: hosts[i].Name, State: tui.HostFailed, Err: err}
+				} else {
+					updates <- tui.HostUpdate{Host: hosts[i].Name, State: tui.HostDone}
+				}
+			}
+		}()
+	}
+
+	go func() {
+		for i := range hosts {
+			jobs <- i
+		}
+		close(jobs)
+		wg.Wait()
+		close(updates)
+	}()
+
+	results, err := tui.NewDeployReporter(names).Run(ctx.Context, updates)
+	if err != nil {
+		return err
+	}
+
+	failed := []string{}
+	for _, res := range results {
+		if res.State != tui.HostDone {
+			failed = append(failed, res.Host)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("deployment failed on %d of %d hosts: %s", len(failed), len(hosts), strings.Join(failed, ", "))
+	}
+
+	return nil
+}
@@ -0,0 +1,148 @@
+package os
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/arnarg/lila/internal/elevate"
+	"github.com/arnarg/lila/internal/runner"
+	"github.com/arnarg/lila/internal/runner/runnertest"
+)
+
+const testHosts = `{
+  "db1": {"targetHost": "db1.example.com", "targetUser": "root", "tags": ["db"]},
+  "web1": {"targetHost": "web1.example.com", "targetUser": "deploy", "tags": ["web"]},
+  "web2": {"targetHost": "web2.example.com", "targetUser": "root", "tags": ["web"]}
+}`
+
+func TestSelectHosts(t *testing.T) {
+	hosts := map[string]host{
+		"db1":  {Name: "db1", Tags: []string{"db"}},
+		"web1": {Name: "web1", Tags: []string{"web"}},
+		"web2": {Name: "web2", Tags: []string{"web", "edge"}},
+	}
+
+	tests := []struct {
+		names    []string
+		all      bool
+		tags     []string
+		expected []string
+		err      bool
+	}{
+		{names: []string{"web2", "db1"}, expected: []string{"db1", "web2"}},
+		{all: true, expected: []string{"db1", "web1", "web2"}},
+		{tags: []string{"web"}, expected: []string{"web1", "web2"}},
+		{names: []string{"db1"}, tags: []string{"edge"}, expected: []string{"db1", "web2"}},
+		{tags: []string{"mail"}, err: true},
+		{names: []string{"web3"}, err: true},
+	}
+
+	for _, test := range tests {
+		selected, err := selectHosts(hosts, test.names, test.all, test.tags)
+		if test.err {
+			if err == nil {
+				t.Errorf("selectHosts(%v, %t, %v) was expected to fail", test.names, test.all, test.tags)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("selectHosts(%v, %t, %v) failed: %s", test.names, test.all, test.tags, err)
+			continue
+		}
+
+		names := []string{}
+		for _, h := range selected {
+			names = append(names, h.Name)
+		}
+		if !slices.Equal(names, test.expected) {
+			t.Errorf("selectHosts(%v, %t, %v) is '%v' but '%v' was expected", test.names, test.all, test.tags, names, test.expected)
+		}
+	}
+}
+
+func TestDeploy(t *testing.T) {
+	web1 := "/nix/store/cccccccccccccccccccccccccccccccc-nixos-system-web1-25.05"
+	web2 := "/nix/store/dddddddddddddddddddddddddddddddd-nixos-system-web2-25.05"
+	web1Drv := "/nix/store/eeeeeeeeeeeeeeeeeeeeeeeeeeeeeeee-nixos-system-web1-25.05.drv"
+	web2Drv := "/nix/store/ffffffffffffffffffffffffffffffff-nixos-system-web2-25.05.drv"
+
+	fake := runner.NewFake(
+		runner.Response{
+			Name:   "nix",
+			Args:   []string{"eval", "-f", "nilla.nix", "systems.nixos"},
+			Stdout: testHosts,
+		},
+		runner.Response{
+			Name:   "nix",
+			Args:   []string{"eval", "-f", "nilla.nix", "systems.nixos.web1.result.config.system.build.toplevel.drvPath", "--raw"},
+			Stdout: web1Drv,
+		},
+		runner.Response{
+			Name:   "nix",
+			Args:   []string{"eval", "-f", "nilla.nix", "systems.nixos.web2.result.config.system.build.toplevel.drvPath", "--raw"},
+			Stdout: web2Drv,
+		},
+		runner.Response{
+			Name:   "nix",
+			Args:   []string{"build", "--print-out-paths", web1Drv + "^*", web2Drv + "^*"},
+			Stdout: web1 + "\n" + web2 + "\n",
+		},
+		runner.Response{
+			Name: "nix",
+			Args: []string{"copy", "--to", "ssh-ng://deploy@web1.example.com"},
+		},
+		runner.Response{
+			Name: "ssh",
+			Args: []string{"-o", "BatchMode=yes", "deploy@web1.example.com", "--", "sudo", "--non-interactive", "nix-env", "-p", SYSTEM_PROFILE, "--set", web1},
+		},
+		runner.Response{
+			Name: "ssh",
+			Args: []string{"-o", "BatchMode=yes", "deploy@web1.example.com", "--", "sudo", "--non-interactive", web1 + "/bin/switch-to-configuration", "switch"},
+		},
+		runner.Response{
+			Name: "nix",
+			Args: []string{"copy", "--to", "ssh-ng://root@web2.example.com"},
+		},
+		runner.Response{
+			Name: "ssh",
+			Args: []string{"-o", "BatchMode=yes", "root@web2.example.com", "--", "nix-env", "-p", SYSTEM_PROFILE, "--set", web2},
+		},
+		runner.Response{
+			Name:     "ssh",
+			Args:     []string{"-o", "BatchMode=yes", "root@web2.example.com", "--", web2 + "/bin/switch-to-configuration", "switch"},
+			Stderr:   "warning: the following units failed: nginx.service\n",
+			ExitCode: 4,
+		},
+	)
+
+	err := runApp(t, fake, elevate.MethodSudo, "switch", "--tag", "web", "-j", "1", "--magic-rollback=false")
+	if err == nil {
+		t.Fatal("expected an error for a failed host")
+	}
+	if !strings.Contains(err.Error(), "1 of 2 hosts: web2") {
+		t.Errorf("error is '%s' but the failed host was expected", err)
+	}
+
+	runnertest.AssertAllUsed(t, fake)
+}
+
+func TestDeployUnsupportedArgs(t *testing.T) {
+	tests := [][]string{
+		{"switch", "--hosts", "web1", "myhost"},
+		{"switch", "--hosts", "web1", "--dry-activate"},
+		{"switch", "--all", "--json"},
+		{"switch", "--tag", "web", "--specialisation", "work"},
+		{"switch", "--all", "--no-specialisation"},
+	}
+
+	for _, args := range tests {
+		fake := runner.NewFake()
+		if err := runApp(t, fake, elevate.MethodNone, args...); err == nil {
+			t.Errorf("expected an error for '%s'", strings.Join(args, " "))
+		}
+		if calls := fake.Calls(); len(calls) != 0 {
+			t.Errorf("expected no commands to run for '%s' but %d were run", strings.Join(args, " "), len(calls))
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package os
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/arnarg/lila/internal/runner"
+	"github.com/arnarg/lila/internal/tui"
+	"github.com/urfave/cli/v2"
+)
+
+// imageFormat describes where an image format is found in a
+// NixOS configuration and which files make up the image.
+type imageFormat struct {
+	// Variant in system.build.images
+	variant string
+	// Attribute in system.build set by the older image
+	// modules, like the installation CD module
+	legacy string
+	// Extensions of the image files
+	exts []string
+}
+
+var imageFormats = map[string]imageFormat{
+	"iso":     {variant: "iso", legacy: "isoImage", exts: []string{".iso"}},
+	"qcow2":   {variant: "qemu", exts: []string{".qcow2"}},
+	"raw":     {variant: "raw", exts: []string{".img", ".raw"}},
+	"sd-card": {variant: "sd-card", legacy: "sdImage", exts: []string{".img", ".img.zst"}},
+}
+
+// imageAttr returns the attribute of the NixOS configuration
+// that builds an image in the format.
+func imageAttr(ctx *cli.Context, name string, format imageFormat) (string, error) {
+	build := fmt.Sprintf("systems.nixos.%s.result.config.system.build", name)
+
+	out, err := runner.Output(ctx.Context, runner.Cmd{
+		Name: "nix",
+		Args: []string{"eval", "-f", "nilla.nix", build, "--apply", "builtins.attrNames", "--json"},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	attrs := []string{}
+	if err := json.Unmarshal(out, &attrs); err != nil {
+		return "", err
+	}
+
+	// An image module imported by the configuration
+	// takes precedence over the generic image variants
+	if format.legacy != "" && slices.Contains(attrs, format.legacy) {
+		return fmt.Sprintf("%s.%s", build, format.legacy), nil
+	}
+	if slices.Contains(attrs, "images") {
+		return fmt.Sprintf("%s.images.%s", build, format.variant), nil
+	}
+
+	return "", fmt.Errorf("configuration %q does not support building %s images", name, format.variant)
+}
+
+// findImages returns the image files in a build result.
+func findImages(out string, format imageFormat) ([]string, error) {
+	images := []string{}
+
+	err := filepath.WalkDir(out, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		for _, ext := range format.exts {
+			if strings.HasSuffix(path, ext) {
+				images = append(images, path)
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return images, nil
+}
+
+// copyImage copies an image out of the nix store, into a file
+// that is writable, unlike the one in the store.
+func copyImage(src, dir string) (string, error) {
+	dst := filepath.Join(dir, filepath.Base(src))
+
+	in, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return "", err
+	}
+
+	return dst, out.Close()
+}
+
+func image(ctx *cli.Context) error {
+	// Try to infer name of the NixOS system
+	name, err := inferName(ctx.Args().First())
+	if err != nil {
+		return err
+	}
+
+	format, ok := imageFormats[ctx.String("format")]
+	if !ok {
+		return fmt.Errorf("unknown image format %q", ctx.String("format"))
+	}
+
+	attr, err := imageAttr(ctx, name, format)
+	if err != nil {
+		return err
+	}
+
+	//
+	// NixOS image build
+	//
+	printSection("Building image")
+	out, err := tui.BuildAttrs(
+		ctx.Context, []string{attr}, []string{"--no-link"},
+		tui.NewBuildReporter(ctx.Bool("verbose")).
+			SummaryFile(ctx.String("summary-file")),
+	)
+	if err != nil {
+		return err
+	}
+
+	images, err := findImages(string(out), format)
+	if err != nil {
+		return err
+	}
+	if len(images) < 1 {
+		return fmt.Errorf("no image found in %s", out)
+	}
+
+	//
+	// Copy image to output directory
+	//
+	fmt.Fprintln(os.Stderr)
+	printSection("Copying image")
+
+	dir := ctx.String("output")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	for _, img := range images {
+		dst, err := copyImage(img, dir)
+		if err != nil {
+			return err
+		}
+		fmt.Println(dst)
+	}
+
+	return nil
+}
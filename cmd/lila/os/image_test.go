@@ -0,0 +1,77 @@
+package os
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/arnarg/lila/internal/elevate"
+	"github.com/arnarg/lila/internal/runner"
+	"github.com/arnarg/lila/internal/runner/runnertest"
+)
+
+func TestImage(t *testing.T) {
+	// The image's output with the ISO in a sub directory
+	out := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(out, "iso"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(out, "iso", "nixos.iso"), []byte("iso"), 0o444); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(out, "nix-support"), nil, 0o444); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Join(t.TempDir(), "images")
+
+	fake := runner.NewFake(
+		runner.Response{
+			Name:   "nix",
+			Args:   []string{"eval", "-f", "nilla.nix", "systems.nixos.myhost.result.config.system.build"},
+			Stdout: `["images","isoImage","toplevel"]`,
+		},
+		runner.Response{
+			Name:   "nix",
+			Args:   []string{"eval", "-f", "nilla.nix", "systems.nixos.myhost.result.config.system.build.isoImage.drvPath", "--raw"},
+			Stdout: testDrv,
+		},
+		runner.Response{
+			Name:   "nix",
+			Args:   []string{"build", "--print-out-paths", testDrv + "^*"},
+			Stdout: out + "\n",
+		},
+	)
+
+	if err := runApp(t, fake, elevate.MethodSudo, "image", "--format", "iso", "-o", dir, "myhost"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	runnertest.AssertAllUsed(t, fake)
+
+	b, err := os.ReadFile(filepath.Join(dir, "nixos.iso"))
+	if err != nil {
+		t.Fatalf("image was not copied: %s", err)
+	}
+	if string(b) != "iso" {
+		t.Errorf("copied image is '%s' but 'iso' was expected", b)
+	}
+}
+
+func TestImageUnsupported(t *testing.T) {
+	fake := runner.NewFake(
+		runner.Response{
+			Name:   "nix",
+			Args:   []string{"eval", "-f", "nilla.nix", "systems.nixos.myhost.result.config.system.build"},
+			Stdout: `["toplevel","vm"]`,
+		},
+	)
+
+	if err := runApp(t, fake, elevate.MethodSudo, "image", "--format", "qcow2", "myhost"); err == nil {
+		t.Fatal("expected an error for an unsupported image format")
+	}
+
+	if calls := fake.Calls(); len(calls) != 1 {
+		t.Errorf("expected only 1 command to run but %d were run", len(calls))
+	}
+}
@@ -1,12 +1,22 @@
 package os
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
 
+	"github.com/arnarg/lila/internal/elevate"
+	"github.com/arnarg/lila/internal/flags"
 	"github.com/arnarg/lila/internal/nix"
+	"github.com/arnarg/lila/internal/nixos"
+	"github.com/arnarg/lila/internal/runner"
+	"github.com/arnarg/lila/internal/store"
 	"github.com/arnarg/lila/internal/tui"
 	"github.com/urfave/cli/v2"
 )
@@ -20,8 +30,27 @@ const (
 	subCmdSwitch
 )
 
+// confirmation returns the question asked before applying the
+// configuration with --ask and the message printed when the
+// answer is no.
+func (sc subCmd) confirmation() (string, string) {
+	switch sc {
+	case subCmdBoot:
+		return "Make it the boot default?", "Not setting the boot default"
+	case subCmdSwitch:
+		return "Activate and make it the boot default?", "Not switching to configuration"
+	default:
+		return "Activate?", "Not activating configuration"
+	}
+}
+
 const SYSTEM_PROFILE = "/nix/var/nix/profiles/system"
 const CURRENT_PROFILE = "/run/current-system"
+const SPECIALISATION_FILE = "/etc/specialisation"
+
+// currentSystem is the running configuration that changes are
+// compared against, replaced in tests.
+var currentSystem = CURRENT_PROFILE
 
 var Command = &cli.Command{
 	Name:        "os",
@@ -62,6 +91,22 @@ var Command = &cli.Command{
 			Description: "Build NixOS configuration and activate it",
 			Args:        true,
 			ArgsUsage:   "[system name]",
+			Flags: append(
+				flags.Activation(),
+				&cli.BoolFlag{
+					Name:  "json",
+					Usage: "Print a report of unit changes as JSON on stdout",
+				},
+				&cli.StringFlag{
+					Name:    "specialisation",
+					Aliases: []string{"s"},
+					Usage:   "Activate the specialisation `NAME`, defaults to the currently active one",
+				},
+				&cli.BoolFlag{
+					Name:  "no-specialisation",
+					Usage: "Activate the base configuration, even if a specialisation is active",
+				},
+			),
 			Action: func(ctx *cli.Context) error {
 				return run(ctx, subCmdTest)
 			},
@@ -74,6 +119,7 @@ var Command = &cli.Command{
 			Description: "Build NixOS configuration and make it the boot default",
 			Args:        true,
 			ArgsUsage:   "[system name]",
+			Flags:       []cli.Flag{flags.Ask()},
 			Action: func(ctx *cli.Context) error {
 				return run(ctx, subCmdBoot)
 			},
@@ -86,10 +132,115 @@ var Command = &cli.Command{
 			Description: "Build NixOS configuration, activate it and make it the boot default",
 			Args:        true,
 			ArgsUsage:   "[system name]",
+			Flags: append(
+				flags.Activation(),
+				&cli.BoolFlag{
+					Name:  "json",
+					Usage: "Print a report of unit changes as JSON on stdout",
+				},
+				&cli.StringFlag{
+					Name:    "specialisation",
+					Aliases: []string{"s"},
+					Usage:   "Activate the specialisation `NAME`, defaults to the currently active one",
+				},
+				&cli.BoolFlag{
+					Name:  "no-specialisation",
+					Usage: "Activate the base configuration, even if a specialisation is active",
+				},
+				&cli.StringSliceFlag{
+					Name:  "hosts",
+					Usage: "Deploy to the NixOS systems `NAMES` over SSH",
+				},
+				&cli.BoolFlag{
+					Name:  "all",
+					Usage: "Deploy to all NixOS systems of the project over SSH",
+				},
+				&cli.StringSliceFlag{
+					Name:  "tag",
+					Usage: "Deploy to the NixOS systems tagged with `TAG` over SSH",
+				},
+				&cli.IntFlag{
+					Name:    "parallel",
+					Aliases: []string{"j"},
+					Usage:   "Deploy to at most `N` hosts at a time",
+					Value:   4,
+				},
+				&cli.BoolFlag{
+					Name:  "magic-rollback",
+					Usage: "Roll hosts back unless they can be reached after activation",
+					Value: true,
+				},
+				&cli.DurationFlag{
+					Name:  "confirm-timeout",
+					Usage: "Roll hosts back if they can't be reached within `DURATION` of activation",
+					Value: 30 * time.Second,
+				},
+			),
 			Action: func(ctx *cli.Context) error {
+				if isDeploy(ctx) {
+					return deploy(ctx)
+				}
 				return run(ctx, subCmdSwitch)
 			},
 		},
+
+		// VM
+		{
+			Name:        "vm",
+			Usage:       "Build NixOS configuration as a VM and run it",
+			Description: "Build a QEMU VM of the NixOS configuration and boot into it",
+			Args:        true,
+			ArgsUsage:   "[system name]",
+			Flags: []cli.Flag{
+				&cli.BoolFlag{
+					Name:  "with-bootloader",
+					Usage: "Boot the VM through the configured bootloader",
+				},
+				&cli.IntFlag{
+					Name:    "memory",
+					Aliases: []string{"m"},
+					Usage:   "Memory of the VM in `MiB`, defaults to the configured size",
+				},
+				&cli.StringSliceFlag{
+					Name:    "forward",
+					Aliases: []string{"p"},
+					Usage:   "Forward the host port to the guest port, in the form `HOST:GUEST`",
+				},
+			},
+			Action: vm,
+		},
+
+		// Image
+		{
+			Name:        "image",
+			Usage:       "Build a disk or installer image of NixOS configuration",
+			Description: "Build a disk or installer image of NixOS configuration and copy it to a directory",
+			Args:        true,
+			ArgsUsage:   "[system name]",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:    "format",
+					Aliases: []string{"f"},
+					Usage:   "Image `FORMAT`, one of iso, qcow2, raw or sd-card",
+					Value:   "iso",
+				},
+				&cli.StringFlag{
+					Name:    "output",
+					Aliases: []string{"o"},
+					Usage:   "Copy the image to `DIR`",
+					Value:   ".",
+				},
+			},
+			Action: image,
+		},
+
+		// Generations
+		{
+			Name:        "generations",
+			Usage:       "List NixOS generations",
+			Description: "List NixOS generations and their specialisations",
+			Action:      generations,
+		},
 	},
 }
 
@@ -118,11 +269,19 @@ func run(ctx *cli.Context, sc subCmd) error {
 	// Attribute of NixOS configuration's toplevel
 	attr := fmt.Sprintf("systems.nixos.%s.result.config.system.build.toplevel", name)
 
+	// Find out which specialisation to activate, if any
+	spec := ""
+	if sc == subCmdTest || sc == subCmdSwitch {
+		if spec, err = resolveSpecialisation(ctx, name); err != nil {
+			return err
+		}
+	}
+
 	//
 	// NixOS configuration build
 	//
-	// Build args for nix build
-	nargs := []string{"-f", "nilla.nix", attr}
+	// Extra args for nix build
+	nargs := []string{}
 
 	// Add extra args depending on the sub command
 	if sc == subCmdBuild {
@@ -138,47 +297,92 @@ func run(ctx *cli.Context, sc subCmd) error {
 		nargs = append(nargs, "--no-link")
 	}
 
+	// Authenticate for privilege escalation before the
+	// build, so that activation doesn't stall on a
+	// password prompt
+	if sc != subCmdBuild {
+		stop, err := elevate.Authenticate(ctx.Context)
+		if err != nil {
+			return err
+		}
+		defer stop()
+	}
+
 	// Run nix build
 	printSection("Building configuration")
-	out, err := nix.Command("build").
-		Args(nargs).
-		Reporter(tui.NewBuildReporter(ctx.Bool("verbose"))).
-		Run(context.Background())
+	out, err := tui.BuildAttrs(
+		ctx.Context, []string{attr}, nargs,
+		tui.NewBuildReporter(ctx.Bool("verbose")).
+			SummaryFile(ctx.String("summary-file")),
+	)
 	if err != nil {
 		return err
 	}
 
 	//
-	// Run generation diff using nvd
+	// Compare the closures of the current and new configuration
 	//
 	fmt.Fprintln(os.Stderr)
 	printSection("Comparing changes")
 
-	// Run nvd diff
-	diff := exec.Command("nvd", "diff", CURRENT_PROFILE, string(out))
-	diff.Stderr = os.Stderr
-	diff.Stdout = os.Stderr
-	if err := diff.Run(); err != nil {
+	// The configuration to activate
+	target := string(out)
+	if spec != "" {
+		target = filepath.Join(target, "specialisation", spec)
+	}
+
+	if err := diffClosures(ctx.Context, currentSystem, target); err != nil {
 		return err
 	}
 
+	//
+	// Show what would change on activation
+	//
+	if ctx.Bool("dry-activate") {
+		fmt.Fprintln(os.Stderr)
+		printSection("Dry activating configuration")
+
+		report, err := activate(ctx, target, "dry-activate")
+		if err != nil {
+			return activationError(report, err)
+		}
+		return nil
+	}
+
+	//
+	// Ask for confirmation
+	//
+	if ctx.Bool("ask") {
+		fmt.Fprintln(os.Stderr)
+		question, declined := sc.confirmation()
+		ok, err := tui.Confirm(ctx.App.Reader, os.Stderr, question)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			fmt.Fprintln(os.Stderr, declined)
+			return nil
+		}
+	}
+
 	//
 	// Activate NixOS configuration
 	//
+	var aerr error
 	if sc == subCmdTest || sc == subCmdSwitch {
 		fmt.Fprintln(os.Stderr)
 		printSection("Activating configuration")
 
 		// Run switch_to_configuration
-		switchp := fmt.Sprintf("%s/bin/switch-to-configuration", out)
-		switchc := exec.Command("sudo", switchp, "test")
-		switchc.Stderr = os.Stderr
-		switchc.Stdout = os.Stdout
+		report, err := activate(ctx, target, "test")
+		if err != nil || len(report.Failed) > 0 {
+			aerr = activationError(report, err)
+		}
 
-		// This error should be ignored during switch so that
+		// This error should be deferred during switch so that
 		// it can continue onto setting up the bootloader below
-		if err := switchc.Run(); err != nil && sc != subCmdSwitch {
-			return err
+		if aerr != nil && sc != subCmdSwitch {
+			return aerr
 		}
 	}
 
@@ -194,7 +398,7 @@ func run(ctx *cli.Context, sc subCmd) error {
 				string(out),
 			}).
 			Privileged(true).
-			Run(context.Background())
+			Run(ctx.Context)
 		if err != nil {
 			return err
 		}
@@ -203,13 +407,170 @@ func run(ctx *cli.Context, sc subCmd) error {
 		printSection("Adding configuration to bootloader")
 
 		// Run switch_to_configuration
-		switchp := fmt.Sprintf("%s/bin/switch-to-configuration", out)
-		switchc := exec.Command("sudo", switchp, "boot")
-		switchc.Stderr = os.Stderr
-		switchc.Stdout = os.Stdout
+		err = switchToConfiguration(ctx.Context, string(out), "boot", activationStdout(ctx), os.Stderr)
+		if err != nil {
+			return err
+		}
+	}
+
+	return aerr
+}
+
+// currentSpecialisation returns the name of the currently
+// active specialisation, or an empty string if none is.
+func currentSpecialisation() string {
+	// NixOS writes the name of the specialisation to /etc
+	if b, err := os.ReadFile(SPECIALISATION_FILE); err == nil {
+		return strings.TrimSpace(string(b))
+	}
+
+	// Otherwise compare the current system with the
+	// specialisations of the system profile
+	current, err := filepath.EvalSymlinks(CURRENT_PROFILE)
+	if err != nil {
+		return ""
+	}
+
+	dir := filepath.Join(SYSTEM_PROFILE, "specialisation")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+
+	for _, e := range entries {
+		target, err := filepath.EvalSymlinks(filepath.Join(dir, e.Name()))
+		if err == nil && target == current {
+			return e.Name()
+		}
+	}
+
+	return ""
+}
+
+// resolveSpecialisation returns the specialisation to activate,
+// which is the one requested or the currently active one.
+func resolveSpecialisation(ctx *cli.Context, name string) (string, error) {
+	if ctx.Bool("no-specialisation") {
+		return "", nil
+	}
+
+	spec := ctx.String("specialisation")
+	requested := spec != ""
+	if !requested {
+		if spec = currentSpecialisation(); spec == "" {
+			return "", nil
+		}
+	}
+
+	specs, err := nix.ListSpecialisations(ctx.Context, fmt.Sprintf("systems.nixos.%s.result.config", name))
+	if err != nil {
+		return "", err
+	}
+
+	if !slices.Contains(specs, spec) {
+		if requested {
+			return "", fmt.Errorf(
+				"specialisation %q not found, available specialisations: %s",
+				spec, strings.Join(specs, ", "),
+			)
+		}
 
-		return switchc.Run()
+		fmt.Fprintf(os.Stderr, "Active specialisation %q no longer exists, activating base configuration\n", spec)
+		return "", nil
 	}
 
+	if !requested {
+		fmt.Fprintf(os.Stderr, "Staying on active specialisation %q\n", spec)
+	}
+
+	return spec, nil
+}
+
+// switchToConfiguration runs switch-to-configuration of the
+// toplevel with elevated privileges.
+func switchToConfiguration(ctx context.Context, toplevel, action string, stdout, stderr io.Writer) error {
+	switchp := fmt.Sprintf("%s/bin/switch-to-configuration", toplevel)
+	switchc, err := elevate.Command(ctx, runner.Cmd{
+		Name:   switchp,
+		Args:   []string{action},
+		Stdout: stdout,
+		Stderr: stderr,
+	})
+	if err != nil {
+		return err
+	}
+
+	return runner.Run(ctx, switchc)
+}
+
+// diffClosures prints how the closure of the configuration to
+// activate differs from the current one.
+func diffClosures(ctx context.Context, current, target string) error {
+	s, err := store.Open(ctx)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	diff, err := store.DiffClosures(ctx, s, current, target)
+	if err != nil {
+		return err
+	}
+
+	tui.PrintClosureDiff(os.Stderr, diff)
 	return nil
 }
+
+// activationStdout returns where the output of
+// switch-to-configuration goes, which is stderr when stdout is
+// reserved for the JSON report.
+func activationStdout(ctx *cli.Context) io.Writer {
+	if ctx.Bool("json") {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// activate runs switch-to-configuration with an action that
+// changes systemd units, and reports on the changes.
+func activate(ctx *cli.Context, toplevel, action string) (*nixos.ActivationReport, error) {
+	// Unit changes are reported on stderr
+	b := &bytes.Buffer{}
+	err := switchToConfiguration(
+		ctx.Context, toplevel, action,
+		activationStdout(ctx), io.MultiWriter(os.Stderr, b),
+	)
+
+	report, perr := nixos.ParseActivation(b)
+	if perr != nil {
+		return nil, perr
+	}
+
+	if ctx.Bool("json") {
+		if jerr := report.WriteJSON(os.Stdout); jerr != nil {
+			return nil, jerr
+		}
+	} else {
+		fmt.Fprintln(os.Stderr)
+		printSection("Unit changes")
+		report.Print(os.Stderr)
+	}
+
+	return report, err
+}
+
+// activationError creates an error listing the units that failed
+// during activation.
+func activationError(report *nixos.ActivationReport, err error) error {
+	if report != nil && len(report.Failed) > 0 {
+		return fmt.Errorf(
+			"activation failed, the following units failed: %s",
+			strings.Join(report.Failed, ", "),
+		)
+	}
+	return fmt.Errorf("activation failed: %w", err)
+}
+
+func generations(ctx *cli.Context) error {
+	return nix.PrintGenerations(os.Stdout, SYSTEM_PROFILE)
+}
@@ -0,0 +1,365 @@
+package os
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/arnarg/lila/internal/elevate"
+	"github.com/arnarg/lila/internal/nixos"
+	"github.com/arnarg/lila/internal/runner"
+	"github.com/arnarg/lila/internal/runner/runnertest"
+	"github.com/arnarg/lila/internal/store"
+)
+
+func runApp(t *testing.T, fake *runner.Fake, method elevate.Method, args ...string) error {
+	t.Helper()
+	return runAppWithInput(t, fake, method, "", args...)
+}
+
+func runAppWithInput(t *testing.T, fake *runner.Fake, method elevate.Method, input string, args ...string) error {
+	t.Helper()
+
+	setupCurrentSystem(t)
+	ctx := store.WithStore(elevate.WithMethod(context.Background(), method), testStore())
+
+	return runnertest.RunWithInput(t, ctx, fake, input, Command, args...)
+}
+
+// setupCurrentSystem makes testCurrent the running configuration.
+func setupCurrentSystem(t *testing.T) {
+	t.Helper()
+
+	link := filepath.Join(t.TempDir(), "current-system")
+	if err := os.Symlink(testCurrent, link); err != nil {
+		t.Fatal(err)
+	}
+
+	currentSystem = link
+	t.Cleanup(func() { currentSystem = CURRENT_PROFILE })
+}
+
+// testStore has the closures of the current and new configuration.
+func testStore() *store.Fake {
+	return store.NewFake(
+		&store.PathInfo{Path: testCurrent, NarSize: 100, References: []string{testGlibcOld}},
+		&store.PathInfo{Path: testToplevel, NarSize: 100, References: []string{testGlibc}},
+		&store.PathInfo{Path: testGlibcOld, NarSize: 1000},
+		&store.PathInfo{Path: testGlibc, NarSize: 1100},
+	)
+}
+
+const (
+	testToplevel = "/nix/store/aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa-nixos-system-myhost-25.05"
+	testSwitch   = testToplevel + "/bin/switch-to-configuration"
+	testDrv      = "/nix/store/bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb-nixos-system-myhost-25.05.drv"
+	testCurrent  = "/nix/store/ffffffffffffffffffffffffffffffff-nixos-system-myhost-25.05"
+	testGlibcOld = "/nix/store/gggggggggggggggggggggggggggggggg-glibc-2.39"
+	testGlibc    = "/nix/store/hhhhhhhhhhhhhhhhhhhhhhhhhhhhhhhh-glibc-2.40"
+)
+
+// testEval is the evaluation of the toplevel's derivation, which
+// is built with testDrv + "^*"
+var testEval = runner.Response{
+	Name:   "nix",
+	Args:   []string{"eval", "-f", "nilla.nix", "systems.nixos.myhost.result.config.system.build.toplevel.drvPath", "--raw"},
+	Stdout: testDrv + "\n",
+}
+
+const testBuildLog = `@nix {"action":"start","id":1,"level":0,"parent":0,"text":"","type":104}
+@nix {"action":"result","id":1,"type":105,"fields":[0,1,1,0]}
+@nix {"action":"start","id":2,"level":3,"parent":1,"text":"building","type":105,"fields":["/nix/store/bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb-nixos-system-myhost-25.05.drv","",1,1]}
+@nix {"action":"stop","id":2}
+@nix {"action":"result","id":1,"type":105,"fields":[1,1,0,0]}
+@nix {"action":"stop","id":1}
+`
+
+func TestSwitch(t *testing.T) {
+	fake := runner.NewFake(
+		runner.Response{
+			Name: "sudo",
+			Args: []string{"-v"},
+		},
+		testEval,
+		runner.Response{
+			Name: "nix",
+			Args: []string{
+				"build", "--print-out-paths",
+				testDrv + "^*", "--no-link",
+			},
+			Stdout: testToplevel + "\n",
+			Stderr: testBuildLog,
+		},
+		runner.Response{
+			Name: "sudo",
+			Args: []string{testSwitch, "test"},
+		},
+		runner.Response{
+			Name: "sudo",
+			Args: []string{
+				"nix", "build", "--print-out-paths",
+				"--no-link", "--profile", SYSTEM_PROFILE, testToplevel,
+			},
+		},
+		runner.Response{
+			Name: "sudo",
+			Args: []string{testSwitch, "boot"},
+		},
+	)
+
+	if err := runApp(t, fake, elevate.MethodSudo, "switch", "myhost"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	runnertest.AssertAllUsed(t, fake)
+}
+
+func TestBuildFailure(t *testing.T) {
+	fake := runner.NewFake(
+		runner.Response{
+			Name: "sudo",
+			Args: []string{"-v"},
+		},
+		runner.Response{
+			Name:     "nix",
+			Args:     []string{"eval"},
+			Stderr:   `@nix {"action":"msg","level":0,"msg":"error: attribute 'myhost' missing"}` + "\n",
+			ExitCode: 1,
+		},
+	)
+
+	err := runApp(t, fake, elevate.MethodSudo, "switch", "myhost")
+	if err == nil || err.Error() != "error: attribute 'myhost' missing" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Nothing should be activated
+	if calls := fake.Calls(); len(calls) != 2 {
+		t.Errorf("expected only 2 commands to run but %d were run", len(calls))
+	}
+}
+
+func TestSwitchAsRoot(t *testing.T) {
+	fake := runner.NewFake(
+		testEval,
+		runner.Response{
+			Name:   "nix",
+			Args:   []string{"build"},
+			Stdout: testToplevel + "\n",
+		},
+		runner.Response{
+			Name: testSwitch,
+			Args: []string{"test"},
+		},
+		runner.Response{
+			Name: "nix",
+			Args: []string{
+				"build", "--print-out-paths",
+				"--no-link", "--profile", SYSTEM_PROFILE, testToplevel,
+			},
+		},
+		runner.Response{
+			Name: testSwitch,
+			Args: []string{"boot"},
+		},
+	)
+
+	if err := runApp(t, fake, elevate.MethodNone, "switch", "myhost"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	runnertest.AssertAllUsed(t, fake)
+}
+
+func TestSwitchAskDeclined(t *testing.T) {
+	fake := runner.NewFake(
+		runner.Response{
+			Name: "sudo",
+			Args: []string{"-v"},
+		},
+		testEval,
+		runner.Response{
+			Name:   "nix",
+			Args:   []string{"build"},
+			Stdout: testToplevel + "\n",
+		},
+	)
+
+	err := runAppWithInput(t, fake, elevate.MethodSudo, "n\n", "switch", "--ask", "myhost")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	runnertest.AssertAllUsed(t, fake)
+
+	// Nothing should be activated
+	if calls := fake.Calls(); len(calls) != 3 {
+		t.Errorf("expected only 3 commands to run but %d were run", len(calls))
+	}
+}
+
+func TestSwitchDryActivate(t *testing.T) {
+	fake := runner.NewFake(
+		runner.Response{
+			Name: "sudo",
+			Args: []string{"-v"},
+		},
+		testEval,
+		runner.Response{
+			Name:   "nix",
+			Args:   []string{"build"},
+			Stdout: testToplevel + "\n",
+		},
+		runner.Response{
+			Name: "sudo",
+			Args: []string{testSwitch, "dry-activate"},
+		},
+	)
+
+	if err := runApp(t, fake, elevate.MethodSudo, "switch", "--dry-activate", "myhost"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	runnertest.AssertAllUsed(t, fake)
+
+	if calls := fake.Calls(); len(calls) != 4 {
+		t.Errorf("expected only 4 commands to run but %d were run", len(calls))
+	}
+}
+
+func TestSwitchFailedUnits(t *testing.T) {
+	fake := runner.NewFake(
+		runner.Response{
+			Name: "sudo",
+			Args: []string{"-v"},
+		},
+		testEval,
+		runner.Response{
+			Name:   "nix",
+			Args:   []string{"build"},
+			Stdout: testToplevel + "\n",
+		},
+		runner.Response{
+			Name:     "sudo",
+			Args:     []string{testSwitch, "test"},
+			Stderr:   "restarting the following units: nginx.service\nwarning: the following units failed: nginx.service\n",
+			ExitCode: 4,
+		},
+		runner.Response{
+			Name: "sudo",
+			Args: []string{"nix", "build", "--print-out-paths", "--no-link", "--profile", SYSTEM_PROFILE},
+		},
+		runner.Response{
+			Name: "sudo",
+			Args: []string{testSwitch, "boot"},
+		},
+	)
+
+	err := runApp(t, fake, elevate.MethodSudo, "switch", "myhost")
+	if err == nil || err.Error() != "activation failed, the following units failed: nginx.service" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Bootloader should still be set up
+	runnertest.AssertAllUsed(t, fake)
+}
+
+func TestTestSpecialisation(t *testing.T) {
+	specSwitch := testToplevel + "/specialisation/work/bin/switch-to-configuration"
+
+	fake := runner.NewFake(
+		runner.Response{
+			Name:   "nix",
+			Args:   []string{"eval", "-f", "nilla.nix", "systems.nixos.myhost.result.config.specialisation"},
+			Stdout: `["gaming","work"]`,
+		},
+		runner.Response{
+			Name: "sudo",
+			Args: []string{"-v"},
+		},
+		testEval,
+		runner.Response{
+			Name:   "nix",
+			Args:   []string{"build"},
+			Stdout: testToplevel + "\n",
+		},
+		runner.Response{
+			Name: "sudo",
+			Args: []string{specSwitch, "test"},
+		},
+	)
+
+	if err := runApp(t, fake, elevate.MethodSudo, "test", "--specialisation", "work", "myhost"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	runnertest.AssertAllUsed(t, fake)
+}
+
+func TestSwitchSpecialisationNotFound(t *testing.T) {
+	fake := runner.NewFake(
+		runner.Response{
+			Name:   "nix",
+			Args:   []string{"eval", "-f", "nilla.nix", "systems.nixos.myhost.result.config.specialisation"},
+			Stdout: `["gaming"]`,
+		},
+	)
+
+	err := runApp(t, fake, elevate.MethodSudo, "switch", "--specialisation", "work", "myhost")
+	if err == nil {
+		t.Fatal("expected an error for a missing specialisation")
+	}
+
+	if calls := fake.Calls(); len(calls) != 1 {
+		t.Errorf("expected only 1 command to run but %d were run", len(calls))
+	}
+}
+
+func TestTestJSON(t *testing.T) {
+	fake := runner.NewFake(
+		runner.Response{
+			Name: "sudo",
+			Args: []string{"-v"},
+		},
+		testEval,
+		runner.Response{
+			Name:   "nix",
+			Args:   []string{"build"},
+			Stdout: testToplevel + "\n",
+		},
+		runner.Response{
+			Name:   "sudo",
+			Args:   []string{testSwitch, "test"},
+			Stdout: "setting up /etc...\n",
+			Stderr: "restarting the following units: nginx.service\n",
+		},
+	)
+
+	// Capture stdout
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	err = runApp(t, fake, elevate.MethodSudo, "test", "--json", "myhost")
+	w.Close()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	runnertest.AssertAllUsed(t, fake)
+
+	// Only the report should be printed on stdout
+	report := &nixos.ActivationReport{}
+	if err := json.NewDecoder(r).Decode(report); err != nil {
+		t.Fatalf("invalid JSON output: %s", err)
+	}
+	if len(report.Restarted) != 1 || report.Restarted[0] != "nginx.service" {
+		t.Errorf("restarted units are %v but nginx.service was expected", report.Restarted)
+	}
+}
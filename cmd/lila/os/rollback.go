@@ -0,0 +1,187 @@
+package os
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/arnarg/lila/internal/runner"
+	"github.com/arnarg/lila/internal/tui"
+)
+
+// ROLLBACK_DIR is where the activation watchdog keeps its state
+// on the target host.
+const ROLLBACK_DIR = "/run/lila"
+
+// States written by the activation watchdog.
+const (
+	watchdogActivating = "activating"
+	watchdogActivated  = "activated"
+	watchdogConfirmed  = "confirmed"
+	watchdogRolledBack = "rolled-back"
+)
+
+// pollInterval is how often the state of the activation
+// watchdog is checked.
+var pollInterval = time.Second
+
+// activationWaits is how many confirm timeouts lila waits for the
+// activation to finish and be confirmed before giving up on a host.
+const activationWaits = 10
+
+// watchdogScript activates the new generation and rolls back to
+// the previous one unless the activation is confirmed within the
+// timeout, by creating the confirm file. It runs in a transient
+// systemd unit so that it survives the SSH connection dropping.
+const watchdogScript = `set -u
+mkdir -p %[1]s
+state=%[1]s/%[2]s.state
+confirm=%[1]s/%[2]s.confirm
+
+rollback() {
+  echo "Rolling back to $3"
+  nix-env -p "$1" --set "$3"
+  "$3/bin/switch-to-configuration" switch
+  echo %[5]s > "$state"
+  rm -f "$confirm"
+  exit 1
+}
+
+echo %[7]s > "$state"
+nix-env -p "$1" --set "$2" || rollback "$@"
+"$2/bin/switch-to-configuration" switch || rollback "$@"
+
+echo %[3]s > "$state"
+i=0
+while [ "$i" -lt %[4]d ]; do
+  if [ -e "$confirm" ]; then
+    echo %[6]s > "$state"
+    rm -f "$confirm"
+    exit 0
+  fi
+  sleep 1
+  i=$((i+1))
+done
+
+rollback "$@"
+`
+
+// shellQuote quotes an argument for the remote shell, which
+// parses the command sent over SSH.
+func shellQuote(arg string) string {
+	if arg != "" && strings.Trim(arg, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789@%+=:,./-_") == "" {
+		return arg
+	}
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
+
+// remoteOutput runs a command on a host over SSH and returns
+// its output.
+func remoteOutput(ctx context.Context, h host, args ...string) ([]byte, error) {
+	out, err := runner.Output(ctx, runner.Cmd{
+		Name: "ssh",
+		Args: append([]string{"-o", "BatchMode=yes", h.destination(), "--"}, args...),
+	})
+	return bytes.TrimSpace(out), err
+}
+
+// activateWithRollback switches the host to the toplevel with a
+// watchdog on the host that rolls back to the previous generation
+// unless lila can reach the host again after activation.
+func activateWithRollback(ctx context.Context, h host, toplevel string, timeout time.Duration, updates chan<- tui.HostUpdate) error {
+	// The generation to roll back to
+	prev, err := remoteOutput(ctx, h, "readlink", "-f", SYSTEM_PROFILE)
+	if err != nil {
+		return fmt.Errorf("could not find current generation: %w", err)
+	}
+
+	unit := fmt.Sprintf("lila-activate-%d", time.Now().UnixNano())
+	secs := int(timeout.Round(time.Second) / time.Second)
+	script := fmt.Sprintf(
+		watchdogScript,
+		ROLLBACK_DIR, unit, watchdogActivated, secs, watchdogRolledBack, watchdogConfirmed,
+		watchdogActivating,
+	)
+
+	updates <- tui.HostUpdate{Host: h.Name, State: tui.HostActivating}
+
+	err = remoteRun(
+		ctx, h,
+		"systemd-run", "--unit", unit, "--collect", "--quiet", "--",
+		"sh", "-c", shellQuote(script), "sh",
+		SYSTEM_PROFILE, toplevel, string(prev),
+	)
+	if err != nil {
+		return err
+	}
+
+	// Wait for the activation to finish and confirm it. The
+	// connection may drop during activation, so only the time
+	// the host can't be reached counts towards giving up, which
+	// is after the watchdog must have rolled back. An activation
+	// that hangs is given up on after a deadline.
+	state := fmt.Sprintf("%s/%s.state", ROLLBACK_DIR, unit)
+	wait := activationWaits * timeout
+	deadline := time.Now().Add(wait)
+	confirmed := false
+	var lost, missing time.Time
+	for {
+		out, err := remoteOutput(ctx, h, "cat", state)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("activation on %s did not finish within %s", h.TargetHost, wait)
+		}
+
+		switch {
+		case isConnectionError(err):
+			if lost.IsZero() {
+				lost = time.Now()
+			}
+			if time.Since(lost) > 2*timeout {
+				return fmt.Errorf("lost connection to %s after activation, the watchdog rolls back unconfirmed activations", h.TargetHost)
+			}
+		case err != nil:
+			// The host can be reached but the watchdog hasn't
+			// written its state
+			lost = time.Time{}
+			if missing.IsZero() {
+				missing = time.Now()
+			}
+			if time.Since(missing) > timeout {
+				return fmt.Errorf("activation watchdog did not start on %s: %w", h.TargetHost, err)
+			}
+		default:
+			lost = time.Time{}
+			missing = time.Time{}
+
+			switch string(out) {
+			case watchdogActivated:
+				if !confirmed {
+					err := remoteRun(ctx, h, "touch", fmt.Sprintf("%s/%s.confirm", ROLLBACK_DIR, unit))
+					confirmed = err == nil
+				}
+			case watchdogConfirmed:
+				return nil
+			case watchdogRolledBack:
+				return fmt.Errorf("activation failed, rolled back to %s", prev)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// isConnectionError returns true if an SSH command failed to
+// connect to the host, rather than the command itself failing.
+func isConnectionError(err error) bool {
+	code, ok := runner.ExitCode(err)
+	return ok && code == 255
+}
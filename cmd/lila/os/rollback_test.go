@@ -0,0 +1,157 @@
+package os
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arnarg/lila/internal/elevate"
+	"github.com/arnarg/lila/internal/runner"
+	"github.com/arnarg/lila/internal/runner/runnertest"
+)
+
+const (
+	testWeb2     = "/nix/store/dddddddddddddddddddddddddddddddd-nixos-system-web2-25.05"
+	testWeb2Prev = "/nix/store/eeeeeeeeeeeeeeeeeeeeeeeeeeeeeeee-nixos-system-web2-25.05"
+	testWeb2Drv  = "/nix/store/ffffffffffffffffffffffffffffffff-nixos-system-web2-25.05.drv"
+)
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{input: testWeb2, expected: testWeb2},
+		{input: "", expected: "''"},
+		{input: "echo $HOME", expected: "'echo $HOME'"},
+		{input: "it's", expected: `'it'\''s'`},
+	}
+
+	for _, test := range tests {
+		if res := shellQuote(test.input); res != test.expected {
+			t.Errorf("shellQuote(\"%s\") is '%s' but '%s' was expected", test.input, res, test.expected)
+		}
+	}
+}
+
+// testStateMissing stands for the state file of the watchdog not
+// existing yet.
+const testStateMissing = "missing"
+
+// rollbackResponses returns the responses of deploying to web2
+// with magic rollback, up to the state of the watchdog after
+// activation.
+func rollbackResponses(states ...string) []runner.Response {
+	ssh := []string{"-o", "BatchMode=yes", "root@web2.example.com", "--"}
+
+	responses := []runner.Response{
+		{
+			Name:   "nix",
+			Args:   []string{"eval", "-f", "nilla.nix", "systems.nixos"},
+			Stdout: testHosts,
+		},
+		{
+			Name:   "nix",
+			Args:   []string{"eval", "-f", "nilla.nix", "systems.nixos.web2.result.config.system.build.toplevel.drvPath", "--raw"},
+			Stdout: testWeb2Drv,
+		},
+		{
+			Name:   "nix",
+			Args:   []string{"build", "--print-out-paths", testWeb2Drv + "^*"},
+			Stdout: testWeb2 + "\n",
+		},
+		{
+			Name: "nix",
+			Args: []string{"copy", "--to", "ssh-ng://root@web2.example.com"},
+		},
+		{
+			Name:   "ssh",
+			Args:   append(ssh, "readlink", "-f", SYSTEM_PROFILE),
+			Stdout: testWeb2Prev + "\n",
+		},
+		{
+			Name: "ssh",
+			Args: append(ssh, "systemd-run"),
+		},
+	}
+
+	for _, state := range states {
+		switch state {
+		case "":
+			// Connection dropped
+			responses = append(responses, runner.Response{Name: "ssh", Args: append(ssh, "cat"), ExitCode: 255})
+			continue
+		case testStateMissing:
+			responses = append(responses, runner.Response{Name: "ssh", Args: append(ssh, "cat"), ExitCode: 1})
+			continue
+		}
+
+		responses = append(responses, runner.Response{Name: "ssh", Args: append(ssh, "cat"), Stdout: state + "\n"})
+		if state == watchdogActivated {
+			responses = append(responses, runner.Response{Name: "ssh", Args: append(ssh, "touch")})
+		}
+	}
+
+	return responses
+}
+
+func TestDeployMagicRollback(t *testing.T) {
+	pollInterval = 0
+
+	fake := runner.NewFake(rollbackResponses(
+		testStateMissing, watchdogActivating, "", watchdogActivated, watchdogConfirmed,
+	)...)
+
+	if err := runApp(t, fake, elevate.MethodSudo, "switch", "--hosts", "web2"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	runnertest.AssertAllUsed(t, fake)
+
+	// The watchdog is passed the profile, the new
+	// generation and the one to roll back to
+	for _, call := range fake.Calls() {
+		if len(call.Args) > 4 && call.Args[4] == "systemd-run" {
+			args := call.Args[len(call.Args)-3:]
+			if args[0] != SYSTEM_PROFILE || args[1] != testWeb2 || args[2] != testWeb2Prev {
+				t.Errorf("watchdog arguments are '%v' but profile, new and previous generations were expected", args)
+			}
+		}
+	}
+}
+
+func TestDeployMagicRollbackRolledBack(t *testing.T) {
+	pollInterval = 0
+
+	fake := runner.NewFake(rollbackResponses(watchdogActivating, "", "", watchdogRolledBack)...)
+
+	err := runApp(t, fake, elevate.MethodSudo, "switch", "--hosts", "web2")
+	if err == nil {
+		t.Fatal("expected an error for a rolled back host")
+	}
+	if !strings.Contains(err.Error(), "web2") {
+		t.Errorf("error is '%s' but the failed host was expected", err)
+	}
+
+	runnertest.AssertAllUsed(t, fake)
+}
+
+func TestDeployMagicRollbackHung(t *testing.T) {
+	pollInterval = time.Millisecond
+
+	states := []string{}
+	for range 1000 {
+		states = append(states, watchdogActivating)
+	}
+	fake := runner.NewFake(rollbackResponses(states...)...)
+
+	err := runApp(t, fake, elevate.MethodSudo, "switch", "--hosts", "web2", "--confirm-timeout", "1ms")
+	if err == nil || !strings.Contains(err.Error(), "web2") {
+		t.Fatalf("error is '%v' but the hung host was expected to fail", err)
+	}
+
+	// Polling should have stopped at the deadline
+	if len(fake.Unused()) < 1 {
+		t.Error("expected the state of the watchdog to stop being polled")
+	}
+}
@@ -0,0 +1,127 @@
+package os
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/arnarg/lila/internal/runner"
+	"github.com/arnarg/lila/internal/tui"
+	"github.com/urfave/cli/v2"
+)
+
+// parseForward parses a port forward in the form HOST:GUEST
+// into a QEMU user networking hostfwd rule. A "/udp" suffix
+// forwards UDP instead of TCP.
+func parseForward(fwd string) (string, error) {
+	proto := "tcp"
+	if p, ok := strings.CutSuffix(fwd, "/udp"); ok {
+		proto, fwd = "udp", p
+	} else {
+		fwd = strings.TrimSuffix(fwd, "/tcp")
+	}
+
+	host, guest, ok := strings.Cut(fwd, ":")
+	if !ok {
+		return "", fmt.Errorf("invalid port forward %q, expected HOST:GUEST", fwd)
+	}
+
+	for _, port := range []string{host, guest} {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return "", fmt.Errorf("invalid port %q in port forward", port)
+		}
+	}
+
+	return fmt.Sprintf("hostfwd=%s::%s-:%s", proto, host, guest), nil
+}
+
+// findRunScript returns the script that starts the VM, which
+// is named after the host name of the system.
+func findRunScript(out string) (string, error) {
+	matches, err := filepath.Glob(filepath.Join(out, "bin", "run-*-vm"))
+	if err != nil {
+		return "", err
+	}
+	if len(matches) < 1 {
+		return "", fmt.Errorf("no VM run script found in %s", out)
+	}
+	return matches[0], nil
+}
+
+func vm(ctx *cli.Context) error {
+	// Try to infer name of the NixOS system
+	name, err := inferName(ctx.Args().First())
+	if err != nil {
+		return err
+	}
+
+	// Parse port forwards before the build, so a
+	// typo doesn't cost a full build
+	fwds := []string{}
+	for _, f := range ctx.StringSlice("forward") {
+		fwd, err := parseForward(f)
+		if err != nil {
+			return err
+		}
+		fwds = append(fwds, fwd)
+	}
+
+	// Attribute of NixOS configuration's VM
+	build := "vm"
+	if ctx.Bool("with-bootloader") {
+		build = "vmWithBootLoader"
+	}
+	attr := fmt.Sprintf("systems.nixos.%s.result.config.system.build.%s", name, build)
+
+	//
+	// NixOS VM build
+	//
+	printSection("Building VM")
+	out, err := tui.BuildAttrs(
+		ctx.Context, []string{attr}, []string{"--no-link"},
+		tui.NewBuildReporter(ctx.Bool("verbose")).
+			SummaryFile(ctx.String("summary-file")),
+	)
+	if err != nil {
+		return err
+	}
+
+	script, err := findRunScript(string(out))
+	if err != nil {
+		return err
+	}
+
+	//
+	// Run the VM
+	//
+	fmt.Fprintln(os.Stderr)
+	printSection("Running VM")
+
+	// Extra QEMU arguments are passed on to QEMU by the run
+	// script, and later arguments take precedence
+	args := []string{}
+	if mem := ctx.Int("memory"); mem > 0 {
+		args = append(args, "-m", strconv.Itoa(mem))
+	}
+
+	// Port forwards are added to the user networking
+	// options, keeping any that are already set
+	env := []string{}
+	if len(fwds) > 0 {
+		if opts := os.Getenv("QEMU_NET_OPTS"); opts != "" {
+			fwds = append([]string{opts}, fwds...)
+		}
+		env = append(env, "QEMU_NET_OPTS="+strings.Join(fwds, ","))
+	}
+
+	return runner.Run(ctx.Context, runner.Cmd{
+		Name:   script,
+		Args:   args,
+		Env:    env,
+		Stdin:  os.Stdin,
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+	})
+}
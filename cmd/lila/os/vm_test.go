@@ -0,0 +1,89 @@
+package os
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/arnarg/lila/internal/elevate"
+	"github.com/arnarg/lila/internal/runner"
+	"github.com/arnarg/lila/internal/runner/runnertest"
+)
+
+func TestParseForward(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		err      bool
+	}{
+		{input: "2222:22", expected: "hostfwd=tcp::2222-:22"},
+		{input: "8080:80/tcp", expected: "hostfwd=tcp::8080-:80"},
+		{input: "5353:53/udp", expected: "hostfwd=udp::5353-:53"},
+		{input: "2222", err: true},
+		{input: "ssh:22", err: true},
+		{input: "70000:22", err: true},
+	}
+
+	for _, test := range tests {
+		res, err := parseForward(test.input)
+		if test.err {
+			if err == nil {
+				t.Errorf("parseForward(\"%s\") was expected to fail", test.input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseForward(\"%s\") failed: %s", test.input, err)
+		}
+		if res != test.expected {
+			t.Errorf("parseForward(\"%s\") is '%s' but '%s' was expected", test.input, res, test.expected)
+		}
+	}
+}
+
+func TestVM(t *testing.T) {
+	t.Setenv("QEMU_NET_OPTS", "")
+
+	// The VM's output with its run script
+	out := t.TempDir()
+	script := filepath.Join(out, "bin", "run-myhost-vm")
+	if err := os.MkdirAll(filepath.Dir(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(script, nil, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	fake := runner.NewFake(
+		runner.Response{
+			Name:   "nix",
+			Args:   []string{"eval", "-f", "nilla.nix", "systems.nixos.myhost.result.config.system.build.vmWithBootLoader.drvPath", "--raw"},
+			Stdout: testDrv,
+		},
+		runner.Response{
+			Name:   "nix",
+			Args:   []string{"build", "--print-out-paths", testDrv + "^*"},
+			Stdout: out + "\n",
+		},
+		runner.Response{
+			Name: script,
+			Args: []string{"-m", "2048"},
+		},
+	)
+
+	err := runApp(t, fake, elevate.MethodSudo, "vm", "--with-bootloader", "-m", "2048", "-p", "2222:22", "myhost")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	runnertest.AssertAllUsed(t, fake)
+
+	calls := fake.Calls()
+	if len(calls) != 3 {
+		t.Fatalf("expected only 3 commands to run but %d were run", len(calls))
+	}
+	if !slices.Contains(calls[2].Env, "QEMU_NET_OPTS=hostfwd=tcp::2222-:22") {
+		t.Errorf("VM environment is '%v' but port forward was expected", calls[2].Env)
+	}
+}
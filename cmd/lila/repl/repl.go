@@ -0,0 +1,132 @@
+package repl
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/arnarg/lila/internal/nix"
+	"github.com/arnarg/lila/internal/runner"
+	"github.com/urfave/cli/v2"
+)
+
+var Command = &cli.Command{
+	Name:        "repl",
+	Usage:       "Start a nix repl",
+	Description: "Starts a nix repl with the attributes of a nilla project in scope",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "host",
+			Usage: "Bind `NAME` of the NixOS system to host, defaults to the hostname",
+		},
+		&cli.StringFlag{
+			Name:  "user",
+			Usage: "Bind `NAME` of the home configuration to user, defaults to $USER@hostname or $USER",
+		},
+	},
+	Action: run,
+}
+
+// replExpr is loaded into the scope of the repl. It has all
+// attributes of the project, the project itself and bindings
+// for the current system, NixOS system and home configuration.
+const replExpr = `let
+  project = import %[1]s;
+  pick = set: names: let
+    found = builtins.filter (name: set ? ${name}) names;
+  in if found == [] then null else set.${builtins.head found}.result;
+in project // {
+  inherit project;
+  system = %[2]s;
+  host = pick (project.systems.nixos or {}) [ %[3]s ];
+  user = pick (project.systems.home or {}) [ %[4]s ];
+}`
+
+// nixEscaper escapes characters that are special in nix strings,
+// where `${` starts an interpolation.
+var nixEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	`"`, `\"`,
+	`$`, `\$`,
+	"\n", `\n`,
+	"\r", `\r`,
+	"\t", `\t`,
+)
+
+// nixString formats a string as a nix string.
+func nixString(s string) string {
+	return `"` + nixEscaper.Replace(s) + `"`
+}
+
+// nixStrings formats strings as a whitespace separated list of
+// nix strings.
+func nixStrings(strs []string) string {
+	quoted := []string{}
+	for _, s := range strs {
+		quoted = append(quoted, nixString(s))
+	}
+	return strings.Join(quoted, " ")
+}
+
+// hostNames returns the candidate names of the NixOS system to
+// bind to host.
+func hostNames(name string) []string {
+	if name != "" {
+		return []string{name}
+	}
+	if hn, err := os.Hostname(); err == nil {
+		return []string{hn}
+	}
+	return []string{}
+}
+
+// userNames returns the candidate names of the home
+// configuration to bind to user, in order of preference.
+func userNames(name string) []string {
+	if name != "" {
+		return []string{name}
+	}
+
+	names := []string{}
+
+	user := os.Getenv("USER")
+	if user == "" {
+		return names
+	}
+	if hn, err := os.Hostname(); err == nil {
+		names = append(names, fmt.Sprintf("%s@%s", user, hn))
+	}
+
+	return append(names, user)
+}
+
+func run(ctx *cli.Context) error {
+	// Get current system
+	system, err := nix.CurrentSystem(ctx.Context)
+	if err != nil {
+		return err
+	}
+
+	// The project is imported from a string, which has to
+	// be an absolute path
+	path, err := filepath.Abs("nilla.nix")
+	if err != nil {
+		return err
+	}
+
+	expr := fmt.Sprintf(
+		replExpr,
+		nixString(path), nixString(system),
+		nixStrings(hostNames(ctx.String("host"))),
+		nixStrings(userNames(ctx.String("user"))),
+	)
+
+	fmt.Fprintln(os.Stderr, "Bound project attributes, project, system, host and user")
+
+	// Replace the current process with nix repl
+	return runner.FromContext(ctx.Context).Exec(runner.Cmd{
+		Name: "nix",
+		Args: []string{"repl", "--expr", expr},
+	})
+}
@@ -0,0 +1,70 @@
+package repl
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/arnarg/lila/internal/runner"
+	"github.com/urfave/cli/v2"
+)
+
+func TestRepl(t *testing.T) {
+	t.Setenv("USER", "alice")
+
+	fake := runner.NewFake(
+		runner.Response{
+			Name:   "nix",
+			Args:   []string{"eval", "--expr", "builtins.currentSystem"},
+			Stdout: "x86_64-linux",
+		},
+		runner.Response{
+			Name: "nix",
+			Args: []string{"repl", "--expr"},
+		},
+	)
+
+	app := &cli.App{
+		Name:     "lila",
+		Commands: cli.Commands{Command},
+	}
+
+	ctx := runner.WithRunner(context.Background(), fake)
+	if err := app.RunContext(ctx, []string{"lila", "repl", "--host", "laptop"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	calls := fake.Calls()
+	if len(calls) != 2 {
+		t.Fatalf("%d commands were run but 2 were expected", len(calls))
+	}
+
+	expr := calls[1].Args[2]
+	for _, expected := range []string{
+		`system = "x86_64-linux";`,
+		`host = pick (project.systems.nixos or {}) [ "laptop" ];`,
+		`"alice" ];`,
+	} {
+		if !strings.Contains(expr, expected) {
+			t.Errorf("repl expression does not contain '%s':\n%s", expected, expr)
+		}
+	}
+}
+
+func TestNixString(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{input: "/home/alice/project/nilla.nix", expected: `"/home/alice/project/nilla.nix"`},
+		{input: "/home/alice/${builtins.abort 1}/nilla.nix", expected: `"/home/alice/\${builtins.abort 1}/nilla.nix"`},
+		{input: `it's "quoted" \ here`, expected: `"it's \"quoted\" \\ here"`},
+		{input: "line\nbreak", expected: `"line\nbreak"`},
+	}
+
+	for _, test := range tests {
+		if res := nixString(test.input); res != test.expected {
+			t.Errorf("nixString(%q) is '%s' but '%s' was expected", test.input, res, test.expected)
+		}
+	}
+}
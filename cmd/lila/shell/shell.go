@@ -1,13 +1,10 @@
 package shell
 
 import (
-	"context"
 	"fmt"
-	"os"
-	"os/exec"
-	"syscall"
 
 	"github.com/arnarg/lila/internal/nix"
+	"github.com/arnarg/lila/internal/runner"
 	"github.com/arnarg/lila/internal/tui"
 	"github.com/urfave/cli/v2"
 )
@@ -41,41 +38,34 @@ func run(ctx *cli.Context) error {
 	}
 
 	// Get current system
-	system, err := nix.CurrentSystem()
+	system, err := nix.CurrentSystem(ctx.Context)
 	if err != nil {
 		return err
 	}
 
-	// Build args for nix build
-	attr := fmt.Sprintf("shells.%s.result.%s", name, system)
-	nargs := []string{
-		"-f", "nilla.nix", attr, "--no-link",
-	}
-
 	// Run nix build
-	_, err = nix.Command("build").
-		Args(nargs).
-		Reporter(tui.NewBuildReporter(ctx.Bool("verbose"))).
-		Run(context.Background())
+	attr := fmt.Sprintf("shells.%s.result.%s", name, system)
+	_, err = tui.BuildAttrs(
+		ctx.Context, []string{attr}, []string{"--no-link"},
+		tui.NewBuildReporter(ctx.Bool("verbose")).
+			SummaryFile(ctx.String("summary-file")),
+	)
 	if err != nil {
 		return err
 	}
 
 	// Create nix-shell arg list
-	sargs := []string{"nix-shell", "nilla.nix", "--attr", attr, "--quiet"}
+	sargs := []string{"nilla.nix", "--attr", attr, "--quiet"}
 
 	if ctx.String("command") != "" {
 		sargs = append(sargs, "--command", ctx.String("command"))
 	}
 
-	// Copy current environment with NIX_SOURCED_VAR set
-	senv := append(os.Environ(), fmt.Sprintf("%s=1", NIX_SOURCED_VAR))
-
-	// Find full path to nix-shell
-	spath, err := exec.LookPath("nix-shell")
-	if err != nil {
-		return err
-	}
-
-	return syscall.Exec(spath, sargs, senv)
+	// Replace the current process with nix-shell, with
+	// NIX_SOURCED_VAR set in the environment
+	return runner.FromContext(ctx.Context).Exec(runner.Cmd{
+		Name: "nix-shell",
+		Args: sargs,
+		Env:  []string{fmt.Sprintf("%s=1", NIX_SOURCED_VAR)},
+	})
 }
@@ -0,0 +1,201 @@
+package size
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/arnarg/lila/internal/nix"
+	"github.com/arnarg/lila/internal/store"
+	"github.com/arnarg/lila/internal/tui"
+	"github.com/arnarg/lila/internal/util"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/urfave/cli/v2"
+)
+
+var (
+	errNoAttr      = errors.New("no system, package or attribute path given")
+	errNegativeTop = errors.New("--top can't be negative")
+)
+
+var Command = &cli.Command{
+	Name:        "size",
+	Usage:       "Show the closure size",
+	Description: "Builds a NixOS system, home configuration, package or attribute of a nilla project and shows what its closure size is made of",
+	Args:        true,
+	ArgsUsage:   "<system-or-package|attr-path>",
+	Flags: []cli.Flag{
+		&cli.IntFlag{
+			Name:    "top",
+			Aliases: []string{"n"},
+			Usage:   "Show the `N` largest paths and packages",
+			Value:   10,
+		},
+		&cli.StringFlag{
+			Name:  "max-size",
+			Usage: "Fail if the closure is larger than `SIZE`, e.g. 2GiB",
+		},
+	},
+	Action: run,
+}
+
+func printSection(text string) {
+	fmt.Fprintf(os.Stderr, "\033[32m>\033[0m %s\n", text)
+}
+
+func fmtBytes(b uint64) string {
+	size, unit := util.ConvertBytes(int64(b))
+	return fmt.Sprintf("%.2f %s", size, unit)
+}
+
+// packageSize is the size of all paths of a package in a
+// closure, e.g. every output and version of it.
+type packageSize struct {
+	Name  string
+	Size  uint64
+	Paths int
+}
+
+// largestPaths returns the n largest paths in the closure.
+func largestPaths(closure []*store.PathInfo, n int) []*store.PathInfo {
+	paths := slices.Clone(closure)
+	slices.SortFunc(paths, func(a, b *store.PathInfo) int {
+		return cmp.Or(cmp.Compare(b.NarSize, a.NarSize), strings.Compare(a.Path, b.Path))
+	})
+	return paths[:min(n, len(paths))]
+}
+
+// largestPackages returns the n packages contributing the most
+// to the closure size.
+func largestPackages(closure []*store.PathInfo, n int) []packageSize {
+	sizes := map[string]*packageSize{}
+	for _, info := range closure {
+		name, _ := nix.ParseDrvName(nix.StoreName(info.Path))
+		if _, ok := sizes[name]; !ok {
+			sizes[name] = &packageSize{Name: name}
+		}
+		sizes[name].Size += info.NarSize
+		sizes[name].Paths++
+	}
+
+	pkgs := []packageSize{}
+	for _, p := range sizes {
+		pkgs = append(pkgs, *p)
+	}
+	slices.SortFunc(pkgs, func(a, b packageSize) int {
+		return cmp.Or(cmp.Compare(b.Size, a.Size), strings.Compare(a.Name, b.Name))
+	})
+
+	return pkgs[:min(n, len(pkgs))]
+}
+
+// printReport prints the sizes of the closure of root.
+func printReport(root string, closure []*store.PathInfo, n int) {
+	bold := lipgloss.NewStyle().Bold(true)
+	size := lipgloss.NewStyle().Foreground(lipgloss.Color("12"))
+	faint := lipgloss.NewStyle().Faint(true)
+
+	var nar uint64
+	for _, info := range closure {
+		if info.Path == root {
+			nar = info.NarSize
+		}
+	}
+
+	fmt.Printf("%s %s %s\n", bold.Render("Closure size:"), fmtBytes(store.ClosureSize(closure)), faint.Render(fmt.Sprintf("(%d paths)", len(closure))))
+	fmt.Printf("%s     %s\n", bold.Render("NAR size:"), fmtBytes(nar))
+
+	fmt.Println(bold.Render("Largest paths:"))
+	for _, info := range largestPaths(closure, n) {
+		fmt.Printf("  %s %s\n", size.Render(fmt.Sprintf("%11s", fmtBytes(info.NarSize))), nix.StoreName(info.Path))
+	}
+
+	fmt.Println(bold.Render("Largest packages:"))
+	for _, p := range largestPackages(closure, n) {
+		paths := "1 path"
+		if p.Paths > 1 {
+			paths = fmt.Sprintf("%d paths", p.Paths)
+		}
+		fmt.Printf("  %s %s %s\n", size.Render(fmt.Sprintf("%11s", fmtBytes(p.Size))), p.Name, faint.Render(fmt.Sprintf("(%s)", paths)))
+	}
+}
+
+func run(ctx *cli.Context) error {
+	name := ctx.Args().First()
+	if name == "" {
+		return errNoAttr
+	}
+
+	if ctx.Int("top") < 0 {
+		return errNegativeTop
+	}
+
+	// Parse the budget before building anything, a budget of
+	// zero is still a budget
+	checkSize := ctx.IsSet("max-size")
+	var maxSize int64
+	if checkSize {
+		var err error
+		if maxSize, err = util.ParseBytes(ctx.String("max-size")); err != nil {
+			return err
+		}
+	}
+
+	// Get current system
+	system, err := nix.CurrentSystem(ctx.Context)
+	if err != nil {
+		return err
+	}
+
+	attr, err := nix.ResolveAttr(ctx.Context, name, system)
+	if err != nil {
+		return err
+	}
+
+	printSection(fmt.Sprintf("Building %s", name))
+	out, err := tui.BuildAttrs(
+		ctx.Context, []string{attr}, []string{"--no-link"},
+		tui.NewBuildReporter(ctx.Bool("verbose")).
+			SummaryFile(ctx.String("summary-file")),
+	)
+	if err != nil {
+		return err
+	}
+
+	// Only the first output is measured
+	outs := strings.Fields(string(out))
+	if len(outs) < 1 {
+		return fmt.Errorf("no output paths were built for %s", name)
+	}
+
+	s, err := store.Open(ctx.Context)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	closure, err := store.Closure(ctx.Context, s, outs[0])
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(os.Stderr)
+	printSection(fmt.Sprintf("Closure of %s", name))
+	printReport(outs[0], closure, ctx.Int("top"))
+
+	if checkSize {
+		total := store.ClosureSize(closure)
+		if total > uint64(maxSize) {
+			return fmt.Errorf(
+				"closure of %s is %s, which exceeds the maximum size of %s",
+				name, fmtBytes(total), fmtBytes(uint64(maxSize)),
+			)
+		}
+		fmt.Fprintf(os.Stderr, "Closure is within the maximum size of %s\n", fmtBytes(uint64(maxSize)))
+	}
+
+	return nil
+}
@@ -0,0 +1,160 @@
+package size
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/arnarg/lila/internal/runner"
+	"github.com/arnarg/lila/internal/runner/runnertest"
+	"github.com/arnarg/lila/internal/store"
+	"github.com/arnarg/lila/internal/util"
+)
+
+func runApp(t *testing.T, fake *runner.Fake, s store.Store, args ...string) error {
+	t.Helper()
+	return runnertest.Run(t, store.WithStore(context.Background(), s), fake, Command, args...)
+}
+
+const (
+	testToplevel = "/nix/store/aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa-nixos-system-appliance-25.05"
+	testFirmware = "/nix/store/bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb-linux-firmware-20250108"
+	testPython   = "/nix/store/cccccccccccccccccccccccccccccccc-python3-3.12.8"
+	testPython11 = "/nix/store/dddddddddddddddddddddddddddddddd-python3-3.11.11"
+	testDrv      = "/nix/store/eeeeeeeeeeeeeeeeeeeeeeeeeeeeeeee-nixos-system-appliance-25.05.drv"
+)
+
+func testClosure() []*store.PathInfo {
+	return []*store.PathInfo{
+		{Path: testToplevel, NarSize: 10 * util.KiB, References: []string{testFirmware, testPython, testPython11}},
+		{Path: testFirmware, NarSize: 600 * util.MiB},
+		{Path: testPython, NarSize: 400 * util.MiB},
+		{Path: testPython11, NarSize: 300 * util.MiB},
+	}
+}
+
+func TestLargest(t *testing.T) {
+	paths := largestPaths(testClosure(), 2)
+	if len(paths) != 2 || paths[0].Path != testFirmware || paths[1].Path != testPython {
+		t.Errorf("largest paths are not sorted by size")
+	}
+
+	pkgs := largestPackages(testClosure(), 10)
+	expected := []packageSize{
+		{Name: "python3", Size: 700 * util.MiB, Paths: 2},
+		{Name: "linux-firmware", Size: 600 * util.MiB, Paths: 1},
+		{Name: "nixos-system-appliance", Size: 10 * util.KiB, Paths: 1},
+	}
+	if len(pkgs) != len(expected) {
+		t.Fatalf("got %d packages but %d were expected", len(pkgs), len(expected))
+	}
+	for i, p := range pkgs {
+		if p != expected[i] {
+			t.Errorf("package %d is '%v' but '%v' was expected", i, p, expected[i])
+		}
+	}
+}
+
+func TestSize(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxSize     string
+		expectError string
+	}{
+		{
+			name: "no maximum",
+		},
+		{
+			name:    "within maximum",
+			maxSize: "2GiB",
+		},
+		{
+			name:        "exceeds maximum",
+			maxSize:     "1GiB",
+			expectError: "exceeds the maximum size of 1.00 GiB",
+		},
+		{
+			name:        "zero maximum",
+			maxSize:     "0",
+			expectError: "exceeds the maximum size",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := runner.NewFake(
+				runner.Response{
+					Name:   "nix",
+					Args:   []string{"eval", "--expr", "builtins.currentSystem"},
+					Stdout: "x86_64-linux",
+				},
+				runner.Response{
+					Name:   "nix",
+					Args:   []string{"eval", "-f", "nilla.nix", "systems.nixos", "--apply", `x: x ? "appliance"`},
+					Stdout: "true",
+				},
+				runner.Response{
+					Name:   "nix",
+					Args:   []string{"eval", "-f", "nilla.nix", "systems.nixos.appliance.result.config.system.build.toplevel.drvPath", "--raw"},
+					Stdout: testDrv,
+				},
+				runner.Response{
+					Name:   "nix",
+					Args:   []string{"build", "--print-out-paths", testDrv + "^*", "--no-link"},
+					Stdout: testToplevel + "\n",
+				},
+			)
+
+			args := []string{"appliance"}
+			if test.maxSize != "" {
+				args = append([]string{"--max-size", test.maxSize}, args...)
+			}
+
+			err := runApp(t, fake, store.NewFake(testClosure()...), args...)
+			switch {
+			case test.expectError == "" && err != nil:
+				t.Fatalf("unexpected error: %s", err)
+			case test.expectError != "" && err == nil:
+				t.Fatal("expected an error but got none")
+			case test.expectError != "" && !strings.Contains(err.Error(), test.expectError):
+				t.Errorf("error is '%s' but '%s' was expected", err, test.expectError)
+			}
+
+			runnertest.AssertAllUsed(t, fake)
+		})
+	}
+}
+
+func TestSizeInvalidFlags(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{
+			name: "invalid maximum size",
+			args: []string{"--max-size", "lots"},
+		},
+		{
+			name: "empty maximum size",
+			args: []string{"--max-size", ""},
+		},
+		{
+			name: "negative top",
+			args: []string{"--top=-1"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := runner.NewFake()
+
+			if err := runApp(t, fake, store.NewFake(), append(test.args, "appliance")...); err == nil {
+				t.Fatal("expected an error for invalid flags")
+			}
+
+			if len(fake.Calls()) > 0 {
+				t.Errorf("no commands were expected to run before checking the flags")
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/arnarg/lila/internal/nix"
+	"github.com/arnarg/lila/internal/runner"
+	"github.com/arnarg/lila/internal/tui"
+	"github.com/urfave/cli/v2"
+)
+
+var errNoTestName = errors.New("no test name given")
+
+// kvmDevice is used to tell if the VMs of tests can use KVM.
+var kvmDevice = "/dev/kvm"
+
+var Command = &cli.Command{
+	Name:        "test",
+	Usage:       "Run a NixOS test",
+	Description: "Builds and runs a NixOS VM test defined as a check in a nilla project",
+	Args:        true,
+	ArgsUsage:   "<test name>",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:    "interactive",
+			Aliases: []string{"i"},
+			Usage:   "Start the interactive Python driver of the test",
+		},
+	},
+	Action: run,
+}
+
+func printSection(text string) {
+	fmt.Fprintf(os.Stderr, "\033[32m>\033[0m %s\n", text)
+}
+
+// hasDriver returns true if the check is a NixOS test with a
+// test driver.
+func hasDriver(ctx *cli.Context, attr string) (bool, error) {
+	out, err := runner.Output(ctx.Context, runner.Cmd{
+		Name:   "nix",
+		Args:   []string{"eval", "-f", "nilla.nix", attr, "--apply", "t: t ? driver"},
+		Stderr: os.Stderr,
+	})
+	if err != nil {
+		return false, err
+	}
+	return string(bytes.TrimSpace(out)) == "true", nil
+}
+
+func build(ctx *cli.Context, attr string) (string, error) {
+	out, err := tui.BuildAttrs(
+		ctx.Context, []string{attr}, []string{"--no-link"},
+		tui.NewBuildReporter(ctx.Bool("verbose")).
+			SummaryFile(ctx.String("summary-file")),
+	)
+	return strings.TrimSpace(string(out)), err
+}
+
+// runDriver runs the test driver outside of the nix sandbox.
+func runDriver(ctx *cli.Context, driver string) error {
+	return runner.Run(ctx.Context, runner.Cmd{
+		Name:   driver + "/bin/nixos-test-driver",
+		Stdin:  os.Stdin,
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+	})
+}
+
+func run(ctx *cli.Context) error {
+	name := ctx.Args().First()
+	if name == "" {
+		return errNoTestName
+	}
+
+	// Get current system
+	system, err := nix.CurrentSystem(ctx.Context)
+	if err != nil {
+		return err
+	}
+
+	// Attribute of the test
+	attr := fmt.Sprintf("checks.%s.result.%s", name, system)
+
+	ok, err := hasDriver(ctx, attr)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("check %q is not a NixOS test", name)
+	}
+
+	//
+	// Interactive test driver
+	//
+	if ctx.Bool("interactive") {
+		printSection("Building interactive test driver")
+		driver, err := build(ctx, attr+".driverInteractive")
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintln(os.Stderr)
+		printSection("Starting test driver")
+		return runDriver(ctx, driver)
+	}
+
+	//
+	// Run the test in the sandbox, which requires KVM
+	//
+	if _, err := os.Stat(kvmDevice); err == nil {
+		printSection("Running test")
+		if _, err := build(ctx, attr); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(os.Stderr, "Test %s passed\n", name)
+		return nil
+	}
+
+	//
+	// Without KVM the VMs are run with QEMU's TCG, which
+	// builders don't allow, so the driver is run directly
+	//
+	fmt.Fprintln(os.Stderr, "KVM is not available, running the test driver with QEMU TCG")
+
+	printSection("Building test driver")
+	driver, err := build(ctx, attr+".driver")
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(os.Stderr)
+	printSection("Running test")
+	if err := runDriver(ctx, driver); err != nil {
+		return fmt.Errorf("test %s failed: %w", name, err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Test %s passed\n", name)
+	return nil
+}
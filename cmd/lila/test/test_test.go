@@ -0,0 +1,182 @@
+package test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/arnarg/lila/internal/runner"
+	"github.com/arnarg/lila/internal/runner/runnertest"
+)
+
+func runApp(t *testing.T, fake *runner.Fake, args ...string) error {
+	t.Helper()
+	return runnertest.Run(t, context.Background(), fake, Command, args...)
+}
+
+const (
+	testDriver = "/nix/store/aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa-nixos-test-driver-vm"
+	testDrv    = "/nix/store/cccccccccccccccccccccccccccccccc-vm-test.drv"
+)
+
+// setKVM points kvmDevice at an existing or missing file for
+// the duration of the test.
+func setKVM(t *testing.T, available bool) {
+	t.Helper()
+
+	dev := filepath.Join(t.TempDir(), "kvm")
+	if available {
+		if err := os.WriteFile(dev, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	orig := kvmDevice
+	kvmDevice = dev
+	t.Cleanup(func() { kvmDevice = orig })
+}
+
+func testResponses(responses ...runner.Response) []runner.Response {
+	return append([]runner.Response{
+		{
+			Name:   "nix",
+			Args:   []string{"eval", "--expr", "builtins.currentSystem"},
+			Stdout: "x86_64-linux",
+		},
+		{
+			Name:   "nix",
+			Args:   []string{"eval", "-f", "nilla.nix", "checks.vm.result.x86_64-linux", "--apply", "t: t ? driver"},
+			Stdout: "true",
+		},
+	}, responses...)
+}
+
+func TestTest(t *testing.T) {
+	tests := []struct {
+		name        string
+		kvm         bool
+		args        []string
+		responses   []runner.Response
+		expectError bool
+	}{
+		{
+			name: "with kvm",
+			kvm:  true,
+			args: []string{"vm"},
+			responses: []runner.Response{
+				{
+					Name:   "nix",
+					Args:   []string{"eval", "-f", "nilla.nix", "checks.vm.result.x86_64-linux.drvPath", "--raw"},
+					Stdout: testDrv,
+				},
+				{
+					Name:   "nix",
+					Args:   []string{"build", "--print-out-paths", testDrv + "^*", "--no-link"},
+					Stdout: "/nix/store/bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb-vm-test-run-vm\n",
+				},
+			},
+		},
+		{
+			name: "without kvm",
+			kvm:  false,
+			args: []string{"vm"},
+			responses: []runner.Response{
+				{
+					Name:   "nix",
+					Args:   []string{"eval", "-f", "nilla.nix", "checks.vm.result.x86_64-linux.driver.drvPath", "--raw"},
+					Stdout: testDrv,
+				},
+				{
+					Name:   "nix",
+					Args:   []string{"build", "--print-out-paths", testDrv + "^*", "--no-link"},
+					Stdout: testDriver + "\n",
+				},
+				{
+					Name: testDriver + "/bin/nixos-test-driver",
+				},
+			},
+		},
+		{
+			name: "without kvm failing",
+			kvm:  false,
+			args: []string{"vm"},
+			responses: []runner.Response{
+				{
+					Name:   "nix",
+					Args:   []string{"eval", "-f", "nilla.nix", "checks.vm.result.x86_64-linux.driver.drvPath", "--raw"},
+					Stdout: testDrv,
+				},
+				{
+					Name:   "nix",
+					Args:   []string{"build", "--print-out-paths", testDrv + "^*", "--no-link"},
+					Stdout: testDriver + "\n",
+				},
+				{
+					Name:     testDriver + "/bin/nixos-test-driver",
+					ExitCode: 1,
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "interactive",
+			kvm:  true,
+			args: []string{"--interactive", "vm"},
+			responses: []runner.Response{
+				{
+					Name:   "nix",
+					Args:   []string{"eval", "-f", "nilla.nix", "checks.vm.result.x86_64-linux.driverInteractive.drvPath", "--raw"},
+					Stdout: testDrv,
+				},
+				{
+					Name:   "nix",
+					Args:   []string{"build", "--print-out-paths", testDrv + "^*", "--no-link"},
+					Stdout: testDriver + "\n",
+				},
+				{
+					Name: testDriver + "/bin/nixos-test-driver",
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setKVM(t, test.kvm)
+
+			fake := runner.NewFake(testResponses(test.responses...)...)
+
+			err := runApp(t, fake, test.args...)
+			if test.expectError && err == nil {
+				t.Fatal("expected an error but got none")
+			}
+			if !test.expectError && err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			runnertest.AssertAllUsed(t, fake)
+		})
+	}
+}
+
+func TestTestNotNixOSTest(t *testing.T) {
+	fake := runner.NewFake(
+		runner.Response{
+			Name:   "nix",
+			Args:   []string{"eval", "--expr", "builtins.currentSystem"},
+			Stdout: "x86_64-linux",
+		},
+		runner.Response{
+			Name:   "nix",
+			Args:   []string{"eval", "-f", "nilla.nix", "checks.fmt.result.x86_64-linux"},
+			Stdout: "false",
+		},
+	)
+
+	if err := runApp(t, fake, "fmt"); err == nil {
+		t.Fatal("expected an error for a check that is not a NixOS test")
+	}
+
+	runnertest.AssertAllUsed(t, fake)
+}
@@ -0,0 +1,75 @@
+package tree
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/arnarg/lila/internal/nix"
+	"github.com/arnarg/lila/internal/store"
+	"github.com/arnarg/lila/internal/tui"
+	"github.com/urfave/cli/v2"
+)
+
+var errNoAttr = errors.New("no system, package or attribute path given")
+
+var Command = &cli.Command{
+	Name:        "tree",
+	Usage:       "Browse a closure",
+	Description: "Builds a NixOS system, home configuration, package or attribute of a nilla project and browses its closure interactively",
+	Args:        true,
+	ArgsUsage:   "<system-or-package|attr-path>",
+	Action:      run,
+}
+
+func printSection(text string) {
+	fmt.Fprintf(os.Stderr, "\033[32m>\033[0m %s\n", text)
+}
+
+func run(ctx *cli.Context) error {
+	name := ctx.Args().First()
+	if name == "" {
+		return errNoAttr
+	}
+
+	// Get current system
+	system, err := nix.CurrentSystem(ctx.Context)
+	if err != nil {
+		return err
+	}
+
+	attr, err := nix.ResolveAttr(ctx.Context, name, system)
+	if err != nil {
+		return err
+	}
+
+	printSection(fmt.Sprintf("Building %s", name))
+	out, err := tui.BuildAttrs(
+		ctx.Context, []string{attr}, []string{"--no-link"},
+		tui.NewBuildReporter(ctx.Bool("verbose")).
+			SummaryFile(ctx.String("summary-file")),
+	)
+	if err != nil {
+		return err
+	}
+
+	// Only the first output is browsed
+	outs := strings.Fields(string(out))
+	if len(outs) < 1 {
+		return fmt.Errorf("no output paths were built for %s", name)
+	}
+
+	s, err := store.Open(ctx.Context)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	closure, err := store.Closure(ctx.Context, s, outs[0])
+	if err != nil {
+		return err
+	}
+
+	return tui.NewClosureBrowser(outs[0], closure).Run(ctx.Context)
+}
@@ -0,0 +1,246 @@
+package update
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/arnarg/lila/internal/nix"
+	"github.com/arnarg/lila/internal/runner"
+	"github.com/arnarg/lila/internal/store"
+	"github.com/arnarg/lila/internal/tui"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/urfave/cli/v2"
+)
+
+// systemsExpr lists the names of the NixOS and Home Manager
+// configurations of the project.
+const systemsExpr = `systems: {
+  nixos = builtins.attrNames (systems.nixos or {});
+  home = builtins.attrNames (systems.home or {});
+}`
+
+// system is a NixOS or Home Manager configuration of the project.
+type system struct {
+	kind string
+	name string
+}
+
+// attr returns the attribute of the system's toplevel.
+func (s system) attr() string {
+	if s.kind == "home" {
+		return fmt.Sprintf("systems.home.%s.result.config.home.activationPackage", s.name)
+	}
+	return fmt.Sprintf("systems.nixos.%s.result.config.system.build.toplevel", s.name)
+}
+
+func (s system) String() string {
+	return fmt.Sprintf("%s (%s)", s.name, s.kind)
+}
+
+// listSystems returns all NixOS and Home Manager configurations
+// of the project.
+func listSystems(ctx *cli.Context) ([]system, error) {
+	out, err := runner.Output(ctx.Context, runner.Cmd{
+		Name: "nix",
+		Args: []string{"eval", "-f", "nilla.nix", "systems", "--apply", systemsExpr, "--json"},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var names struct {
+		NixOS []string `json:"nixos"`
+		Home  []string `json:"home"`
+	}
+	if err := json.Unmarshal(out, &names); err != nil {
+		return nil, err
+	}
+
+	systems := []system{}
+	for _, name := range names.NixOS {
+		systems = append(systems, system{"nixos", name})
+	}
+	for _, name := range names.Home {
+		systems = append(systems, system{"home", name})
+	}
+
+	return systems, nil
+}
+
+// selectSystems returns the systems with the names, or all of them
+// if no names are given.
+func selectSystems(systems []system, names []string) ([]system, error) {
+	if len(names) < 1 {
+		return systems, nil
+	}
+
+	selected := []system{}
+	for _, name := range names {
+		found := false
+		for _, s := range systems {
+			if s.name == name {
+				selected = append(selected, s)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("system %q not found", name)
+		}
+	}
+
+	return selected, nil
+}
+
+// evalToplevels evaluates the output path of the toplevel of
+// every system, without building it.
+func evalToplevels(ctx *cli.Context, systems []system) ([]string, error) {
+	toplevels := []string{}
+	for _, s := range systems {
+		out, err := runner.Output(ctx.Context, runner.Cmd{
+			Name:   "nix",
+			Args:   []string{"eval", "-f", "nilla.nix", s.attr() + ".outPath", "--raw"},
+			Stderr: os.Stderr,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate %s: %w", s, err)
+		}
+		toplevels = append(toplevels, strings.TrimSpace(string(out)))
+	}
+
+	return toplevels, nil
+}
+
+// systemVersions returns the package versions in the closures of
+// the toplevels of the systems. Only runtime closures tell which
+// packages change, as build closures include every source and
+// build tool, so toplevels that aren't in the store yet are built
+// and a build summary is written to summaryFile if it's set.
+func systemVersions(ctx *cli.Context, st store.Store, systems []system, summaryFile string) ([]map[string][]string, error) {
+	toplevels, err := evalToplevels(ctx, systems)
+	if err != nil {
+		return nil, err
+	}
+
+	valid, err := st.QueryValidPaths(ctx.Context, toplevels)
+	if err != nil {
+		return nil, err
+	}
+
+	// All missing toplevels are built in a single nix build
+	attrs := []string{}
+	for i, s := range systems {
+		if !slices.Contains(valid, toplevels[i]) {
+			attrs = append(attrs, s.attr())
+		}
+	}
+
+	if len(attrs) > 0 {
+		_, err := tui.BuildAttrs(
+			ctx.Context, attrs, []string{"--no-link"},
+			tui.NewBuildReporter(ctx.Bool("verbose")).
+				SummaryFile(summaryFile),
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	versions := []map[string][]string{}
+	for _, toplevel := range toplevels {
+		closure, err := store.Closure(ctx.Context, st, toplevel)
+		if err != nil {
+			return nil, err
+		}
+
+		versions = append(versions, nix.Versions(store.Paths(closure)))
+	}
+
+	return versions, nil
+}
+
+// printChanges prints the package version changes of a system.
+func printChanges(s system, changes []nix.VersionChange) {
+	fmt.Fprintln(os.Stderr, lipgloss.NewStyle().Bold(true).Render(s.String()))
+
+	tui.PrintVersionChanges(os.Stderr, changes)
+}
+
+// preview evaluates the systems before and after applying the
+// updates, prints what changes, and reverts the sources file
+// unless the user keeps the updates.
+func preview(ctx *cli.Context, apply func() error) (err error) {
+	path := ctx.String("sources")
+
+	all, err := listSystems(ctx)
+	if err != nil {
+		return err
+	}
+	systems, err := selectSystems(all, ctx.StringSlice("systems"))
+	if err != nil {
+		return err
+	}
+
+	// Keep the sources file to revert to
+	orig, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	st, err := store.Open(ctx.Context)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	// Current systems are usually in the store already, and only
+	// the build of the updated systems is summarized
+	fmt.Fprintln(os.Stderr)
+	printSection("Evaluating current systems")
+	before, err := systemVersions(ctx, st, systems, "")
+	if err != nil {
+		return err
+	}
+
+	// Don't leave the project with updates that weren't kept,
+	// including when building fails or lila is interrupted
+	keep := false
+	defer func() {
+		if keep {
+			return
+		}
+		if werr := os.WriteFile(path, orig, 0o644); werr != nil && err == nil {
+			err = werr
+		}
+	}()
+
+	if err := apply(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(os.Stderr)
+	printSection("Evaluating updated systems")
+	after, err := systemVersions(ctx, st, systems, ctx.String("summary-file"))
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(os.Stderr)
+	printSection("Comparing changes")
+	for i, s := range systems {
+		printChanges(s, nix.DiffVersions(before[i], after[i]))
+	}
+
+	fmt.Fprintln(os.Stderr)
+	keep, err = tui.Confirm(ctx.App.Reader, os.Stderr, "Keep updates?")
+	if err != nil {
+		return err
+	}
+	if !keep {
+		fmt.Fprintln(os.Stderr, "Reverting updates")
+	}
+
+	return nil
+}
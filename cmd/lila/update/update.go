@@ -0,0 +1,244 @@
+package update
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/arnarg/lila/internal/nix"
+	"github.com/arnarg/lila/internal/npins"
+	"github.com/arnarg/lila/internal/tui"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/urfave/cli/v2"
+	"github.com/valyala/fastjson"
+)
+
+var errSystemsWithoutPreview = errors.New("--systems can only be used with --preview")
+
+var Command = &cli.Command{
+	Name:        "update",
+	Usage:       "Update pinned inputs",
+	Description: "Updates inputs of the nilla project pinned with npins",
+	Args:        true,
+	ArgsUsage:   "[input...]",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:    "dry-run",
+			Aliases: []string{"n"},
+			Usage:   "Show what would be updated without updating",
+		},
+		&cli.BoolFlag{
+			Name:  "preview",
+			Usage: "Show how package versions of systems change before keeping the updates",
+		},
+		&cli.StringSliceFlag{
+			Name:  "systems",
+			Usage: "Preview the NixOS and Home Manager systems `NAMES`, defaults to all",
+		},
+		&cli.StringFlag{
+			Name:  "sources",
+			Usage: "Path to the npins sources `FILE`",
+			Value: npins.DefaultSources,
+		},
+	},
+	Action: run,
+}
+
+func printSection(text string) {
+	fmt.Fprintf(os.Stderr, "\033[32m>\033[0m %s\n", text)
+}
+
+// selectPins returns the pins with the names, or all of them if
+// no names are given.
+func selectPins(srcs *npins.Sources, names []string) ([]npins.Pin, error) {
+	if len(names) < 1 {
+		return srcs.Pins(), nil
+	}
+
+	pins := []npins.Pin{}
+	for _, name := range names {
+		pin, ok := srcs.Pin(name)
+		if !ok {
+			return nil, fmt.Errorf("input %q not found", name)
+		}
+		pins = append(pins, pin)
+	}
+
+	return pins, nil
+}
+
+// fmtRevision formats the revision of a pin, with the version
+// of releases.
+func fmtRevision(pin npins.Pin) string {
+	rev := pin.Revision
+	if len(rev) > 12 {
+		rev = rev[:12]
+	}
+	if pin.Version != "" {
+		return fmt.Sprintf("%s (%s)", pin.Version, rev)
+	}
+	return rev
+}
+
+// printUpdates prints a changelog line for every updated pin.
+func printUpdates(updates []npins.Update) {
+	width := 0
+	for _, u := range updates {
+		width = max(width, len(u.New.Name))
+	}
+
+	name := lipgloss.NewStyle().Bold(true).Width(width + 2)
+	faint := lipgloss.NewStyle().Faint(true)
+
+	for _, u := range updates {
+		commits := "unknown commits"
+		switch {
+		case u.Commits == 1:
+			commits = "1 commit"
+		case u.Commits >= 0:
+			commits = fmt.Sprintf("%d commits", u.Commits)
+		}
+
+		fmt.Fprintf(
+			os.Stderr, "%s%s → %s %s\n",
+			name.Render(u.New.Name),
+			fmtRevision(u.Old), fmtRevision(u.New),
+			faint.Render(fmt.Sprintf("(%s, %s)", u.Date.Format("2006-01-02"), commits)),
+		)
+	}
+}
+
+// prefetch fetches the new revision of a pin and returns its hash.
+func prefetch(ctx *cli.Context, pin npins.Pin) (string, error) {
+	ref, err := pin.PrefetchRef()
+	if err != nil {
+		return "", err
+	}
+
+	out, err := nix.Command("flake").
+		Args([]string{"prefetch", "--json", ref}).
+		PrintOutPaths(false).
+		Reporter(
+			tui.NewFetchReporter(ctx.Bool("verbose"), fmt.Sprintf("Fetching %s...", pin.Name)),
+		).
+		Run(ctx.Context)
+	if err != nil {
+		return "", err
+	}
+
+	val, err := fastjson.ParseBytes(out)
+	if err != nil {
+		return "", err
+	}
+
+	return npins.SRIToNix32(string(val.GetStringBytes("hash")))
+}
+
+func run(ctx *cli.Context) error {
+	path := ctx.String("sources")
+
+	if ctx.IsSet("systems") && !ctx.Bool("preview") {
+		return errSystemsWithoutPreview
+	}
+
+	srcs, err := npins.Load(path)
+	if err != nil {
+		return err
+	}
+
+	pins, err := selectPins(srcs, ctx.Args().Slice())
+	if err != nil {
+		return err
+	}
+
+	dir, err := npins.DefaultCacheDir()
+	if err != nil {
+		return err
+	}
+	cache := npins.NewCache(dir)
+
+	//
+	// Find new revisions
+	//
+	printSection("Checking for updates")
+
+	updates := []npins.Update{}
+	skipped := []string{}
+	for _, pin := range pins {
+		u, err := npins.Resolve(ctx.Context, cache, pin)
+		if errors.Is(err, npins.ErrUnsupportedPin) {
+			// Inputs asked for by name must not be left as
+			// they are without an error
+			if ctx.Args().Present() {
+				return fmt.Errorf("failed to update %s: %w, update it with `npins update %s`", pin.Name, err, pin.Name)
+			}
+			fmt.Fprintf(os.Stderr, "Skipping %s: %s\n", pin.Name, err)
+			skipped = append(skipped, pin.Name)
+			continue
+		} else if err != nil {
+			return fmt.Errorf("failed to update %s: %w", pin.Name, err)
+		}
+
+		if u.Changed() {
+			updates = append(updates, u)
+		}
+	}
+
+	if len(updates) < 1 {
+		if len(skipped) > 0 {
+			fmt.Fprintf(
+				os.Stderr, "No updates found, %s can only be updated with npins\n",
+				strings.Join(skipped, ", "),
+			)
+			return nil
+		}
+		fmt.Fprintln(os.Stderr, "All inputs are up to date")
+		return nil
+	}
+
+	printUpdates(updates)
+
+	if ctx.Bool("dry-run") {
+		return nil
+	}
+
+	apply := func() error {
+		return applyUpdates(ctx, srcs, updates)
+	}
+
+	if ctx.Bool("preview") {
+		return preview(ctx, apply)
+	}
+
+	return apply()
+}
+
+// applyUpdates fetches the new revisions of the pins and writes
+// them to the sources file.
+func applyUpdates(ctx *cli.Context, srcs *npins.Sources, updates []npins.Update) error {
+	fmt.Fprintln(os.Stderr)
+	printSection("Fetching inputs")
+
+	names := []string{}
+	for _, u := range updates {
+		hash, err := prefetch(ctx, u.New)
+		if err != nil {
+			return fmt.Errorf("failed to fetch %s: %w", u.New.Name, err)
+		}
+
+		u.New.Hash = hash
+		if err := srcs.Set(u.New); err != nil {
+			return err
+		}
+		names = append(names, u.New.Name)
+	}
+
+	if err := srcs.Save(ctx.String("sources")); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Updated %s\n", strings.Join(names, ", "))
+
+	return nil
+}
@@ -0,0 +1,382 @@
+package update
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/arnarg/lila/internal/npins"
+	"github.com/arnarg/lila/internal/runner"
+	"github.com/arnarg/lila/internal/runner/runnertest"
+	"github.com/arnarg/lila/internal/store"
+)
+
+func runApp(t *testing.T, fake *runner.Fake, args ...string) error {
+	t.Helper()
+	return runAppWithInput(t, fake, "", args...)
+}
+
+func runAppWithInput(t *testing.T, fake *runner.Fake, input string, args ...string) error {
+	t.Helper()
+	return runnertest.RunWithInput(t, context.Background(), localGit{fake}, input, Command, args...)
+}
+
+const testSources = `{
+  "pins": {
+    "test": {
+      "type": "Git",
+      "repository": {
+        "type": "Git",
+        "url": "%s"
+      },
+      "branch": "main",
+      "submodules": false,
+      "revision": "%s",
+      "url": null,
+      "hash": "1mdwyjz43nnh7gfq4rc54kql6fy65hw17w0p4gwklnfqciwrkax2"
+    }
+  },
+  "version": 5
+}
+`
+
+// localGit runs git commands locally, so that pins can use local
+// git repositories, and everything else with the fake.
+type localGit struct {
+	*runner.Fake
+}
+
+func (r localGit) Run(ctx context.Context, cmd runner.Cmd) error {
+	if cmd.Name == "git" {
+		return runner.Local{}.Run(ctx, cmd)
+	}
+	return r.Fake.Run(ctx, cmd)
+}
+
+// setupProject creates a git repository with two commits and a
+// sources file pinning the first, and returns the path of the
+// sources file and both revisions.
+func setupProject(t *testing.T) (string, string, string) {
+	t.Helper()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("GIT_AUTHOR_NAME", "lila")
+	t.Setenv("GIT_AUTHOR_EMAIL", "lila@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "lila")
+	t.Setenv("GIT_COMMITTER_EMAIL", "lila@example.com")
+
+	repo := t.TempDir()
+	git := func(args ...string) string {
+		out, err := exec.Command("git", append([]string{"-C", repo}, args...)...).CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s failed: %s\n%s", strings.Join(args, " "), err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+
+	git("init", "--quiet", "--initial-branch", "main")
+	git("commit", "--quiet", "--allow-empty", "-m", "first")
+	old := git("rev-parse", "HEAD")
+	git("commit", "--quiet", "--allow-empty", "-m", "second")
+	latest := git("rev-parse", "HEAD")
+
+	path := filepath.Join(t.TempDir(), "sources.json")
+	if err := os.WriteFile(path, []byte(fmt.Sprintf(testSources, repo, old)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path, old, latest
+}
+
+func TestUpdate(t *testing.T) {
+	path, _, latest := setupProject(t)
+
+	fake := runner.NewFake(
+		runner.Response{
+			Name:   "nix",
+			Args:   []string{"flake", "prefetch", "--json"},
+			Stdout: `{"hash":"sha256-47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=","locked":{},"original":{},"storePath":"/nix/store/x"}`,
+		},
+	)
+
+	if err := runApp(t, fake, "--sources", path); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for _, res := range fake.Unused() {
+		t.Errorf("expected command was never run: %s", runner.FormatCmd(runner.Cmd{Name: res.Name, Args: res.Args}))
+	}
+
+	srcs, err := npins.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pin, _ := srcs.Pin("test")
+
+	if pin.Revision != latest {
+		t.Errorf("revision is '%s' but '%s' was expected", pin.Revision, latest)
+	}
+	if pin.Hash != "0mdqa9w1p6cmli6976v4wi0sw9r4p5prkj7lzfd1877wk11c9c73" {
+		t.Errorf("hash is '%s' but the prefetched hash was expected", pin.Hash)
+	}
+}
+
+func TestUpdateDryRun(t *testing.T) {
+	path, old, _ := setupProject(t)
+
+	fake := runner.NewFake()
+
+	if err := runApp(t, fake, "--sources", path, "--dry-run", "test"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if calls := fake.Calls(); len(calls) != 0 {
+		t.Errorf("expected nix not to run but %d commands were run", len(calls))
+	}
+
+	srcs, err := npins.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pin, _ := srcs.Pin("test"); pin.Revision != old {
+		t.Errorf("revision is '%s' but '%s' was expected", pin.Revision, old)
+	}
+}
+
+func TestUpdateUnknownInput(t *testing.T) {
+	path, _, _ := setupProject(t)
+
+	if err := runApp(t, runner.NewFake(), "--sources", path, "nixpkgs"); err == nil {
+		t.Fatal("expected an error for an unknown input")
+	}
+}
+
+const testChannelSources = `{
+  "pins": {
+    "nixpkgs": {
+      "type": "Channel",
+      "name": "nixos-unstable",
+      "url": "https://releases.nixos.org/nixos/unstable/nixos-25.11pre1/nixexprs.tar.xz",
+      "hash": "1mdwyjz43nnh7gfq4rc54kql6fy65hw17w0p4gwklnfqciwrkax2"
+    }
+  },
+  "version": 5
+}
+`
+
+func TestUpdateUnsupportedInput(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	path := filepath.Join(t.TempDir(), "sources.json")
+	if err := os.WriteFile(path, []byte(testChannelSources), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Skipped when updating all inputs
+	if err := runApp(t, runner.NewFake(), "--sources", path); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	// An error when asked for by name
+	err := runApp(t, runner.NewFake(), "--sources", path, "nixpkgs")
+	if err == nil {
+		t.Fatal("expected an error for an unsupported input")
+	}
+	if !strings.Contains(err.Error(), "npins update nixpkgs") {
+		t.Errorf("error is '%s' but npins was expected to be suggested", err)
+	}
+}
+
+const (
+	testWeb1Before = "/nix/store/aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa-nixos-system-web1-25.05"
+	testWeb1After  = "/nix/store/bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb-nixos-system-web1-25.05"
+	testWeb1Drv    = "/nix/store/eeeeeeeeeeeeeeeeeeeeeeeeeeeeeeee-nixos-system-web1-25.05.drv"
+)
+
+func runPreview(t *testing.T, fake *runner.Fake, s store.Store, input string, args ...string) error {
+	t.Helper()
+	return runnertest.RunWithInput(t, store.WithStore(context.Background(), s), localGit{fake}, input, Command, args...)
+}
+
+// unbuiltStore is a store whose paths that aren't built yet are
+// reported as not valid.
+type unbuiltStore struct {
+	*store.Fake
+	unbuilt []string
+}
+
+func (s unbuiltStore) QueryValidPaths(ctx context.Context, paths []string) ([]string, error) {
+	valid, err := s.Fake.QueryValidPaths(ctx, paths)
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(valid, func(p string) bool {
+		return slices.Contains(s.unbuilt, p)
+	}), nil
+}
+
+// previewStore returns a store with the web1 system before and
+// after updating, referencing the paths given, where the updated
+// system isn't built yet.
+func previewStore(before, after []string) store.Store {
+	paths := []*store.PathInfo{
+		{Path: testWeb1Before, References: before},
+		{Path: testWeb1After, References: after},
+	}
+	for _, p := range append(before, after...) {
+		paths = append(paths, &store.PathInfo{Path: p})
+	}
+	return unbuiltStore{store.NewFake(paths...), []string{testWeb1After}}
+}
+
+// previewResponses returns the responses of previewing an update
+// of the web1 system, where building the updated system fails
+// with exit code failure. The current system is in the store and
+// isn't built.
+func previewResponses(failure int) []runner.Response {
+	eval := []string{"eval", "-f", "nilla.nix", "systems.nixos.web1.result.config.system.build.toplevel.outPath", "--raw"}
+
+	return []runner.Response{
+		{
+			Name:   "nix",
+			Args:   []string{"eval", "-f", "nilla.nix", "systems"},
+			Stdout: `{"nixos":["web1","web2"],"home":["alice"]}`,
+		},
+		{
+			Name:   "nix",
+			Args:   eval,
+			Stdout: testWeb1Before,
+		},
+		{
+			Name:   "nix",
+			Args:   []string{"flake", "prefetch", "--json"},
+			Stdout: `{"hash":"sha256-47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="}`,
+		},
+		{
+			Name:   "nix",
+			Args:   eval,
+			Stdout: testWeb1After,
+		},
+		{
+			Name:   "nix",
+			Args:   []string{"eval", "-f", "nilla.nix", "systems.nixos.web1.result.config.system.build.toplevel.drvPath", "--raw"},
+			Stdout: testWeb1Drv,
+		},
+		{
+			Name:     "nix",
+			Args:     []string{"build", "--print-out-paths", testWeb1Drv + "^*", "--no-link"},
+			Stdout:   testWeb1After + "\n",
+			ExitCode: failure,
+		},
+	}
+}
+
+// assertReverted fails the test unless the sources file has the
+// original contents.
+func assertReverted(t *testing.T, path string, orig []byte) {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != string(orig) {
+		t.Errorf("sources file was expected to be reverted but is\n%s", data)
+	}
+}
+
+func TestUpdatePreviewDeclined(t *testing.T) {
+	path, _, _ := setupProject(t)
+
+	orig, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake := runner.NewFake(previewResponses(0)...)
+	s := previewStore(
+		[]string{"/nix/store/cccccccccccccccccccccccccccccccc-nginx-1.26.0"},
+		[]string{"/nix/store/dddddddddddddddddddddddddddddddd-nginx-1.27.1"},
+	)
+
+	err = runPreview(t, fake, s, "n\n", "--sources", path, "--preview", "--systems", "web1")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	runnertest.AssertAllUsed(t, fake)
+	assertReverted(t, path, orig)
+}
+
+func TestUpdatePreviewBuildFailed(t *testing.T) {
+	path, _, _ := setupProject(t)
+
+	orig, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake := runner.NewFake(previewResponses(1)...)
+
+	err = runPreview(t, fake, previewStore(nil, nil), "", "--sources", path, "--preview", "--systems", "web1")
+	if err == nil {
+		t.Fatal("expected an error for a failed build")
+	}
+
+	runnertest.AssertAllUsed(t, fake)
+	assertReverted(t, path, orig)
+}
+
+func TestUpdatePreviewAccepted(t *testing.T) {
+	path, _, latest := setupProject(t)
+
+	fake := runner.NewFake(previewResponses(0)...)
+
+	err := runPreview(t, fake, previewStore(nil, nil), "y\n", "--sources", path, "--preview", "--systems", "web1")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	srcs, err := npins.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pin, _ := srcs.Pin("test"); pin.Revision != latest {
+		t.Errorf("revision is '%s' but '%s' was expected", pin.Revision, latest)
+	}
+}
+
+func TestUpdatePreviewUnchanged(t *testing.T) {
+	path, _, _ := setupProject(t)
+
+	// Nothing is built when the update doesn't change the system
+	responses := previewResponses(0)
+	responses[3].Stdout = testWeb1Before
+	fake := runner.NewFake(responses[:4]...)
+
+	err := runPreview(t, fake, previewStore(nil, nil), "n\n", "--sources", path, "--preview", "--systems", "web1")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	runnertest.AssertAllUsed(t, fake)
+}
+
+func TestUpdateSystemsWithoutPreview(t *testing.T) {
+	path, _, _ := setupProject(t)
+
+	err := runApp(t, runner.NewFake(), "--sources", path, "--systems", "web1")
+	if !errors.Is(err, errSystemsWithoutPreview) {
+		t.Errorf("error is '%v' but '%v' was expected", err, errSystemsWithoutPreview)
+	}
+}
@@ -0,0 +1,165 @@
+package why
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/arnarg/lila/internal/nix"
+	"github.com/arnarg/lila/internal/runner"
+	"github.com/arnarg/lila/internal/store"
+	"github.com/arnarg/lila/internal/tui"
+	"github.com/urfave/cli/v2"
+)
+
+var errMissingArgs = errors.New("a system or package and a dependency must be given")
+
+var Command = &cli.Command{
+	Name:        "why",
+	Aliases:     []string{"why-depends"},
+	Usage:       "Show why a system or package depends on another package",
+	Description: "Shows the chain of references from a NixOS system, home configuration or package of a nilla project to a dependency in its closure",
+	Args:        true,
+	ArgsUsage:   "<system-or-package> <dependency>",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:    "all",
+			Aliases: []string{"a"},
+			Usage:   "Show all chains of references instead of only the shortest",
+		},
+	},
+	Action: run,
+}
+
+func printSection(text string) {
+	fmt.Fprintf(os.Stderr, "\033[32m>\033[0m %s\n", text)
+}
+
+// findDependency returns the paths in the closure matching dep,
+// which can be a store path, a package name or a part of a store
+// path name.
+func findDependency(closure []*store.PathInfo, dep string) []string {
+	paths := []string{}
+	for _, info := range closure {
+		paths = append(paths, info.Path)
+	}
+	slices.Sort(paths)
+
+	if strings.HasPrefix(dep, "/nix/store/") {
+		// Only the store path itself can be a dependency
+		parts := strings.SplitN(dep, "/", 5)
+		dep = strings.Join(parts[:min(len(parts), 4)], "/")
+		if slices.Contains(paths, dep) {
+			return []string{dep}
+		}
+		return []string{}
+	}
+
+	matchers := []func(string) bool{
+		func(name string) bool {
+			pname, _ := nix.ParseDrvName(name)
+			return pname == dep
+		},
+		func(name string) bool {
+			return name == dep
+		},
+		func(name string) bool {
+			return strings.Contains(name, dep)
+		},
+	}
+
+	for _, match := range matchers {
+		found := []string{}
+		for _, p := range paths {
+			if match(nix.StoreName(p)) {
+				found = append(found, p)
+			}
+		}
+		if len(found) > 0 {
+			return found
+		}
+	}
+
+	return []string{}
+}
+
+func run(ctx *cli.Context) error {
+	if ctx.Args().Len() != 2 {
+		return errMissingArgs
+	}
+	name, dep := ctx.Args().Get(0), ctx.Args().Get(1)
+
+	// Get current system
+	system, err := nix.CurrentSystem(ctx.Context)
+	if err != nil {
+		return err
+	}
+
+	attr, err := nix.ResolveAttr(ctx.Context, name, system)
+	if err != nil {
+		return err
+	}
+
+	//
+	// Build the system or package
+	//
+	printSection(fmt.Sprintf("Building %s", name))
+	out, err := tui.BuildAttrs(
+		ctx.Context, []string{attr}, []string{"--no-link"},
+		tui.NewBuildReporter(ctx.Bool("verbose")).
+			SummaryFile(ctx.String("summary-file")),
+	)
+	if err != nil {
+		return err
+	}
+
+	// Only the first output is looked at
+	outs := strings.Fields(string(out))
+	if len(outs) < 1 {
+		return fmt.Errorf("no output paths were built for %s", name)
+	}
+	path := outs[0]
+
+	//
+	// Find the dependency in the closure
+	//
+	s, err := store.Open(ctx.Context)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	closure, err := store.Closure(ctx.Context, s, path)
+	if err != nil {
+		return err
+	}
+
+	deps := findDependency(closure, dep)
+	if len(deps) < 1 {
+		return fmt.Errorf("%s does not depend on %q", name, dep)
+	}
+
+	nargs := []string{"why-depends"}
+	if ctx.Bool("all") {
+		nargs = append(nargs, "--all")
+	}
+
+	for _, d := range deps {
+		fmt.Fprintln(os.Stderr)
+		printSection(fmt.Sprintf("Why %s depends on %s", name, nix.StoreName(d)))
+
+		err := runner.Run(ctx.Context, runner.Cmd{
+			Name:   "nix",
+			Args:   append(slices.Clone(nargs), path, d),
+			Stdout: os.Stdout,
+			Stderr: os.Stderr,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
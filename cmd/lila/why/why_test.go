@@ -0,0 +1,133 @@
+package why
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/arnarg/lila/internal/runner"
+	"github.com/arnarg/lila/internal/runner/runnertest"
+	"github.com/arnarg/lila/internal/store"
+)
+
+func runApp(t *testing.T, fake *runner.Fake, s store.Store, args ...string) error {
+	t.Helper()
+	return runnertest.Run(t, store.WithStore(context.Background(), s), fake, Command, args...)
+}
+
+const (
+	testToplevel = "/nix/store/aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa-nixos-system-laptop-25.05"
+	testPython   = "/nix/store/bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb-python3-3.12.8"
+	testPython11 = "/nix/store/cccccccccccccccccccccccccccccccc-python3-3.11.11"
+	testGlibc    = "/nix/store/dddddddddddddddddddddddddddddddd-glibc-2.40-66"
+	testDrv      = "/nix/store/eeeeeeeeeeeeeeeeeeeeeeeeeeeeeeee-nixos-system-laptop-25.05.drv"
+	testHelloDrv = "/nix/store/ffffffffffffffffffffffffffffffff-hello-2.12.1.drv"
+)
+
+func testClosure() []*store.PathInfo {
+	return []*store.PathInfo{
+		{Path: testToplevel, References: []string{testPython, testPython11, testGlibc}},
+		{Path: testPython, References: []string{testGlibc}},
+		{Path: testPython11, References: []string{testGlibc}},
+		{Path: testGlibc, References: []string{testGlibc}},
+	}
+}
+
+func TestFindDependency(t *testing.T) {
+	tests := []struct {
+		dep      string
+		expected []string
+	}{
+		{dep: "glibc", expected: []string{testGlibc}},
+		{dep: "python3", expected: []string{testPython, testPython11}},
+		{dep: "python3-3.11.11", expected: []string{testPython11}},
+		{dep: "3.12", expected: []string{testPython}},
+		{dep: testGlibc + "/lib/libc.so.6", expected: []string{testGlibc}},
+		{dep: "openssl", expected: []string{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.dep, func(t *testing.T) {
+			found := findDependency(testClosure(), test.dep)
+			if !slices.Equal(found, test.expected) {
+				t.Errorf("found paths are '%v' but '%v' was expected", found, test.expected)
+			}
+		})
+	}
+}
+
+func TestWhy(t *testing.T) {
+	fake := runner.NewFake(
+		runner.Response{
+			Name:   "nix",
+			Args:   []string{"eval", "--expr", "builtins.currentSystem"},
+			Stdout: "x86_64-linux",
+		},
+		runner.Response{
+			Name:   "nix",
+			Args:   []string{"eval", "-f", "nilla.nix", "systems.nixos", "--apply", `x: x ? "laptop"`},
+			Stdout: "true",
+		},
+		runner.Response{
+			Name:   "nix",
+			Args:   []string{"eval", "-f", "nilla.nix", "systems.nixos.laptop.result.config.system.build.toplevel.drvPath", "--raw"},
+			Stdout: testDrv,
+		},
+		runner.Response{
+			Name:   "nix",
+			Args:   []string{"build", "--print-out-paths", testDrv + "^*", "--no-link"},
+			Stdout: testToplevel + "\n",
+		},
+		runner.Response{
+			Name: "nix",
+			Args: []string{"why-depends", "--all", testToplevel, testGlibc},
+		},
+	)
+
+	if err := runApp(t, fake, store.NewFake(testClosure()...), "--all", "laptop", "glibc"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	runnertest.AssertAllUsed(t, fake)
+}
+
+func TestWhyNotADependency(t *testing.T) {
+	fake := runner.NewFake(
+		runner.Response{
+			Name:   "nix",
+			Args:   []string{"eval", "--expr", "builtins.currentSystem"},
+			Stdout: "x86_64-linux",
+		},
+		runner.Response{
+			Name:   "nix",
+			Args:   []string{"eval", "-f", "nilla.nix", "systems.nixos", "--apply", `x: x ? "hello"`},
+			Stdout: "false",
+		},
+		runner.Response{
+			Name:   "nix",
+			Args:   []string{"eval", "-f", "nilla.nix", "systems.home", "--apply", `x: x ? "hello"`},
+			Stdout: "false",
+		},
+		runner.Response{
+			Name:   "nix",
+			Args:   []string{"eval", "-f", "nilla.nix", "packages", "--apply", `x: x ? "hello"`},
+			Stdout: "true",
+		},
+		runner.Response{
+			Name:   "nix",
+			Args:   []string{"eval", "-f", "nilla.nix", "packages.hello.result.x86_64-linux.drvPath", "--raw"},
+			Stdout: testHelloDrv,
+		},
+		runner.Response{
+			Name:   "nix",
+			Args:   []string{"build", "--print-out-paths", testHelloDrv + "^*", "--no-link"},
+			Stdout: testPython + "\n",
+		},
+	)
+
+	if err := runApp(t, fake, store.NewFake(testClosure()...), "hello", "openssl"); err == nil {
+		t.Fatal("expected an error for a missing dependency")
+	}
+
+	runnertest.AssertAllUsed(t, fake)
+}
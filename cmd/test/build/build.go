@@ -11,11 +11,15 @@ import (
 
 func main() {
 	// Run progress reporter
-	err := tui.NewBuildReporter(false).Run(
+	summary, err := tui.NewBuildReporter(false).Run(
 		context.Background(),
 		nix.NewProgressDecoder(os.Stdin),
 	)
 	if err != nil {
 		log.Fatal(err)
 	}
+
+	if err := summary.Report(nil); err != nil {
+		log.Fatal(err)
+	}
 }
@@ -11,7 +11,7 @@ import (
 
 func main() {
 	// Run progress reporter
-	err := tui.NewCopyReporter(false).Run(
+	_, err := tui.NewCopyReporter(false).Run(
 		context.Background(),
 		nix.NewProgressDecoder(os.Stdin),
 	)
@@ -1,8 +1,6 @@
 {
   lib,
   buildGoApplication,
-  nvd,
-  makeWrapper,
 }: let
   version = "0.0.0";
 in
@@ -16,10 +14,4 @@ in
 
     subPackages = ["cmd/lila"];
     ldflags = ["-X main.version=${version}"];
-
-    nativeBuildInputs = [makeWrapper];
-
-    postInstall = ''
-      wrapProgram $out/bin/lila --prefix PATH : ${lib.makeBinPath [nvd]}
-    '';
   }
@@ -0,0 +1,187 @@
+package elevate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/arnarg/lila/internal/runner"
+)
+
+// Method is a way of running commands with root privileges.
+type Method string
+
+const (
+	MethodAuto   Method = "auto"
+	MethodNone   Method = "none"
+	MethodSudo   Method = "sudo"
+	MethodDoas   Method = "doas"
+	MethodRun0   Method = "run0"
+	MethodPkexec Method = "pkexec"
+)
+
+// Methods lists the privilege escalation tools in order of preference
+// during auto-detection.
+var Methods = []Method{MethodSudo, MethodDoas, MethodRun0, MethodPkexec}
+
+// keepAliveInterval is how often cached credentials are refreshed
+// while long running work is in progress.
+var keepAliveInterval = time.Minute
+
+// geteuid returns the effective user ID, replaced in tests to
+// detect methods as another user than root.
+var geteuid = os.Geteuid
+
+var errNoMethodFound = errors.New("no privilege escalation tool found, tried sudo, doas, run0 and pkexec")
+
+// Parse parses the name of a privilege escalation method.
+func Parse(name string) (Method, error) {
+	if name == "" {
+		return MethodAuto, nil
+	}
+
+	m := Method(name)
+	if m == MethodAuto || m == MethodNone || slices.Contains(Methods, m) {
+		return m, nil
+	}
+
+	return "", fmt.Errorf("unknown privilege escalation method %q", name)
+}
+
+// Detect finds a privilege escalation tool to use, or MethodNone
+// when already running as root.
+func Detect() (Method, error) {
+	if geteuid() == 0 {
+		return MethodNone, nil
+	}
+
+	for _, m := range Methods {
+		if _, err := exec.LookPath(string(m)); err == nil {
+			return m, nil
+		}
+	}
+
+	return "", errNoMethodFound
+}
+
+// Resolve returns the concrete method to use, running auto-detection
+// if needed.
+func (m Method) Resolve() (Method, error) {
+	if m == MethodAuto {
+		return Detect()
+	}
+	return m, nil
+}
+
+// Wrap returns cmd wrapped to run with elevated privileges.
+func (m Method) Wrap(cmd runner.Cmd) runner.Cmd {
+	switch m {
+	case MethodNone, MethodAuto:
+		return cmd
+
+	case MethodPkexec:
+		// pkexec runs commands with a minimal environment
+		// without a useful PATH
+		if !filepath.IsAbs(cmd.Name) {
+			if p, err := exec.LookPath(cmd.Name); err == nil {
+				cmd.Name = p
+			}
+		}
+	}
+
+	cmd.Args = append([]string{cmd.Name}, cmd.Args...)
+	cmd.Name = string(m)
+
+	return cmd
+}
+
+type methodKey struct{}
+
+// WithMethod returns a copy of ctx carrying the privilege
+// escalation method m.
+func WithMethod(ctx context.Context, m Method) context.Context {
+	return context.WithValue(ctx, methodKey{}, m)
+}
+
+// FromContext returns the privilege escalation method carried by
+// ctx, falling back to MethodAuto.
+func FromContext(ctx context.Context) Method {
+	if m, ok := ctx.Value(methodKey{}).(Method); ok {
+		return m
+	}
+	return MethodAuto
+}
+
+// Command returns cmd wrapped to run with the privilege escalation
+// method carried by ctx.
+func Command(ctx context.Context, cmd runner.Cmd) (runner.Cmd, error) {
+	m, err := FromContext(ctx).Resolve()
+	if err != nil {
+		return cmd, err
+	}
+	return m.Wrap(cmd), nil
+}
+
+// Authenticate asks for the user's password up front, if needed, and
+// keeps the cached credentials fresh until the returned function is
+// called. This makes sure that elevated commands later on don't stop
+// to prompt for a password, possibly while a progress reporter is
+// drawing on the terminal. Only sudo and doas cache credentials, so
+// with run0 and pkexec the user is told to expect a prompt later.
+func Authenticate(ctx context.Context) (func(), error) {
+	m, err := FromContext(ctx).Resolve()
+	if err != nil {
+		return nil, err
+	}
+
+	var auth, refresh []string
+	switch m {
+	case MethodNone:
+		return func() {}, nil
+	case MethodSudo:
+		auth = []string{"-v"}
+		refresh = []string{"-n", "-v"}
+	case MethodDoas:
+		auth = []string{"true"}
+		refresh = []string{"-n", "true"}
+	default:
+		// run0 and pkexec go through polkit, which doesn't keep
+		// the authorization around for later invocations by default
+		fmt.Fprintf(os.Stderr, "%s will ask for authentication during activation\n", m)
+		return func() {}, nil
+	}
+
+	err = runner.Run(ctx, runner.Cmd{
+		Name:   string(m),
+		Args:   auth,
+		Stdin:  os.Stdin,
+		Stdout: os.Stderr,
+		Stderr: os.Stderr,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("authentication with %s failed: %w", m, err)
+	}
+
+	// Refresh credentials in the background
+	kctx, cancel := context.WithCancel(ctx)
+	ticker := time.NewTicker(keepAliveInterval)
+	go func() {
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-kctx.Done():
+				return
+			case <-ticker.C:
+				runner.Run(kctx, runner.Cmd{Name: string(m), Args: refresh})
+			}
+		}
+	}()
+
+	return cancel, nil
+}
@@ -0,0 +1,263 @@
+package elevate
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/arnarg/lila/internal/runner"
+)
+
+// setupPath makes PATH a directory with only the executables.
+func setupPath(t *testing.T, executables ...string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for _, name := range executables {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", dir)
+
+	return dir
+}
+
+// asUser makes the current user have the effective user ID uid
+// for the rest of the test.
+func asUser(t *testing.T, uid int) {
+	t.Helper()
+
+	geteuid = func() int { return uid }
+	t.Cleanup(func() { geteuid = os.Geteuid })
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name        string
+		expected    Method
+		expectError bool
+	}{
+		{name: "", expected: MethodAuto},
+		{name: "auto", expected: MethodAuto},
+		{name: "none", expected: MethodNone},
+		{name: "sudo", expected: MethodSudo},
+		{name: "doas", expected: MethodDoas},
+		{name: "run0", expected: MethodRun0},
+		{name: "pkexec", expected: MethodPkexec},
+		{name: "su", expectError: true},
+		{name: "SUDO", expectError: true},
+	}
+
+	for _, test := range tests {
+		m, err := Parse(test.name)
+		switch {
+		case test.expectError && err == nil:
+			t.Errorf("expected an error for %q but got none", test.name)
+		case !test.expectError && err != nil:
+			t.Errorf("unexpected error for %q: %s", test.name, err)
+		case m != test.expected:
+			t.Errorf("method of %q is '%s' but '%s' was expected", test.name, m, test.expected)
+		}
+	}
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name        string
+		uid         int
+		executables []string
+		expected    Method
+		expectError bool
+	}{
+		{
+			name:        "root",
+			uid:         0,
+			executables: []string{"sudo"},
+			expected:    MethodNone,
+		},
+		{
+			name:        "sudo first",
+			uid:         1000,
+			executables: []string{"pkexec", "doas", "sudo"},
+			expected:    MethodSudo,
+		},
+		{
+			name:        "doas before run0",
+			uid:         1000,
+			executables: []string{"run0", "doas"},
+			expected:    MethodDoas,
+		},
+		{
+			name:        "pkexec",
+			uid:         1000,
+			executables: []string{"pkexec"},
+			expected:    MethodPkexec,
+		},
+		{
+			name:        "nothing found",
+			uid:         1000,
+			expectError: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setupPath(t, test.executables...)
+			asUser(t, test.uid)
+
+			m, err := MethodAuto.Resolve()
+			if test.expectError {
+				if err == nil {
+					t.Fatalf("expected an error but detected '%s'", m)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if m != test.expected {
+				t.Errorf("detected '%s' but '%s' was expected", m, test.expected)
+			}
+		})
+	}
+}
+
+func TestWrap(t *testing.T) {
+	dir := setupPath(t, "nix")
+
+	tests := []struct {
+		name     string
+		method   Method
+		cmd      runner.Cmd
+		expected runner.Cmd
+	}{
+		{
+			name:     "none",
+			method:   MethodNone,
+			cmd:      runner.Cmd{Name: "nix", Args: []string{"build"}},
+			expected: runner.Cmd{Name: "nix", Args: []string{"build"}},
+		},
+		{
+			name:     "sudo",
+			method:   MethodSudo,
+			cmd:      runner.Cmd{Name: "nix", Args: []string{"build"}},
+			expected: runner.Cmd{Name: "sudo", Args: []string{"nix", "build"}},
+		},
+		{
+			name:     "run0",
+			method:   MethodRun0,
+			cmd:      runner.Cmd{Name: "/run/current-system/bin/switch-to-configuration", Args: []string{"test"}},
+			expected: runner.Cmd{Name: "run0", Args: []string{"/run/current-system/bin/switch-to-configuration", "test"}},
+		},
+		{
+			name:     "pkexec looks up the program",
+			method:   MethodPkexec,
+			cmd:      runner.Cmd{Name: "nix", Args: []string{"build"}},
+			expected: runner.Cmd{Name: "pkexec", Args: []string{filepath.Join(dir, "nix"), "build"}},
+		},
+		{
+			name:     "pkexec with an absolute path",
+			method:   MethodPkexec,
+			cmd:      runner.Cmd{Name: "/run/current-system/bin/switch-to-configuration", Args: []string{"test"}},
+			expected: runner.Cmd{Name: "pkexec", Args: []string{"/run/current-system/bin/switch-to-configuration", "test"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cmd := test.method.Wrap(test.cmd)
+			if runner.FormatCmd(cmd) != runner.FormatCmd(test.expected) {
+				t.Errorf("command is '%s' but '%s' was expected", runner.FormatCmd(cmd), runner.FormatCmd(test.expected))
+			}
+		})
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	tests := []struct {
+		method   Method
+		expected []string
+	}{
+		{method: MethodNone},
+		{method: MethodSudo, expected: []string{"sudo -v"}},
+		{method: MethodDoas, expected: []string{"doas true"}},
+		{method: MethodRun0},
+		{method: MethodPkexec},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.method), func(t *testing.T) {
+			fake := runner.NewFake(
+				runner.Response{Name: "sudo", Args: []string{"-v"}},
+				runner.Response{Name: "doas", Args: []string{"true"}},
+			)
+			ctx := runner.WithRunner(WithMethod(context.Background(), test.method), fake)
+
+			stop, err := Authenticate(ctx)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			stop()
+
+			calls := []string{}
+			for _, call := range fake.Calls() {
+				calls = append(calls, runner.FormatCmd(call))
+			}
+			if !slices.Equal(calls, test.expected) {
+				t.Errorf("commands run are %v but %v were expected", calls, test.expected)
+			}
+		})
+	}
+}
+
+func TestAuthenticateFailed(t *testing.T) {
+	fake := runner.NewFake(runner.Response{Name: "sudo", Args: []string{"-v"}, ExitCode: 1})
+	ctx := runner.WithRunner(WithMethod(context.Background(), MethodSudo), fake)
+
+	if _, err := Authenticate(ctx); err == nil {
+		t.Fatal("expected an error for failed authentication")
+	}
+}
+
+func TestAuthenticateKeepAlive(t *testing.T) {
+	keepAliveInterval = time.Millisecond
+	t.Cleanup(func() { keepAliveInterval = time.Minute })
+
+	fake := runner.NewFake(runner.Response{Name: "sudo", Args: []string{"-v"}})
+	ctx := runner.WithRunner(WithMethod(context.Background(), MethodSudo), fake)
+
+	stop, err := Authenticate(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// Credentials are refreshed without prompting
+	refreshed := func() int {
+		n := 0
+		for _, call := range fake.Calls() {
+			if runner.FormatCmd(call) == "sudo -n -v" {
+				n++
+			}
+		}
+		return n
+	}
+	for deadline := time.Now().Add(time.Second); refreshed() < 1; {
+		if time.Now().After(deadline) {
+			t.Fatal("credentials were never refreshed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// and no longer once stopped
+	stop()
+	time.Sleep(5 * time.Millisecond)
+	n := refreshed()
+	time.Sleep(10 * time.Millisecond)
+	if refreshed() != n {
+		t.Error("credentials were refreshed after stopping")
+	}
+}
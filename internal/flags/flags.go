@@ -0,0 +1,57 @@
+// Package flags defines the global flags of lila, shared by the
+// CLI and the tests of its commands.
+package flags
+
+import (
+	"github.com/arnarg/lila/internal/elevate"
+	"github.com/urfave/cli/v2"
+)
+
+// Global returns the flags accepted by all commands. A new set is
+// returned every time as flags keep their parsed values.
+func Global() []cli.Flag {
+	return []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "verbose",
+			Usage: "Set log level to verbose",
+		},
+		&cli.StringFlag{
+			Name:  "summary-file",
+			Usage: "Write a JSON summary of builds to `FILE`",
+		},
+		&cli.BoolFlag{
+			Name:  "warnings-as-errors",
+			Usage: "Fail when nix emits evaluation warnings or traces",
+		},
+		&cli.StringFlag{
+			Name:    "elevate",
+			Usage:   "Privilege escalation `METHOD` (auto, none, sudo, doas, run0 or pkexec)",
+			Value:   string(elevate.MethodAuto),
+			EnvVars: []string{"LILA_ELEVATE"},
+		},
+	}
+}
+
+// Ask returns the flag that asks for confirmation before a
+// configuration is applied. Setting LILA_ASK makes asking the
+// default.
+func Ask() cli.Flag {
+	return &cli.BoolFlag{
+		Name:    "ask",
+		Aliases: []string{"a"},
+		Usage:   "Ask for confirmation before applying the configuration",
+		EnvVars: []string{"LILA_ASK"},
+	}
+}
+
+// Activation returns the flags of commands that activate a
+// configuration.
+func Activation() []cli.Flag {
+	return []cli.Flag{
+		Ask(),
+		&cli.BoolFlag{
+			Name:  "dry-activate",
+			Usage: "Show what would change on activation without activating",
+		},
+	}
+}
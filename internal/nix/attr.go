@@ -0,0 +1,76 @@
+package nix
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/arnarg/lila/internal/runner"
+)
+
+// ResolveAttr returns the attribute path of the nilla project to
+// build for a name given on the command line. Names with a dot are
+// attribute paths and returned as is. Others are looked up as a
+// NixOS system, a home configuration and a package, in that order.
+func ResolveAttr(ctx context.Context, name, system string) (string, error) {
+	if strings.Contains(name, ".") {
+		return name, nil
+	}
+
+	candidates := []struct {
+		set  string
+		attr string
+	}{
+		{"systems.nixos", fmt.Sprintf("systems.nixos.%s.result.config.system.build.toplevel", name)},
+		{"systems.home", fmt.Sprintf("systems.home.%s.result.config.home.activationPackage", name)},
+		{"packages", fmt.Sprintf("packages.%s.result.%s", name, system)},
+	}
+
+	for _, c := range candidates {
+		out, err := runner.Output(ctx, runner.Cmd{
+			Name: "nix",
+			Args: []string{"eval", "-f", "nilla.nix", c.set, "--apply", fmt.Sprintf("x: x ? %q", name)},
+		})
+		if err != nil {
+			continue
+		}
+		if string(bytes.TrimSpace(out)) == "true" {
+			return c.attr, nil
+		}
+	}
+
+	return "", fmt.Errorf("%q is not a NixOS system, home configuration or package", name)
+}
+
+// DrvPath evaluates the derivation of an attribute of the nilla
+// project without building it, so that evaluation can be told
+// apart from building. Its outputs are built with `<drv>^*`.
+func DrvPath(ctx context.Context, attr string, reporter ProgressReporter) (string, error) {
+	out, err := Command("eval").
+		Args([]string{"-f", "nilla.nix", attr + ".drvPath", "--raw"}).
+		PrintOutPaths(false).
+		Reporter(reporter).
+		Run(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return string(out), nil
+}
+
+// DrvInstallables evaluates the derivations of attributes of the
+// nilla project with DrvPath and returns installables building all
+// of their outputs, in the order of the attributes.
+func DrvInstallables(ctx context.Context, attrs []string, reporter ProgressReporter) ([]string, error) {
+	installables := []string{}
+	for _, attr := range attrs {
+		drv, err := DrvPath(ctx, attr, reporter)
+		if err != nil {
+			return nil, err
+		}
+		installables = append(installables, drv+"^*")
+	}
+
+	return installables, nil
+}
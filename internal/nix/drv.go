@@ -0,0 +1,105 @@
+package nix
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// ParseDrvName splits a store path name into a package name and
+// version, following the rules of `builtins.parseDrvName`.
+func ParseDrvName(name string) (string, string) {
+	for i := 0; i < len(name)-1; i++ {
+		if name[i] == '-' && !unicode.IsLetter(rune(name[i+1])) {
+			return name[:i], name[i+1:]
+		}
+	}
+	return name, ""
+}
+
+// StoreName returns the name of a store path, without the store
+// directory and hash, e.g. "hello-2.12.1" for
+// "/nix/store/<hash>-hello-2.12.1".
+func StoreName(path string) string {
+	base := filepath.Base(path)
+	if _, name, ok := strings.Cut(base, "-"); ok {
+		return name
+	}
+	return base
+}
+
+// Versions returns the versions of every package in a closure of
+// output paths, keyed by package name.
+func Versions(closure []string) map[string][]string {
+	versions := map[string][]string{}
+
+	for _, p := range closure {
+		pname, version := ParseDrvName(StoreName(p))
+		if version == "" {
+			continue
+		}
+
+		// Other outputs than out have the output name appended,
+		// e.g. hello-2.12.1-man
+		if i := strings.LastIndex(version, "-"); i > 0 && isOutputName(version[i+1:]) {
+			version = version[:i]
+		}
+
+		if !slices.Contains(versions[pname], version) {
+			versions[pname] = append(versions[pname], version)
+		}
+	}
+
+	for _, vs := range versions {
+		slices.Sort(vs)
+	}
+
+	return versions
+}
+
+// isOutputName returns true if s looks like the name of an output
+// of a derivation rather than a part of a version.
+func isOutputName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !unicode.IsLetter(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// VersionChange is a package whose versions differ between two
+// closures. Before is empty for added packages and After for
+// removed ones.
+type VersionChange struct {
+	Name   string
+	Before []string
+	After  []string
+}
+
+// DiffVersions returns the packages whose versions differ between
+// two closures, ordered by name.
+func DiffVersions(before, after map[string][]string) []VersionChange {
+	changes := []VersionChange{}
+
+	for name, vs := range before {
+		if !slices.Equal(vs, after[name]) {
+			changes = append(changes, VersionChange{name, vs, after[name]})
+		}
+	}
+	for name, vs := range after {
+		if _, ok := before[name]; !ok {
+			changes = append(changes, VersionChange{name, nil, vs})
+		}
+	}
+
+	slices.SortFunc(changes, func(a, b VersionChange) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return changes
+}
@@ -0,0 +1,60 @@
+package nix
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseDrvName(t *testing.T) {
+	tests := []struct {
+		input   string
+		pname   string
+		version string
+	}{
+		{input: "hello-2.12.1", pname: "hello", version: "2.12.1"},
+		{input: "nixos-system-myhost-25.05", pname: "nixos-system-myhost", version: "25.05"},
+		{input: "python3.12-requests-2.32.3", pname: "python3.12-requests", version: "2.32.3"},
+		{input: "etc", pname: "etc", version: ""},
+	}
+
+	for _, test := range tests {
+		pname, version := ParseDrvName(test.input)
+		if pname != test.pname || version != test.version {
+			t.Errorf("ParseDrvName(\"%s\") is '%s', '%s' but '%s', '%s' was expected", test.input, pname, version, test.pname, test.version)
+		}
+	}
+}
+
+func TestDiffVersions(t *testing.T) {
+	before := Versions([]string{
+		"/nix/store/aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa-hello-2.12.1",
+		"/nix/store/bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb-nginx-1.26.0",
+		"/nix/store/cccccccccccccccccccccccccccccccc-openssl-3.0.14",
+		"/nix/store/dddddddddddddddddddddddddddddddd-openssl-3.0.14-bin",
+		"/nix/store/eeeeeeeeeeeeeeeeeeeeeeeeeeeeeeee-etc",
+	})
+	after := Versions([]string{
+		"/nix/store/ffffffffffffffffffffffffffffffff-hello-2.12.1",
+		"/nix/store/gggggggggggggggggggggggggggggggg-nginx-1.27.1",
+		"/nix/store/hhhhhhhhhhhhhhhhhhhhhhhhhhhhhhhh-curl-8.9.1",
+		"/nix/store/iiiiiiiiiiiiiiiiiiiiiiiiiiiiiiii-curl-8.9.1-man",
+	})
+
+	changes := DiffVersions(before, after)
+
+	expected := []VersionChange{
+		{Name: "curl", After: []string{"8.9.1"}},
+		{Name: "nginx", Before: []string{"1.26.0"}, After: []string{"1.27.1"}},
+		{Name: "openssl", Before: []string{"3.0.14"}},
+	}
+
+	if len(changes) != len(expected) {
+		t.Fatalf("got %d changes but %d were expected: %+v", len(changes), len(expected), changes)
+	}
+	for i, c := range changes {
+		e := expected[i]
+		if c.Name != e.Name || !slices.Equal(c.Before, e.Before) || !slices.Equal(c.After, e.After) {
+			t.Errorf("change %d is '%+v' but '%+v' was expected", i, c, e)
+		}
+	}
+}
@@ -3,18 +3,24 @@ package nix
 import (
 	"bytes"
 	"context"
+	"io"
 	"os"
-	"os/exec"
 	"os/signal"
 	"syscall"
+
+	"github.com/arnarg/lila/internal/elevate"
+	"github.com/arnarg/lila/internal/runner"
 )
 
 // CurrentSystem returns `builtins.currentSystem` from `nix eval`.
-func CurrentSystem() (string, error) {
-	sys, err := exec.Command(
-		"nix", "eval",
-		"--expr", "builtins.currentSystem", "--raw", "--impure",
-	).Output()
+func CurrentSystem(ctx context.Context) (string, error) {
+	sys, err := runner.Output(ctx, runner.Cmd{
+		Name: "nix",
+		Args: []string{
+			"eval",
+			"--expr", "builtins.currentSystem", "--raw", "--impure",
+		},
+	})
 	if err != nil {
 		return "", err
 	}
@@ -25,15 +31,18 @@ func CurrentSystem() (string, error) {
 type NixCommand struct {
 	cmd  string
 	args []string
+	env  []string
 
-	privileged bool
+	privileged    bool
+	printOutPaths bool
 
 	reporter ProgressReporter
 }
 
 func Command(cmd string) NixCommand {
 	return NixCommand{
-		cmd: cmd,
+		cmd:           cmd,
+		printOutPaths: true,
 	}
 }
 
@@ -42,91 +51,126 @@ func (c NixCommand) Args(args []string) NixCommand {
 	return c
 }
 
+// Env sets extra environment variables for nix, in the form
+// "key=value".
+func (c NixCommand) Env(env []string) NixCommand {
+	c.env = env
+	return c
+}
+
 func (c NixCommand) Privileged(privileged bool) NixCommand {
 	c.privileged = privileged
 	return c
 }
 
+// PrintOutPaths sets whether --print-out-paths is passed to nix,
+// which only some nix commands accept. It's enabled by default.
+func (c NixCommand) PrintOutPaths(print bool) NixCommand {
+	c.printOutPaths = print
+	return c
+}
+
 func (c NixCommand) Reporter(reporter ProgressReporter) NixCommand {
 	c.reporter = reporter
 	return c
 }
 
 func (c NixCommand) Run(ctx context.Context) ([]byte, error) {
-	cmd := "nix"
-	args := []string{}
+	ncmd := runner.Cmd{Name: "nix", Env: c.env}
 
-	// Check if we need to run with sudo
-	if c.privileged {
-		cmd = "sudo"
-		args = append(args, "nix")
+	// Append arguments
+	ncmd.Args = append(ncmd.Args, c.cmd)
+	if c.printOutPaths {
+		ncmd.Args = append(ncmd.Args, "--print-out-paths")
 	}
+	ncmd.Args = append(ncmd.Args, c.args...)
 
-	// Append rest of arguments
-	args = append(args, c.cmd, "--print-out-paths")
-	args = append(args, c.args...)
+	// Check if we need to run with elevated privileges
+	if c.privileged {
+		// Make sure a password prompt doesn't end up
+		// fighting with the progress reporter
+		if c.reporter != nil {
+			stop, err := elevate.Authenticate(ctx)
+			if err != nil {
+				return nil, err
+			}
+			defer stop()
+		}
+
+		var err error
+		if ncmd, err = elevate.Command(ctx, ncmd); err != nil {
+			return nil, err
+		}
+	}
 
 	if c.reporter != nil {
-		return c.runWithReporter(ctx, cmd, args)
+		return c.runWithReporter(ctx, ncmd)
 	}
 
-	return c.runStdout(ctx, cmd, args)
+	return c.runStdout(ctx, ncmd)
 }
 
-func (c NixCommand) runStdout(ctx context.Context, cmd string, args []string) ([]byte, error) {
-	// Create nix command
-	nixc := exec.CommandContext(ctx, cmd, args...)
-
+func (c NixCommand) runStdout(ctx context.Context, cmd runner.Cmd) ([]byte, error) {
 	// Create a buffer to capture nix's stdout
 	b := &bytes.Buffer{}
 
-	// Plug stdout and stderr
-	nixc.Stdout = b
-	nixc.Stderr = os.Stderr
-
 	// Run nix command
-	if err := nixc.Run(); err != nil {
+	cmd.Stdout = b
+	cmd.Stderr = os.Stderr
+	err := runner.Run(ctx, cmd)
+	if err != nil {
 		return nil, err
 	}
 
 	return bytes.TrimSpace(b.Bytes()), nil
 }
 
-func (c NixCommand) runWithReporter(ctx context.Context, cmd string, args []string) (res []byte, err error) {
+func (c NixCommand) runWithReporter(ctx context.Context, cmd runner.Cmd) (res []byte, err error) {
 	cctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 	sctx, stop := signal.NotifyContext(cctx, syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
 	// Add internal-json format flags
-	args = append(args, "--log-format", "internal-json", "-v")
-
-	// Create nix command
-	nixc := exec.CommandContext(sctx, cmd, args...)
+	cmd.Args = append(cmd.Args, "--log-format", "internal-json", "-v")
 
 	// Create a buffer to capture nix's stdout
 	b := &bytes.Buffer{}
-	nixc.Stdout = b
 
-	// Get stderr pipe from nix command
-	stderr, err := nixc.StderrPipe()
-	if err != nil {
-		return
-	}
+	// Pipe nix's stderr to the progress reporter
+	stderr, stderrw := io.Pipe()
 
 	// Start nix command
-	if err = nixc.Start(); err != nil {
-		return
-	}
+	done := make(chan error, 1)
+	go func() {
+		cmd.Stdout = b
+		cmd.Stderr = stderrw
+		err := runner.Run(sctx, cmd)
+		stderrw.Close()
+		done <- err
+	}()
 
 	// Run progress reporter
-	var perr error
-	if perr = c.reporter.Run(sctx, NewProgressDecoder(stderr)); perr != nil {
+	summary, perr := c.reporter.Run(sctx, NewProgressDecoder(stderr))
+	if perr != nil {
 		cancel()
 	}
 
+	// Drain whatever the reporter didn't read so that
+	// nix doesn't block on writing to stderr
+	go io.Copy(io.Discard, stderr)
+
 	// Wait for nix command
-	cerr := nixc.Wait()
+	cerr := <-done
+
+	// The summary is only reported once the exit status
+	// of nix is known
+	if summary != nil {
+		if serr := summary.Report(cerr); serr != nil && perr == nil && cerr == nil {
+			err = serr
+			return
+		}
+	}
 
 	// Set error
 	if perr != nil {
@@ -0,0 +1,68 @@
+package nix
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/arnarg/lila/internal/runner"
+)
+
+type testSummary struct {
+	reported bool
+	exitErr  error
+}
+
+func (s *testSummary) Report(exitErr error) error {
+	s.reported = true
+	s.exitErr = exitErr
+	return nil
+}
+
+// testReporter reads the whole log and returns its summary.
+type testReporter struct {
+	summary *testSummary
+}
+
+func (r testReporter) Run(ctx context.Context, decoder *ProgressDecoder) (Summary, error) {
+	io.Copy(io.Discard, decoder.reader)
+	return r.summary, nil
+}
+
+func TestCommandReportsSummaryWithExitStatus(t *testing.T) {
+	tests := []struct {
+		name        string
+		exitCode    int
+		expectError bool
+	}{
+		{name: "succeeded", exitCode: 0},
+		{name: "failed", exitCode: 1, expectError: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := runner.NewFake(runner.Response{
+				Name:     "nix",
+				Args:     []string{"build"},
+				ExitCode: test.exitCode,
+			})
+			ctx := runner.WithRunner(context.Background(), fake)
+
+			summary := &testSummary{}
+			_, err := Command("build").
+				Args([]string{"-f", "nilla.nix", "packages.hello.result.x86_64-linux"}).
+				Reporter(testReporter{summary}).
+				Run(ctx)
+
+			if (err != nil) != test.expectError {
+				t.Fatalf("error is '%v' but an error was expected: %t", err, test.expectError)
+			}
+			if !summary.reported {
+				t.Fatal("summary was never reported")
+			}
+			if (summary.exitErr != nil) != test.expectError {
+				t.Errorf("summary exit status is '%v' but a failure was expected: %t", summary.exitErr, test.expectError)
+			}
+		})
+	}
+}
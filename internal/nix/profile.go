@@ -0,0 +1,175 @@
+package nix
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arnarg/lila/internal/runner"
+)
+
+// storeDir is the directory of the nix store.
+const storeDir = "/nix/store"
+
+// Generation is a single generation of a nix profile.
+type Generation struct {
+	ID int
+	// Path of the generation's symlink, i.e. `<profile>-<ID>-link`
+	Path string
+	// Target is the store path the generation points to
+	Target  string
+	Created time.Time
+	Current bool
+}
+
+// ListGenerations lists all generations of the profile, ordered
+// by generation number.
+func ListGenerations(profile string) ([]Generation, error) {
+	dir := filepath.Dir(profile)
+	base := filepath.Base(profile)
+
+	// Generation the profile currently points to
+	current, err := os.Readlink(profile)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	linkRe := regexp.MustCompile(fmt.Sprintf(`^%s-(\d+)-link$`, regexp.QuoteMeta(base)))
+
+	gens := []Generation{}
+	for _, e := range entries {
+		m := linkRe.FindStringSubmatch(e.Name())
+		if m == nil {
+			continue
+		}
+
+		id, err := strconv.Atoi(m[1])
+		if err != nil {
+			continue
+		}
+
+		path := filepath.Join(dir, e.Name())
+
+		target, err := os.Readlink(path)
+		if err != nil {
+			return nil, err
+		}
+
+		info, err := os.Lstat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		gens = append(gens, Generation{
+			ID:      id,
+			Path:    path,
+			Target:  target,
+			Created: info.ModTime(),
+			Current: e.Name() == filepath.Base(current),
+		})
+	}
+
+	slices.SortFunc(gens, func(a, b Generation) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+
+	return gens, nil
+}
+
+// StorePath returns the store path a profile, or a generation of
+// it, points to by following its symlinks. Paths inside a store
+// path that are not symlinks, or can't be read, resolve to the
+// store path, e.g. "/nix/store/<hash>-name" for
+// "/nix/store/<hash>-name/bin/foo".
+func StorePath(path string) (string, error) {
+	for range 40 {
+		target, err := os.Readlink(path)
+		if rest, ok := strings.CutPrefix(path, storeDir+"/"); ok && err != nil {
+			name, _, _ := strings.Cut(rest, "/")
+			return storeDir + "/" + name, nil
+		} else if err != nil {
+			return "", err
+		}
+
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(path), target)
+		}
+		path = target
+	}
+
+	return "", fmt.Errorf("too many levels of symbolic links in %s", path)
+}
+
+// PrintGenerations prints a table of the generations of the profile
+// to w, along with the specialisations of each generation.
+func PrintGenerations(w io.Writer, profile string) error {
+	gens, err := ListGenerations(profile)
+	if err != nil {
+		return err
+	}
+
+	for _, gen := range gens {
+		current := ""
+		if gen.Current {
+			current = "(current)"
+		}
+
+		fmt.Fprintf(
+			w, "%4d   %s   %s %s\n",
+			gen.ID, gen.Created.Format(time.DateTime), gen.Target, current,
+		)
+
+		// List the generation's specialisations
+		entries, err := os.ReadDir(filepath.Join(gen.Target, "specialisation"))
+		if err != nil {
+			continue
+		}
+
+		specs := []string{}
+		for _, e := range entries {
+			specs = append(specs, e.Name())
+		}
+		if len(specs) > 0 {
+			fmt.Fprintf(w, "       specialisations: %s\n", strings.Join(specs, ", "))
+		}
+	}
+
+	return nil
+}
+
+// ListSpecialisations returns the names of the specialisations of
+// the configuration at the attribute path of the nilla project,
+// e.g. `systems.nixos.<name>.result.config`.
+func ListSpecialisations(ctx context.Context, config string) ([]string, error) {
+	out, err := runner.Output(ctx, runner.Cmd{
+		Name: "nix",
+		Args: []string{
+			"eval", "-f", "nilla.nix", config + ".specialisation",
+			"--apply", "builtins.attrNames", "--json",
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	specs := []string{}
+	if err := json.Unmarshal(out, &specs); err != nil {
+		return nil, err
+	}
+
+	return specs, nil
+}
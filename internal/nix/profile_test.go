@@ -0,0 +1,134 @@
+package nix
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestListGenerations(t *testing.T) {
+	dir := t.TempDir()
+
+	links := map[string]string{
+		"home-manager-1-link":  "/nix/store/aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa-home-manager-generation",
+		"home-manager-2-link":  "/nix/store/bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb-home-manager-generation",
+		"home-manager-10-link": "/nix/store/cccccccccccccccccccccccccccccccc-home-manager-generation",
+		"home-manager":         "home-manager-2-link",
+		"other-1-link":         "/nix/store/dddddddddddddddddddddddddddddddd-other",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	gens, err := ListGenerations(filepath.Join(dir, "home-manager"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := []struct {
+		id      int
+		target  string
+		current bool
+	}{
+		{1, links["home-manager-1-link"], false},
+		{2, links["home-manager-2-link"], true},
+		{10, links["home-manager-10-link"], false},
+	}
+
+	if len(gens) != len(expected) {
+		t.Fatalf("found %d generations but %d were expected", len(gens), len(expected))
+	}
+
+	for i, exp := range expected {
+		gen := gens[i]
+		if gen.ID != exp.id {
+			t.Errorf("generation id is '%d' but '%d' was expected", gen.ID, exp.id)
+		}
+		if gen.Target != exp.target {
+			t.Errorf("generation target is '%s' but '%s' was expected", gen.Target, exp.target)
+		}
+		if gen.Current != exp.current {
+			t.Errorf("generation %d current is '%v' but '%v' was expected", gen.ID, gen.Current, exp.current)
+		}
+	}
+}
+
+func TestPrintGenerations(t *testing.T) {
+	dir := t.TempDir()
+
+	// Generations with and without specialisations
+	targets := []string{filepath.Join(dir, "gen-1"), filepath.Join(dir, "gen-2")}
+	for _, spec := range []string{"work", "gaming"} {
+		if err := os.MkdirAll(filepath.Join(targets[1], "specialisation", spec), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	links := map[string]string{
+		"system-1-link": targets[0],
+		"system-2-link": targets[1],
+		"system":        "system-2-link",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b := &strings.Builder{}
+	if err := PrintGenerations(b, filepath.Join(dir, "system")); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 lines but got\n%s", b)
+	}
+	if !strings.HasSuffix(lines[1], targets[1]+" (current)") {
+		t.Errorf("line is '%s' but the current generation was expected", lines[1])
+	}
+	if strings.TrimSpace(lines[2]) != "specialisations: gaming, work" {
+		t.Errorf("line is '%s' but the specialisations were expected", lines[2])
+	}
+}
+
+func TestStorePath(t *testing.T) {
+	dir := t.TempDir()
+
+	for name, target := range map[string]string{
+		"home-manager-1-link": "/nix/store/aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa-home-manager-generation",
+		"home-manager":        "home-manager-1-link",
+		"specialisation":      "/nix/store/bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb-nixos-system/specialisation/work",
+	} {
+		if err := os.Symlink(target, filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{filepath.Join(dir, "home-manager"), "/nix/store/aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa-home-manager-generation"},
+		{filepath.Join(dir, "specialisation"), "/nix/store/bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb-nixos-system"},
+		{"/nix/store/cccccccccccccccccccccccccccccccc-hello/bin/hello", "/nix/store/cccccccccccccccccccccccccccccccc-hello"},
+	}
+
+	for _, test := range tests {
+		path, err := StorePath(test.path)
+		if err != nil {
+			t.Errorf("unexpected error for '%s': %s", test.path, err)
+			continue
+		}
+		if path != test.expected {
+			t.Errorf("store path of '%s' is '%s' but '%s' was expected", test.path, path, test.expected)
+		}
+	}
+
+	if _, err := StorePath(filepath.Join(dir, "missing")); err == nil {
+		t.Error("expected an error for a missing profile")
+	}
+}
@@ -115,6 +115,17 @@ func (e StartFileTransferEvent) Action() ActionType {
 	return ActionTypeStart
 }
 
+// StartFetchTreeEvent
+type StartFetchTreeEvent struct {
+	ID     int64
+	Parent int64
+	Text   string
+}
+
+func (e StartFetchTreeEvent) Action() ActionType {
+	return ActionTypeStart
+}
+
 // ResultProgressEvent
 type ResultProgressEvent struct {
 	ID       int64
@@ -167,8 +178,18 @@ func (e MessageEvent) Action() ActionType {
 	return ActionTypeMessage
 }
 
+// ProgressReporter reports the progress of a nix command from its
+// log. It can return a summary, which is reported once nix has
+// exited.
 type ProgressReporter interface {
-	Run(context.Context, *ProgressDecoder) error
+	Run(context.Context, *ProgressDecoder) (Summary, error)
+}
+
+// Summary describes what happened during a nix command.
+type Summary interface {
+	// Report reports the summary with the exit status of nix,
+	// which is nil if it succeeded.
+	Report(exitErr error) error
 }
 
 const protoPrefix = "@nix "
@@ -260,6 +281,8 @@ func decodeRawStartEvent(val *fastjson.Value) Event {
 		return decodeRawStartBuildEvent(val)
 	case protoEventTypeFileTransfer:
 		return decodeRawStartFileTransferEvent(val)
+	case protoEventTypeFetchTree:
+		return decodeRawStartFetchTreeEvent(val)
 	}
 
 	return nil
@@ -413,6 +436,26 @@ func decodeRawStartFileTransferEvent(val *fastjson.Value) Event {
 	}
 }
 
+func decodeRawStartFetchTreeEvent(val *fastjson.Value) Event {
+	id := val.GetInt64("id")
+	// If ID is 0, we just ignore the event
+	if id < 1 {
+		return nil
+	}
+
+	// Get text
+	text := val.GetStringBytes("text")
+	if text == nil {
+		text = []byte{}
+	}
+
+	return StartFetchTreeEvent{
+		ID:     id,
+		Parent: val.GetInt64("parent"),
+		Text:   string(text),
+	}
+}
+
 func decodeRawResultEvent(val *fastjson.Value) Event {
 	switch val.GetInt("type") {
 	case protoResultTypeProgress:
@@ -0,0 +1,99 @@
+package nix
+
+import (
+	"cmp"
+	"encoding/json"
+	"slices"
+)
+
+// EvalStatsEnv returns the environment variables that make nix
+// write evaluation statistics, including function call and
+// attribute selection counts, as JSON to path.
+func EvalStatsEnv(path string) []string {
+	return []string{
+		"NIX_SHOW_STATS=1",
+		"NIX_SHOW_STATS_PATH=" + path,
+		"NIX_COUNT_CALLS=1",
+	}
+}
+
+// EvalStats are the statistics nix writes about an evaluation.
+type EvalStats struct {
+	CPUTime         float64 `json:"cpuTime"`
+	NrFunctionCalls int64   `json:"nrFunctionCalls"`
+	NrThunks        int64   `json:"nrThunks"`
+	NrLookups       int64   `json:"nrLookups"`
+	NrPrimOpCalls   int64   `json:"nrPrimOpCalls"`
+
+	GC struct {
+		HeapSize   int64 `json:"heapSize"`
+		TotalBytes int64 `json:"totalBytes"`
+	} `json:"gc"`
+
+	// Only set when counting calls
+	Functions  []PositionCount `json:"functions"`
+	Attributes []PositionCount `json:"attributes"`
+}
+
+// PositionCount is how many times the function or attribute
+// selection at a position in a file was evaluated.
+type PositionCount struct {
+	Name   string `json:"name"`
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+	Count  int64  `json:"count"`
+}
+
+// FileCount is how many times functions in a file were called.
+type FileCount struct {
+	File  string
+	Count int64
+}
+
+// ParseEvalStats parses the evaluation statistics written by nix.
+func ParseEvalStats(data []byte) (*EvalStats, error) {
+	stats := &EvalStats{}
+	if err := json.Unmarshal(data, stats); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// HottestFiles returns the n files with the most function calls.
+func (s *EvalStats) HottestFiles(n int) []FileCount {
+	counts := map[string]int64{}
+	for _, f := range s.Functions {
+		counts[f.File] += f.Count
+	}
+
+	files := []FileCount{}
+	for file, count := range counts {
+		files = append(files, FileCount{file, count})
+	}
+
+	slices.SortFunc(files, func(a, b FileCount) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.File, b.File))
+	})
+
+	return files[:max(min(n, len(files)), 0)]
+}
+
+// HottestFunctions returns the n most called functions.
+func (s *EvalStats) HottestFunctions(n int) []PositionCount {
+	return hottest(s.Functions, n)
+}
+
+// HottestAttributes returns the n most evaluated attribute
+// selections.
+func (s *EvalStats) HottestAttributes(n int) []PositionCount {
+	return hottest(s.Attributes, n)
+}
+
+func hottest(counts []PositionCount, n int) []PositionCount {
+	counts = slices.Clone(counts)
+	slices.SortStableFunc(counts, func(a, b PositionCount) int {
+		return cmp.Compare(b.Count, a.Count)
+	})
+	return counts[:max(min(n, len(counts)), 0)]
+}
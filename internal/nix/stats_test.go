@@ -0,0 +1,70 @@
+package nix
+
+import (
+	"testing"
+)
+
+const testEvalStats = `{
+  "cpuTime": 41.2,
+  "nrFunctionCalls": 1200,
+  "nrThunks": 5000,
+  "gc": {"heapSize": 1073741824, "totalBytes": 4294967296},
+  "functions": [
+    {"name": "mkOption", "file": "/nix/store/aaa-source/lib/options.nix", "line": 10, "column": 5, "count": 300},
+    {"name": null, "file": "/nix/store/aaa-source/lib/modules.nix", "line": 20, "column": 3, "count": 500},
+    {"name": "mkIf", "file": "/nix/store/aaa-source/lib/modules.nix", "line": 80, "column": 3, "count": 250},
+    {"name": "map", "file": "/nix/store/aaa-source/lib/lists.nix", "line": 1, "column": 1, "count": 150}
+  ],
+  "attributes": [
+    {"file": "/nix/store/aaa-source/lib/modules.nix", "line": 21, "column": 9, "count": 40},
+    {"file": "/nix/store/aaa-source/lib/options.nix", "line": 11, "column": 7, "count": 90}
+  ]
+}`
+
+func TestParseEvalStats(t *testing.T) {
+	stats, err := ParseEvalStats([]byte(testEvalStats))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if stats.CPUTime != 41.2 {
+		t.Errorf("CPU time is '%f' but '%f' was expected", stats.CPUTime, 41.2)
+	}
+	if stats.GC.TotalBytes != 4294967296 {
+		t.Errorf("total bytes is '%d' but '%d' was expected", stats.GC.TotalBytes, 4294967296)
+	}
+
+	files := stats.HottestFiles(2)
+	expectedFiles := []FileCount{
+		{"/nix/store/aaa-source/lib/modules.nix", 750},
+		{"/nix/store/aaa-source/lib/options.nix", 300},
+	}
+	if len(files) != len(expectedFiles) {
+		t.Fatalf("got %d files but %d were expected", len(files), len(expectedFiles))
+	}
+	for i, f := range files {
+		if f != expectedFiles[i] {
+			t.Errorf("file %d is '%v' but '%v' was expected", i, f, expectedFiles[i])
+		}
+	}
+
+	functions := stats.HottestFunctions(10)
+	if len(functions) != 4 {
+		t.Fatalf("got %d functions but 4 were expected", len(functions))
+	}
+	if functions[0].Line != 20 || functions[3].Name != "map" {
+		t.Errorf("functions are not sorted by count: %v", functions)
+	}
+
+	attrs := stats.HottestAttributes(1)
+	if len(attrs) != 1 || attrs[0].Count != 90 {
+		t.Errorf("hottest attributes are '%v' but the selection at options.nix:11 was expected", attrs)
+	}
+
+	if files := stats.HottestFiles(-1); len(files) != 0 {
+		t.Errorf("got %d files for a negative count but none were expected", len(files))
+	}
+	if functions := stats.HottestFunctions(-1); len(functions) != 0 {
+		t.Errorf("got %d functions for a negative count but none were expected", len(functions))
+	}
+}
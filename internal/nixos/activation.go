@@ -0,0 +1,171 @@
+package nixos
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// ActivationReport is a structured summary of the systemd unit
+// changes reported by switch-to-configuration.
+type ActivationReport struct {
+	DryRun       bool     `json:"dryRun"`
+	Stopped      []string `json:"stopped"`
+	Started      []string `json:"started"`
+	Restarted    []string `json:"restarted"`
+	Reloaded     []string `json:"reloaded"`
+	NotRestarted []string `json:"notRestarted"`
+	Failed       []string `json:"failed"`
+}
+
+var (
+	// e.g. "stopping the following units: a.service, b.service"
+	// or "would restart the following units: a.service"
+	unitsLineRe = regexp.MustCompile(
+		`^(would )?(stopping|stop|restarting|restart|reloading|reload|starting|start|NOT restarting|NOT restart|NOT stop) the following (?:changed )?units: (.*)$`,
+	)
+	// e.g. "the following new units were started: a.service"
+	newUnitsLineRe = regexp.MustCompile(`^the following new units were started: (.*)$`)
+	// e.g. "warning: the following units failed: a.service"
+	failedLineRe = regexp.MustCompile(`^warning: the following units failed: (.*)$`)
+	// e.g. "restarting sysinit-reactivation.target"
+	singleUnitLineRe = regexp.MustCompile(`^(would )?(restarting|restart|reloading|reload) (\S+\.\w+)$`)
+)
+
+// ParseActivation parses the output of switch-to-configuration.
+func ParseActivation(r io.Reader) (*ActivationReport, error) {
+	report := &ActivationReport{
+		Stopped:      []string{},
+		Started:      []string{},
+		Restarted:    []string{},
+		Reloaded:     []string{},
+		NotRestarted: []string{},
+		Failed:       []string{},
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if m := unitsLineRe.FindStringSubmatch(line); m != nil {
+			if m[1] != "" {
+				report.DryRun = true
+			}
+			report.add(m[2], splitUnits(m[3]))
+		} else if m := newUnitsLineRe.FindStringSubmatch(line); m != nil {
+			report.add("starting", splitUnits(m[1]))
+		} else if m := failedLineRe.FindStringSubmatch(line); m != nil {
+			report.add("failed", splitUnits(m[1]))
+		} else if m := singleUnitLineRe.FindStringSubmatch(line); m != nil {
+			if m[1] != "" {
+				report.DryRun = true
+			}
+			report.add(m[2], []string{m[3]})
+		}
+	}
+
+	return report, scanner.Err()
+}
+
+func splitUnits(s string) []string {
+	units := []string{}
+	for _, u := range strings.Split(s, ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			units = append(units, u)
+		}
+	}
+	return units
+}
+
+func (r *ActivationReport) add(action string, units []string) {
+	var list *[]string
+
+	switch action {
+	case "stopping", "stop":
+		list = &r.Stopped
+	case "starting", "start":
+		list = &r.Started
+	case "restarting", "restart":
+		list = &r.Restarted
+	case "reloading", "reload":
+		list = &r.Reloaded
+	case "NOT restarting", "NOT restart", "NOT stop":
+		list = &r.NotRestarted
+	case "failed":
+		list = &r.Failed
+	default:
+		return
+	}
+
+	for _, u := range units {
+		if !slices.Contains(*list, u) {
+			*list = append(*list, u)
+		}
+	}
+}
+
+// Empty returns true if no unit changes were reported.
+func (r *ActivationReport) Empty() bool {
+	return len(r.Stopped)+len(r.Started)+len(r.Restarted)+
+		len(r.Reloaded)+len(r.NotRestarted)+len(r.Failed) == 0
+}
+
+// Print writes a human readable summary of the unit changes to w.
+func (r *ActivationReport) Print(w io.Writer) {
+	if r.Empty() {
+		fmt.Fprintln(w, lipgloss.NewStyle().Faint(true).Render("No units changed"))
+		return
+	}
+
+	rows := []struct {
+		title string
+		color string
+		units []string
+	}{
+		{"Stopped", "11", r.Stopped},
+		{"Started", "10", r.Started},
+		{"Restarted", "12", r.Restarted},
+		{"Reloaded", "14", r.Reloaded},
+		{"Not restarted", "8", r.NotRestarted},
+		{"Failed", "9", r.Failed},
+	}
+
+	if r.DryRun {
+		rows[0].title = "Would stop"
+		rows[1].title = "Would start"
+		rows[2].title = "Would restart"
+		rows[3].title = "Would reload"
+	}
+
+	width := 0
+	for _, row := range rows {
+		width = max(width, lipgloss.Width(row.title))
+	}
+
+	for _, row := range rows {
+		if len(row.units) < 1 {
+			continue
+		}
+
+		title := lipgloss.NewStyle().
+			Bold(true).
+			Foreground(lipgloss.Color(row.color)).
+			Width(width).
+			Render(row.title)
+
+		fmt.Fprintf(w, "%s %s\n", title, strings.Join(row.units, ", "))
+	}
+}
+
+// WriteJSON writes the report as JSON to w.
+func (r *ActivationReport) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
@@ -0,0 +1,96 @@
+package nixos
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseActivation(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		report ActivationReport
+	}{
+		{
+			name: "switch",
+			output: `stopping the following units: foo.service, bar.timer
+NOT restarting the following changed units: systemd-fsck@dev-disk.service
+activating the configuration...
+setting up /etc...
+reloading user units for alice...
+restarting sysinit-reactivation.target
+reloading the following units: dbus.service
+restarting the following units: foo.service, nginx.service
+starting the following units: bar.timer
+the following new units were started: baz.service, bar.timer
+warning: the following units failed: nginx.service
+
+× nginx.service - Nginx Web Server
+     Active: failed (Result: exit-code)
+`,
+			report: ActivationReport{
+				Stopped:      []string{"foo.service", "bar.timer"},
+				Started:      []string{"bar.timer", "baz.service"},
+				Restarted:    []string{"sysinit-reactivation.target", "foo.service", "nginx.service"},
+				Reloaded:     []string{"dbus.service"},
+				NotRestarted: []string{"systemd-fsck@dev-disk.service"},
+				Failed:       []string{"nginx.service"},
+			},
+		},
+		{
+			name: "dry activate",
+			output: `would stop the following units: foo.service
+would NOT stop the following changed units: getty@tty1.service
+would activate the configuration...
+would restart systemd
+would reload the following units: dbus.service
+would restart the following units: nginx.service
+would start the following units: foo.service
+`,
+			report: ActivationReport{
+				DryRun:       true,
+				Stopped:      []string{"foo.service"},
+				Started:      []string{"foo.service"},
+				Restarted:    []string{"nginx.service"},
+				Reloaded:     []string{"dbus.service"},
+				NotRestarted: []string{"getty@tty1.service"},
+			},
+		},
+		{
+			name:   "nothing changed",
+			output: "activating the configuration...\nsetting up /etc...\n",
+			report: ActivationReport{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := ParseActivation(strings.NewReader(tt.output))
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if report.DryRun != tt.report.DryRun {
+				t.Errorf("dry run is '%v' but '%v' was expected", report.DryRun, tt.report.DryRun)
+			}
+
+			lists := []struct {
+				name     string
+				out, exp []string
+			}{
+				{"stopped", report.Stopped, tt.report.Stopped},
+				{"started", report.Started, tt.report.Started},
+				{"restarted", report.Restarted, tt.report.Restarted},
+				{"reloaded", report.Reloaded, tt.report.Reloaded},
+				{"not restarted", report.NotRestarted, tt.report.NotRestarted},
+				{"failed", report.Failed, tt.report.Failed},
+			}
+			for _, l := range lists {
+				if !slices.Equal(l.out, l.exp) {
+					t.Errorf("%s units are '%v' but '%v' was expected", l.name, l.out, l.exp)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,241 @@
+package npins
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arnarg/lila/internal/runner"
+)
+
+var errNoCacheDir = errors.New("no cache directory found")
+
+// Cache keeps bare clones of the repositories of pins, with only
+// their commits, to resolve revisions and count commits between them.
+type Cache struct {
+	dir string
+}
+
+// NewCache creates a cache in dir.
+func NewCache(dir string) *Cache {
+	return &Cache{dir}
+}
+
+// DefaultCacheDir returns the directory lila caches repositories in.
+func DefaultCacheDir() (string, error) {
+	if cache := os.Getenv("XDG_CACHE_HOME"); cache != "" {
+		return filepath.Join(cache, "lila", "git"), nil
+	}
+	if home := os.Getenv("HOME"); home != "" {
+		return filepath.Join(home, ".cache", "lila", "git"), nil
+	}
+	return "", errNoCacheDir
+}
+
+// Repo returns the cached repository of a remote.
+func (c *Cache) Repo(remote string) *Repo {
+	sum := sha256.Sum256([]byte(remote))
+	return &Repo{
+		dir:    filepath.Join(c.dir, hex.EncodeToString(sum[:8])),
+		remote: remote,
+	}
+}
+
+// Repo is a cached bare clone of a remote repository.
+type Repo struct {
+	dir    string
+	remote string
+}
+
+func (r *Repo) git(ctx context.Context, args ...string) (string, error) {
+	return git(ctx, append([]string{"-C", r.dir}, args...)...)
+}
+
+// git runs git and returns its output, adding what git printed
+// on stderr to the error if it fails.
+func git(ctx context.Context, args ...string) (string, error) {
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+
+	err := runner.Run(ctx, runner.Cmd{
+		Name:   "git",
+		Args:   args,
+		Stdout: stdout,
+		Stderr: stderr,
+	})
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%w: %s", err, msg)
+		}
+		return "", err
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+func (r *Repo) init(ctx context.Context) error {
+	if _, err := os.Stat(r.dir); err == nil {
+		return nil
+	}
+
+	if err := os.MkdirAll(r.dir, 0o755); err != nil {
+		return err
+	}
+
+	_, err := r.git(ctx, "init", "--quiet", "--bare")
+	return err
+}
+
+// Fetch fetches refs from the remote into the same refs in the
+// cache, with their history but without any trees or blobs.
+func (r *Repo) Fetch(ctx context.Context, refs ...string) error {
+	return r.fetch(ctx, false, refs...)
+}
+
+// FetchLatest fetches only the commits refs point to, which is
+// enough to resolve them when their history isn't needed.
+func (r *Repo) FetchLatest(ctx context.Context, refs ...string) error {
+	return r.fetch(ctx, true, refs...)
+}
+
+func (r *Repo) fetch(ctx context.Context, latest bool, refs ...string) error {
+	if err := r.init(ctx); err != nil {
+		return err
+	}
+
+	args := []string{"fetch", "--quiet", "--filter=tree:0"}
+	if latest {
+		args = append(args, "--depth=1")
+	} else if shallow, _ := r.git(ctx, "rev-parse", "--is-shallow-repository"); shallow == "true" {
+		// Fetch the history left out by earlier shallow fetches
+		args = append(args, "--unshallow")
+	}
+	args = append(args, r.remote)
+	for _, ref := range refs {
+		args = append(args, "+"+ref+":"+ref)
+	}
+
+	_, err := r.git(ctx, args...)
+	return err
+}
+
+// Commit returns the commit a ref points to.
+func (r *Repo) Commit(ctx context.Context, ref string) (string, error) {
+	return r.git(ctx, "rev-parse", "--verify", "--quiet", ref+"^{commit}")
+}
+
+// CommitTime returns the commit time of a revision.
+func (r *Repo) CommitTime(ctx context.Context, rev string) (time.Time, error) {
+	out, err := r.git(ctx, "log", "-1", "--format=%ct", rev)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	ts, err := strconv.ParseInt(out, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Unix(ts, 0), nil
+}
+
+// CountCommits returns the number of commits in to that are not
+// in from.
+func (r *Repo) CountCommits(ctx context.Context, from, to string) (int, error) {
+	out, err := r.git(ctx, "rev-list", "--count", from+".."+to)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(out)
+}
+
+// Tags returns the tags of the remote.
+func (r *Repo) Tags(ctx context.Context) ([]string, error) {
+	out, err := git(ctx, "ls-remote", "--tags", "--refs", r.remote)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := []string{}
+	for _, line := range strings.Split(out, "\n") {
+		_, ref, ok := strings.Cut(strings.TrimSpace(line), "\t")
+		if !ok {
+			continue
+		}
+		if tag, ok := strings.CutPrefix(ref, "refs/tags/"); ok {
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags, nil
+}
+
+// Latest returns the newest revision of the pin's branch, or
+// release tag, that has been fetched into the cache, without
+// fetching anything. It returns false if nothing is known.
+func (c *Cache) Latest(ctx context.Context, pin Pin) (string, bool) {
+	remote, err := pin.Remote()
+	if err != nil {
+		return "", false
+	}
+
+	repo := c.Repo(remote)
+	if _, err := os.Stat(repo.dir); err != nil {
+		return "", false
+	}
+
+	ref := pin.ref()
+	if pin.Type == "GitRelease" {
+		// The newest release tag fetched
+		out, err := repo.git(ctx, "tag", "--list")
+		if err != nil {
+			return "", false
+		}
+		tag, err := latestRelease(pin, strings.Fields(out))
+		if err != nil {
+			return "", false
+		}
+		ref = "refs/tags/" + tag
+	}
+
+	rev, err := repo.Commit(ctx, ref)
+	if err != nil {
+		return "", false
+	}
+
+	return rev, true
+}
+
+// LockTime returns when the pin was locked to its revision,
+// which is the time of the commit of the project that added the
+// revision to the sources file. Changes that are not committed
+// yet fall back to the modification time of the file.
+func LockTime(ctx context.Context, sources string, pin Pin) (time.Time, error) {
+	dir, file := filepath.Split(sources)
+	if dir == "" {
+		dir = "."
+	}
+
+	out, err := git(ctx, "-C", dir, "log", "-1", "--format=%ct", "-S", pin.Revision, "--", file)
+	if err == nil && out != "" {
+		ts, err := strconv.ParseInt(out, 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Unix(ts, 0), nil
+	}
+
+	info, err := os.Stat(sources)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
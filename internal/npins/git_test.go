@@ -0,0 +1,58 @@
+package npins
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCacheLatest(t *testing.T) {
+	repo := newTestRepo(t)
+	old := repo.Commit("first")
+	repo.git("tag", "v1.0.0")
+	latest := repo.Commit("second")
+	repo.git("tag", "v1.1.0")
+
+	pins := []Pin{
+		{
+			Name:       "branch",
+			Type:       "Git",
+			Repository: Repository{Type: "Git", URL: repo.dir},
+			Branch:     "main",
+			Revision:   old,
+		},
+		{
+			Name:       "release",
+			Type:       "GitRelease",
+			Repository: Repository{Type: "Git", URL: repo.dir},
+			Version:    "v1.0.0",
+			Revision:   old,
+		},
+	}
+
+	cache := NewCache(t.TempDir())
+	for _, pin := range pins {
+		if _, ok := cache.Latest(context.Background(), pin); ok {
+			t.Errorf("no revision of %s was expected to be known before fetching", pin.Name)
+		}
+	}
+
+	for _, pin := range pins {
+		if _, err := Resolve(context.Background(), cache, pin); err != nil {
+			t.Fatalf("failed to resolve %s: %s", pin.Name, err)
+		}
+
+		rev, ok := cache.Latest(context.Background(), pin)
+		if !ok {
+			t.Errorf("a revision of %s was expected to be known after fetching", pin.Name)
+		}
+		if rev != latest {
+			t.Errorf("latest known revision of %s is '%s' but '%s' was expected", pin.Name, rev, latest)
+		}
+	}
+
+	// Nothing is known about pins of other repositories
+	other := Pin{Type: "Git", Repository: Repository{Type: "Git", URL: t.TempDir()}, Branch: "main"}
+	if _, ok := cache.Latest(context.Background(), other); ok {
+		t.Error("no revision was expected to be known of another repository")
+	}
+}
@@ -0,0 +1,48 @@
+package npins
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// nix32Alphabet is the alphabet of nix's base32 encoding, which
+// omits e, o, u and t.
+const nix32Alphabet = "0123456789abcdfghijklmnpqrsvwxyz"
+
+// EncodeNix32 encodes bytes in nix's base32 encoding.
+func EncodeNix32(b []byte) string {
+	n := (len(b)*8-1)/5 + 1
+	out := make([]byte, n)
+
+	for i := n - 1; i >= 0; i-- {
+		bit := i * 5
+		j := bit / 8
+		k := bit % 8
+
+		c := int(b[j]) >> k
+		if j+1 < len(b) {
+			c |= int(b[j+1]) << (8 - k)
+		}
+
+		out[n-1-i] = nix32Alphabet[c&0x1f]
+	}
+
+	return string(out)
+}
+
+// SRIToNix32 converts a sha256 hash in SRI format, as printed by
+// nix, to the nix base32 format used in sources files.
+func SRIToNix32(sri string) (string, error) {
+	algo, hash, ok := strings.Cut(sri, "-")
+	if !ok || algo != "sha256" {
+		return "", fmt.Errorf("unsupported hash %q", sri)
+	}
+
+	b, err := base64.StdEncoding.DecodeString(hash)
+	if err != nil {
+		return "", fmt.Errorf("invalid hash %q: %w", sri, err)
+	}
+
+	return EncodeNix32(b), nil
+}
@@ -0,0 +1,35 @@
+package npins
+
+import "testing"
+
+func TestSRIToNix32(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		err      bool
+	}{
+		// sha256 of the empty string
+		{
+			input:    "sha256-47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=",
+			expected: "0mdqa9w1p6cmli6976v4wi0sw9r4p5prkj7lzfd1877wk11c9c73",
+		},
+		{input: "sha512-47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=", err: true},
+		{input: "sha256-not base64", err: true},
+	}
+
+	for _, test := range tests {
+		res, err := SRIToNix32(test.input)
+		if test.err {
+			if err == nil {
+				t.Errorf("SRIToNix32(\"%s\") was expected to fail", test.input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("SRIToNix32(\"%s\") failed: %s", test.input, err)
+		}
+		if res != test.expected {
+			t.Errorf("SRIToNix32(\"%s\") is '%s' but '%s' was expected", test.input, res, test.expected)
+		}
+	}
+}
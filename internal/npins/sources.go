@@ -0,0 +1,167 @@
+// Package npins reads and updates the pinned sources of an
+// npins sources file.
+package npins
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/valyala/fastjson"
+)
+
+// DefaultSources is where npins keeps its sources file by default.
+const DefaultSources = "npins/sources.json"
+
+type Repository struct {
+	Type string `json:"type"`
+
+	// GitHub
+	Owner string `json:"owner"`
+	Repo  string `json:"repo"`
+
+	// GitLab
+	Server   string `json:"server"`
+	RepoPath string `json:"repo_path"`
+
+	// Git
+	URL string `json:"url"`
+}
+
+type Pin struct {
+	Name string `json:"-"`
+
+	Type       string     `json:"type"`
+	Repository Repository `json:"repository"`
+	Submodules bool       `json:"submodules"`
+
+	// Git
+	Branch string `json:"branch"`
+
+	// GitRelease
+	PreReleases       bool   `json:"pre_releases"`
+	VersionUpperBound string `json:"version_upper_bound"`
+	ReleasePrefix     string `json:"release_prefix"`
+	Version           string `json:"version"`
+
+	Revision string `json:"revision"`
+	URL      string `json:"url"`
+	Hash     string `json:"hash"`
+}
+
+// Sources is a parsed sources file. It's updated in place so
+// that the order of keys and unknown fields are kept when saved.
+type Sources struct {
+	parser *fastjson.Parser
+	arena  *fastjson.Arena
+	value  *fastjson.Value
+
+	pins map[string]Pin
+}
+
+// Load reads an npins sources file.
+func Load(path string) (*Sources, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(data)
+}
+
+// Parse parses the contents of an npins sources file.
+func Parse(data []byte) (*Sources, error) {
+	s := &Sources{
+		parser: &fastjson.Parser{},
+		arena:  &fastjson.Arena{},
+	}
+
+	var err error
+	if s.value, err = s.parser.ParseBytes(data); err != nil {
+		return nil, fmt.Errorf("invalid sources file: %w", err)
+	}
+
+	var raw struct {
+		Pins map[string]Pin `json:"pins"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid sources file: %w", err)
+	}
+
+	s.pins = map[string]Pin{}
+	for name, pin := range raw.Pins {
+		pin.Name = name
+		s.pins[name] = pin
+	}
+
+	return s, nil
+}
+
+// Pins returns all pins sorted by name.
+func (s *Sources) Pins() []Pin {
+	pins := []Pin{}
+	for _, pin := range s.pins {
+		pins = append(pins, pin)
+	}
+
+	slices.SortFunc(pins, func(a, b Pin) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return pins
+}
+
+// Pin returns the pin with the name.
+func (s *Sources) Pin(name string) (Pin, bool) {
+	pin, ok := s.pins[name]
+	return pin, ok
+}
+
+// Set replaces the locked fields of a pin.
+func (s *Sources) Set(pin Pin) error {
+	v := s.value.Get("pins", pin.Name)
+	if v == nil {
+		return fmt.Errorf("pin %q not found", pin.Name)
+	}
+
+	str := func(val string) *fastjson.Value {
+		if val == "" {
+			return s.arena.NewNull()
+		}
+		return s.arena.NewString(val)
+	}
+
+	if v.Exists("version") {
+		v.Set("version", str(pin.Version))
+	}
+	v.Set("revision", str(pin.Revision))
+	v.Set("url", str(pin.URL))
+	v.Set("hash", str(pin.Hash))
+
+	s.pins[pin.Name] = pin
+	return nil
+}
+
+// Marshal returns the sources file indented like npins does.
+func (s *Sources) Marshal() ([]byte, error) {
+	b := &bytes.Buffer{}
+	if err := json.Indent(b, s.value.MarshalTo(nil), "", "  "); err != nil {
+		return nil, err
+	}
+	b.WriteString("\n")
+
+	return b.Bytes(), nil
+}
+
+// Save writes the sources file to path.
+func (s *Sources) Save(path string) error {
+	data, err := s.Marshal()
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0o644)
+}
@@ -0,0 +1,64 @@
+package npins
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSourcesRoundTrip(t *testing.T) {
+	data, err := os.ReadFile("../../npins/sources.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := Parse(data)
+	if err != nil {
+		t.Fatalf("failed to parse sources: %s", err)
+	}
+
+	out, err := s.Marshal()
+	if err != nil {
+		t.Fatalf("failed to marshal sources: %s", err)
+	}
+
+	if string(out) != string(data) {
+		t.Errorf("marshalled sources are\n%s\nbut\n%s\nwas expected", out, data)
+	}
+}
+
+func TestSourcesSet(t *testing.T) {
+	data, err := os.ReadFile("../../npins/sources.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := Parse(data)
+	if err != nil {
+		t.Fatalf("failed to parse sources: %s", err)
+	}
+
+	pin, ok := s.Pin("nilla")
+	if !ok {
+		t.Fatal("pin 'nilla' not found")
+	}
+	if pin.Branch != "main" || pin.Repository.Owner != "nilla-nix" {
+		t.Errorf("pin 'nilla' was not parsed correctly: %+v", pin)
+	}
+
+	pin.Revision = "0000000000000000000000000000000000000000"
+	pin.URL = "https://github.com/nilla-nix/nilla/archive/0000000000000000000000000000000000000000.tar.gz"
+	if err := s.Set(pin); err != nil {
+		t.Fatalf("failed to set pin: %s", err)
+	}
+
+	out, err := s.Marshal()
+	if err != nil {
+		t.Fatalf("failed to marshal sources: %s", err)
+	}
+
+	expected := strings.ReplaceAll(string(data), "6747fe62879d7d15c96808bc370a52941287772c", pin.Revision)
+	if string(out) != expected {
+		t.Errorf("marshalled sources are\n%s\nbut\n%s\nwas expected", out, expected)
+	}
+}
@@ -0,0 +1,244 @@
+package npins
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrUnsupportedPin = errors.New("unsupported pin type")
+	errNoReleases     = errors.New("no matching releases found")
+)
+
+// Remote returns the git remote of the pin's repository.
+func (p Pin) Remote() (string, error) {
+	switch p.Repository.Type {
+	case "GitHub":
+		return fmt.Sprintf("https://github.com/%s/%s.git", p.Repository.Owner, p.Repository.Repo), nil
+	case "GitLab":
+		return fmt.Sprintf("%s%s.git", p.Repository.Server, p.Repository.RepoPath), nil
+	case "Git":
+		return p.Repository.URL, nil
+	}
+	return "", fmt.Errorf("%w: repository type %q", ErrUnsupportedPin, p.Repository.Type)
+}
+
+// ref returns the git ref the pin is locked from.
+func (p Pin) ref() string {
+	if p.Type == "GitRelease" {
+		return "refs/tags/" + p.Version
+	}
+	return "refs/heads/" + p.Branch
+}
+
+// tarballURL returns the URL of the tarball npins fetches for the
+// pin, or an empty string if the pin is fetched with git.
+func (p Pin) tarballURL() string {
+	if p.Submodules {
+		return ""
+	}
+
+	ref := p.Revision
+	if p.Type == "GitRelease" {
+		ref = p.Version
+	}
+
+	switch p.Repository.Type {
+	case "GitHub":
+		if p.Type == "GitRelease" {
+			return fmt.Sprintf("https://api.github.com/repos/%s/%s/tarball/%s", p.Repository.Owner, p.Repository.Repo, ref)
+		}
+		return fmt.Sprintf("https://github.com/%s/%s/archive/%s.tar.gz", p.Repository.Owner, p.Repository.Repo, ref)
+	case "GitLab":
+		return fmt.Sprintf(
+			"%sapi/v4/projects/%s/repository/archive.tar.gz?sha=%s",
+			p.Repository.Server, url.PathEscape(p.Repository.RepoPath), ref,
+		)
+	}
+
+	return ""
+}
+
+// PrefetchRef returns the flake reference that fetches the same
+// source as npins does for the pin.
+func (p Pin) PrefetchRef() (string, error) {
+	if p.URL != "" {
+		return "tarball+" + p.URL, nil
+	}
+
+	remote, err := p.Remote()
+	if err != nil {
+		return "", err
+	}
+	if strings.HasPrefix(remote, "/") {
+		remote = "file://" + remote
+	}
+
+	q := url.Values{}
+	q.Set("rev", p.Revision)
+	q.Set("ref", p.ref())
+	if p.Submodules {
+		q.Set("submodules", "1")
+	}
+
+	return fmt.Sprintf("git+%s?%s", remote, q.Encode()), nil
+}
+
+// Update is a pin resolved to the latest revision. The hash of
+// the new pin is only known after prefetching it.
+type Update struct {
+	Old Pin
+	New Pin
+
+	// Commit time of the new revision
+	Date time.Time
+	// Number of commits between the revisions, or -1
+	// if it's not known
+	Commits int
+}
+
+// Changed returns true if the pin was updated.
+func (u Update) Changed() bool {
+	return u.Old.Revision != u.New.Revision
+}
+
+// Resolve finds the latest revision of a pin, using the cache to
+// fetch commits of the pin's repository.
+func Resolve(ctx context.Context, cache *Cache, pin Pin) (Update, error) {
+	remote, err := pin.Remote()
+	if err != nil {
+		return Update{}, err
+	}
+	repo := cache.Repo(remote)
+
+	next := pin
+	switch pin.Type {
+	case "Git":
+	case "GitRelease":
+		tags, err := repo.Tags(ctx)
+		if err != nil {
+			return Update{}, err
+		}
+		if next.Version, err = latestRelease(pin, tags); err != nil {
+			return Update{}, err
+		}
+	default:
+		return Update{}, fmt.Errorf("%w: %q", ErrUnsupportedPin, pin.Type)
+	}
+
+	if err := repo.FetchLatest(ctx, next.ref()); err != nil {
+		return Update{}, err
+	}
+	if next.Revision, err = repo.Commit(ctx, next.ref()); err != nil {
+		return Update{}, err
+	}
+
+	u := Update{Old: pin, New: next}
+	if !u.Changed() {
+		return u, nil
+	}
+
+	// The hash has to be prefetched again
+	u.New.URL = next.tarballURL()
+	u.New.Hash = ""
+
+	if u.Date, err = repo.CommitTime(ctx, next.Revision); err != nil {
+		return Update{}, err
+	}
+
+	// Counting commits needs the history between the revisions.
+	// The old revision may not be an ancestor of the new one,
+	// e.g. after a force push
+	u.Commits = -1
+	if err := repo.Fetch(ctx, next.ref()); err == nil {
+		if n, err := repo.CountCommits(ctx, pin.Revision, next.Revision); err == nil {
+			u.Commits = n
+		}
+	}
+
+	return u, nil
+}
+
+// version is a parsed release version, like 1.2.3 or 1.2.3-rc.1.
+type version struct {
+	parts []int
+	pre   string
+}
+
+func parseVersion(s string) (version, bool) {
+	s = strings.TrimPrefix(s, "v")
+
+	core, pre, _ := strings.Cut(s, "-")
+	v := version{pre: pre}
+	for _, p := range strings.Split(core, ".") {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return version{}, false
+		}
+		v.parts = append(v.parts, n)
+	}
+
+	return v, true
+}
+
+func compareVersions(a, b version) int {
+	if c := slices.Compare(a.parts, b.parts); c != 0 {
+		return c
+	}
+
+	// A release is newer than its pre-releases
+	switch {
+	case a.pre == b.pre:
+		return 0
+	case a.pre == "":
+		return 1
+	case b.pre == "":
+		return -1
+	}
+	return cmp.Compare(a.pre, b.pre)
+}
+
+// latestRelease returns the newest tag that the pin's settings
+// allow updating to.
+func latestRelease(pin Pin, tags []string) (string, error) {
+	var bound *version
+	if pin.VersionUpperBound != "" {
+		if v, ok := parseVersion(pin.VersionUpperBound); ok {
+			bound = &v
+		}
+	}
+
+	latest := ""
+	var lv version
+	for _, tag := range tags {
+		s, ok := strings.CutPrefix(tag, pin.ReleasePrefix)
+		if !ok {
+			continue
+		}
+
+		v, ok := parseVersion(s)
+		if !ok || (v.pre != "" && !pin.PreReleases) {
+			continue
+		}
+		if bound != nil && compareVersions(v, *bound) >= 0 {
+			continue
+		}
+
+		if latest == "" || compareVersions(v, lv) > 0 {
+			latest, lv = tag, v
+		}
+	}
+
+	if latest == "" {
+		return "", errNoReleases
+	}
+
+	return latest, nil
+}
@@ -0,0 +1,186 @@
+package npins
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestLatestRelease(t *testing.T) {
+	tags := []string{"v1.2.0", "v1.10.0", "v1.11.0-rc.1", "v2.0.0", "release-3.0.0", "nightly"}
+
+	tests := []struct {
+		pin      Pin
+		expected string
+		err      bool
+	}{
+		{pin: Pin{}, expected: "v2.0.0"},
+		{pin: Pin{VersionUpperBound: "2.0.0"}, expected: "v1.10.0"},
+		{pin: Pin{VersionUpperBound: "2.0.0", PreReleases: true}, expected: "v1.11.0-rc.1"},
+		{pin: Pin{ReleasePrefix: "release-"}, expected: "release-3.0.0"},
+		{pin: Pin{ReleasePrefix: "stable-"}, err: true},
+	}
+
+	for _, test := range tests {
+		res, err := latestRelease(test.pin, tags)
+		if test.err {
+			if err == nil {
+				t.Errorf("latestRelease(%+v) was expected to fail", test.pin)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("latestRelease(%+v) failed: %s", test.pin, err)
+		}
+		if res != test.expected {
+			t.Errorf("latestRelease(%+v) is '%s' but '%s' was expected", test.pin, res, test.expected)
+		}
+	}
+}
+
+// testRepo is a local git repository used as the source of pins.
+type testRepo struct {
+	t   *testing.T
+	dir string
+}
+
+func newTestRepo(t *testing.T) *testRepo {
+	t.Helper()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+
+	t.Setenv("GIT_AUTHOR_NAME", "lila")
+	t.Setenv("GIT_AUTHOR_EMAIL", "lila@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "lila")
+	t.Setenv("GIT_COMMITTER_EMAIL", "lila@example.com")
+
+	r := &testRepo{t, t.TempDir()}
+	r.git("init", "--quiet", "--initial-branch", "main")
+	return r
+}
+
+func (r *testRepo) git(args ...string) string {
+	r.t.Helper()
+
+	out, err := exec.Command("git", append([]string{"-C", r.dir}, args...)...).CombinedOutput()
+	if err != nil {
+		r.t.Fatalf("git %s failed: %s\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// Commit creates an empty commit and returns its revision.
+func (r *testRepo) Commit(msg string) string {
+	r.t.Helper()
+
+	r.git("commit", "--quiet", "--allow-empty", "-m", msg)
+	return r.git("rev-parse", "HEAD")
+}
+
+func TestResolveGit(t *testing.T) {
+	repo := newTestRepo(t)
+	old := repo.Commit("first")
+	repo.Commit("second")
+	latest := repo.Commit("third")
+
+	pin := Pin{
+		Name:       "test",
+		Type:       "Git",
+		Repository: Repository{Type: "Git", URL: repo.dir},
+		Branch:     "main",
+		Revision:   old,
+		Hash:       "0mdqa9w1p6cmli6976v4wi0sw9r4p5prkj7lzfd1877wk11c9c73",
+	}
+
+	u, err := Resolve(context.Background(), NewCache(t.TempDir()), pin)
+	if err != nil {
+		t.Fatalf("failed to resolve pin: %s", err)
+	}
+
+	if !u.Changed() {
+		t.Fatal("pin was expected to change")
+	}
+	if u.New.Revision != latest {
+		t.Errorf("new revision is '%s' but '%s' was expected", u.New.Revision, latest)
+	}
+	if u.Commits != 2 {
+		t.Errorf("commit count is %d but 2 was expected", u.Commits)
+	}
+	if u.New.Hash != "" || u.New.URL != "" {
+		t.Errorf("hash and URL of a git pin were expected to be cleared: %+v", u.New)
+	}
+	if u.Date.IsZero() {
+		t.Error("commit date was expected to be set")
+	}
+
+	ref, err := u.New.PrefetchRef()
+	if err != nil {
+		t.Fatalf("failed to get prefetch ref: %s", err)
+	}
+	expected := "git+file://" + repo.dir + "?ref=refs%2Fheads%2Fmain&rev=" + latest
+	if ref != expected {
+		t.Errorf("prefetch ref is '%s' but '%s' was expected", ref, expected)
+	}
+}
+
+func TestResolveGitRelease(t *testing.T) {
+	repo := newTestRepo(t)
+	old := repo.Commit("first")
+	repo.git("tag", "v1.0.0")
+	latest := repo.Commit("second")
+	repo.git("tag", "-a", "-m", "v1.1.0", "v1.1.0")
+	repo.Commit("third")
+	repo.git("tag", "v1.2.0-rc.1")
+
+	pin := Pin{
+		Name:       "test",
+		Type:       "GitRelease",
+		Repository: Repository{Type: "Git", URL: repo.dir},
+		Version:    "v1.0.0",
+		Revision:   old,
+	}
+
+	u, err := Resolve(context.Background(), NewCache(t.TempDir()), pin)
+	if err != nil {
+		t.Fatalf("failed to resolve pin: %s", err)
+	}
+
+	if u.New.Version != "v1.1.0" {
+		t.Errorf("new version is '%s' but 'v1.1.0' was expected", u.New.Version)
+	}
+	if u.New.Revision != latest {
+		t.Errorf("new revision is '%s' but '%s' was expected", u.New.Revision, latest)
+	}
+	if u.Commits != 1 {
+		t.Errorf("commit count is %d but 1 was expected", u.Commits)
+	}
+}
+
+func TestResolveUpToDate(t *testing.T) {
+	repo := newTestRepo(t)
+	latest := repo.Commit("first")
+
+	pin := Pin{
+		Name:       "test",
+		Type:       "Git",
+		Repository: Repository{Type: "Git", URL: repo.dir},
+		Branch:     "main",
+		Revision:   latest,
+		Hash:       "0mdqa9w1p6cmli6976v4wi0sw9r4p5prkj7lzfd1877wk11c9c73",
+	}
+
+	u, err := Resolve(context.Background(), NewCache(t.TempDir()), pin)
+	if err != nil {
+		t.Fatalf("failed to resolve pin: %s", err)
+	}
+
+	if u.Changed() {
+		t.Error("pin was not expected to change")
+	}
+	if u.New.Hash != pin.Hash {
+		t.Errorf("hash is '%s' but '%s' was expected", u.New.Hash, pin.Hash)
+	}
+}
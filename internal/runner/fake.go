@@ -0,0 +1,142 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Response is a scripted response to a command, matching on the
+// name and a prefix of the arguments of the command.
+type Response struct {
+	Name string   `json:"name"`
+	Args []string `json:"args"`
+
+	Stdout   string `json:"stdout,omitempty"`
+	Stderr   string `json:"stderr,omitempty"`
+	ExitCode int    `json:"exitCode,omitempty"`
+}
+
+func (r Response) matches(cmd Cmd) bool {
+	return r.Name == cmd.Name &&
+		len(cmd.Args) >= len(r.Args) &&
+		slices.Equal(r.Args, cmd.Args[:len(r.Args)])
+}
+
+// Fake is a scripted Runner. Every command is answered by the first
+// unused response matching it, and every command is recorded.
+type Fake struct {
+	mu sync.Mutex
+
+	responses []Response
+	used      []bool
+	calls     []Cmd
+}
+
+func NewFake(responses ...Response) *Fake {
+	return &Fake{
+		responses: responses,
+		used:      make([]bool, len(responses)),
+	}
+}
+
+// LoadFixtures creates a Fake from responses recorded by Recorder.
+func LoadFixtures(path string) (*Fake, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	responses := []Response{}
+	if err := json.Unmarshal(data, &responses); err != nil {
+		return nil, err
+	}
+
+	return NewFake(responses...), nil
+}
+
+func (f *Fake) Run(ctx context.Context, cmd Cmd) error {
+	res, err := f.respond(cmd)
+	if err != nil {
+		return err
+	}
+
+	if cmd.Stderr != nil {
+		if _, err := io.WriteString(cmd.Stderr, res.Stderr); err != nil {
+			return err
+		}
+	}
+	if cmd.Stdout != nil {
+		if _, err := io.WriteString(cmd.Stdout, res.Stdout); err != nil {
+			return err
+		}
+	}
+
+	if res.ExitCode != 0 {
+		return &ExitError{res.ExitCode}
+	}
+
+	return nil
+}
+
+func (f *Fake) Exec(cmd Cmd) error {
+	res, err := f.respond(cmd)
+	if err != nil {
+		return err
+	}
+
+	if res.ExitCode != 0 {
+		return &ExitError{res.ExitCode}
+	}
+
+	return nil
+}
+
+func (f *Fake) respond(cmd Cmd) (Response, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls = append(f.calls, cmd)
+
+	for i, res := range f.responses {
+		if !f.used[i] && res.matches(cmd) {
+			f.used[i] = true
+			return res, nil
+		}
+	}
+
+	return Response{}, fmt.Errorf("unexpected command: %s", FormatCmd(cmd))
+}
+
+// Calls returns all commands run so far.
+func (f *Fake) Calls() []Cmd {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return slices.Clone(f.calls)
+}
+
+// Unused returns the responses that were never used.
+func (f *Fake) Unused() []Response {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	unused := []Response{}
+	for i, res := range f.responses {
+		if !f.used[i] {
+			unused = append(unused, res)
+		}
+	}
+
+	return unused
+}
+
+// FormatCmd formats a command for display.
+func FormatCmd(cmd Cmd) string {
+	return strings.Join(append([]string{cmd.Name}, cmd.Args...), " ")
+}
@@ -0,0 +1,91 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"slices"
+	"sync"
+)
+
+// Recorder wraps a Runner and records every command it runs,
+// along with its output, as fixtures that can be replayed with
+// LoadFixtures.
+type Recorder struct {
+	runner Runner
+	path   string
+
+	mu        sync.Mutex
+	responses []Response
+}
+
+// NewRecorder creates a Recorder saving its fixtures to path.
+func NewRecorder(r Runner, path string) *Recorder {
+	return &Recorder{runner: r, path: path}
+}
+
+func (r *Recorder) Run(ctx context.Context, cmd Cmd) error {
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+
+	rcmd := cmd
+	rcmd.Stdout = tee(cmd.Stdout, stdout)
+	rcmd.Stderr = tee(cmd.Stderr, stderr)
+
+	err := r.runner.Run(ctx, rcmd)
+
+	res := Response{
+		Name:   cmd.Name,
+		Args:   slices.Clone(cmd.Args),
+		Stdout: stdout.String(),
+		Stderr: stderr.String(),
+	}
+	if code, ok := ExitCode(err); ok {
+		res.ExitCode = code
+	}
+
+	r.mu.Lock()
+	r.responses = append(r.responses, res)
+	r.mu.Unlock()
+
+	return err
+}
+
+func (r *Recorder) Exec(cmd Cmd) error {
+	r.mu.Lock()
+	r.responses = append(r.responses, Response{
+		Name: cmd.Name,
+		Args: slices.Clone(cmd.Args),
+	})
+	r.mu.Unlock()
+
+	// Exec never returns on success so fixtures
+	// have to be saved before
+	if err := r.Save(); err != nil {
+		return err
+	}
+
+	return r.runner.Exec(cmd)
+}
+
+// Save writes the recorded fixtures as JSON.
+func (r *Recorder) Save() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data, err := json.MarshalIndent(r.responses, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(r.path, append(data, '\n'), 0o644)
+}
+
+func tee(w io.Writer, b *bytes.Buffer) io.Writer {
+	if w == nil {
+		return b
+	}
+	return io.MultiWriter(w, b)
+}
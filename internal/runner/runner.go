@@ -0,0 +1,123 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// Cmd describes an external command to run.
+type Cmd struct {
+	Name string
+	Args []string
+	// Env holds extra environment variables in the form
+	// "KEY=value", on top of the current environment.
+	Env []string
+
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// Runner runs external commands.
+type Runner interface {
+	// Run runs the command and waits for it to exit.
+	Run(ctx context.Context, cmd Cmd) error
+	// Exec replaces the current process with the command.
+	Exec(cmd Cmd) error
+}
+
+// ExitError is returned by runners that don't run real
+// processes when a command exits with a non-zero exit code.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// ExitCode returns the exit code of a command that failed
+// with err, if it ran at all.
+func ExitCode(err error) (int, bool) {
+	var eerr *exec.ExitError
+	if errors.As(err, &eerr) {
+		return eerr.ExitCode(), true
+	}
+
+	var rerr *ExitError
+	if errors.As(err, &rerr) {
+		return rerr.Code, true
+	}
+
+	return 0, false
+}
+
+// Local runs commands as processes on the local machine.
+type Local struct{}
+
+func (Local) Run(ctx context.Context, cmd Cmd) error {
+	c := exec.CommandContext(ctx, cmd.Name, cmd.Args...)
+	if len(cmd.Env) > 0 {
+		c.Env = append(os.Environ(), cmd.Env...)
+	}
+	c.Stdin = cmd.Stdin
+	c.Stdout = cmd.Stdout
+	c.Stderr = cmd.Stderr
+
+	return c.Run()
+}
+
+func (Local) Exec(cmd Cmd) error {
+	// Find full path to the command
+	path, err := exec.LookPath(cmd.Name)
+	if err != nil {
+		return err
+	}
+
+	return syscall.Exec(
+		path,
+		append([]string{cmd.Name}, cmd.Args...),
+		append(os.Environ(), cmd.Env...),
+	)
+}
+
+type runnerKey struct{}
+
+// WithRunner returns a copy of ctx carrying r, to be used by
+// everything running external commands with that context.
+func WithRunner(ctx context.Context, r Runner) context.Context {
+	return context.WithValue(ctx, runnerKey{}, r)
+}
+
+// FromContext returns the runner carried by ctx, falling back
+// to Local.
+func FromContext(ctx context.Context) Runner {
+	if r, ok := ctx.Value(runnerKey{}).(Runner); ok {
+		return r
+	}
+	return Local{}
+}
+
+// Run runs cmd with the runner carried by ctx.
+func Run(ctx context.Context, cmd Cmd) error {
+	return FromContext(ctx).Run(ctx, cmd)
+}
+
+// Output runs cmd with the runner carried by ctx and returns
+// its standard output.
+func Output(ctx context.Context, cmd Cmd) ([]byte, error) {
+	b := &bytes.Buffer{}
+	cmd.Stdout = b
+
+	if err := Run(ctx, cmd); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
@@ -0,0 +1,54 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fixtures.json")
+
+	// Record commands run by a scripted runner
+	rec := NewRecorder(NewFake(
+		Response{Name: "nix", Args: []string{"eval"}, Stdout: "x86_64-linux"},
+		Response{Name: "false", ExitCode: 1},
+	), path)
+	ctx := WithRunner(context.Background(), rec)
+
+	if out, err := Output(ctx, Cmd{Name: "nix", Args: []string{"eval", "--raw"}}); err != nil || string(out) != "x86_64-linux" {
+		t.Fatalf("unexpected output '%s' (%v)", out, err)
+	}
+	if err := Run(ctx, Cmd{Name: "false"}); err == nil {
+		t.Fatal("expected command to fail")
+	}
+	if err := rec.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Replay recorded fixtures
+	fake, err := LoadFixtures(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx = WithRunner(context.Background(), fake)
+
+	stdout := &bytes.Buffer{}
+	if err := Run(ctx, Cmd{Name: "nix", Args: []string{"eval", "--raw"}, Stdout: stdout}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if stdout.String() != "x86_64-linux" {
+		t.Errorf("output is '%s' but '%s' was expected", stdout.String(), "x86_64-linux")
+	}
+
+	err = Run(ctx, Cmd{Name: "false"})
+	if code, ok := ExitCode(err); !ok || code != 1 {
+		t.Errorf("exit code is '%d' but '%d' was expected", code, 1)
+	}
+
+	// Recorded commands match on full arguments
+	if err := Run(ctx, Cmd{Name: "nix", Args: []string{"eval"}}); err == nil {
+		t.Error("expected unrecorded command to fail")
+	}
+}
@@ -0,0 +1,47 @@
+// Package runnertest runs lila commands in tests with external
+// commands run by a fake runner.
+package runnertest
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/arnarg/lila/internal/flags"
+	"github.com/arnarg/lila/internal/runner"
+	"github.com/urfave/cli/v2"
+)
+
+// Run runs the command with the arguments, and the global flags of
+// lila, with external commands run by r. Values carried by ctx,
+// such as a store, are available to the command.
+func Run(t *testing.T, ctx context.Context, r runner.Runner, cmd *cli.Command, args ...string) error {
+	t.Helper()
+	return RunWithInput(t, ctx, r, "", cmd, args...)
+}
+
+// RunWithInput is like Run but with input as the standard input
+// of the command, for answering prompts.
+func RunWithInput(t *testing.T, ctx context.Context, r runner.Runner, input string, cmd *cli.Command, args ...string) error {
+	t.Helper()
+
+	app := &cli.App{
+		Name:     "lila",
+		Reader:   strings.NewReader(input),
+		Flags:    flags.Global(),
+		Commands: cli.Commands{cmd},
+	}
+
+	ctx = runner.WithRunner(ctx, r)
+	return app.RunContext(ctx, append([]string{"lila", cmd.Name}, args...))
+}
+
+// AssertAllUsed fails the test for every response of fake that
+// no command was run for.
+func AssertAllUsed(t *testing.T, fake *runner.Fake) {
+	t.Helper()
+
+	for _, res := range fake.Unused() {
+		t.Errorf("expected command was never run: %s", runner.FormatCmd(runner.Cmd{Name: res.Name, Args: res.Args}))
+	}
+}
@@ -0,0 +1,494 @@
+package store
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultSocket is the default location of the nix-daemon socket.
+const DefaultSocket = "/nix/var/nix/daemon-socket/socket"
+
+const (
+	workerMagic1 = 0x6e697863
+	workerMagic2 = 0x6478696f
+
+	// Protocol version 1.35
+	protocolVersion = 1<<8 | 35
+	// Oldest protocol version the client is willing to speak
+	minProtocolVersion = 1<<8 | 10
+)
+
+const (
+	opIsValidPath     = 1
+	opQueryReferrers  = 6
+	opFindRoots       = 14
+	opQueryPathInfo   = 26
+	opQueryValidPaths = 31
+)
+
+const (
+	stderrNext          = 0x6f6c6d67
+	stderrRead          = 0x64617461
+	stderrWrite         = 0x64617416
+	stderrLast          = 0x616c7473
+	stderrError         = 0x63787470
+	stderrStartActivity = 0x53545254
+	stderrStopActivity  = 0x53544f50
+	stderrResult        = 0x52534c54
+)
+
+const (
+	fieldTypeInt    = 0
+	fieldTypeString = 1
+)
+
+var errProtocolMismatch = errors.New("nix daemon protocol mismatch")
+
+// DaemonError is an error reported by the nix daemon.
+type DaemonError struct {
+	Message string
+	Traces  []string
+}
+
+func (e *DaemonError) Error() string {
+	return e.Message
+}
+
+// DaemonStore is a Store backed by a connection to the nix daemon,
+// speaking the worker protocol.
+type DaemonStore struct {
+	mu      sync.Mutex
+	conn    net.Conn
+	r       *reader
+	w       *writer
+	bw      *bufio.Writer
+	version uint64
+}
+
+// Connect connects to the nix daemon at the socket set in
+// NIX_DAEMON_SOCKET_PATH, or DefaultSocket.
+func Connect(ctx context.Context) (*DaemonStore, error) {
+	socket := os.Getenv("NIX_DAEMON_SOCKET_PATH")
+	if socket == "" {
+		socket = DefaultSocket
+	}
+
+	d := net.Dialer{}
+	conn, err := d.DialContext(ctx, "unix", socket)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewDaemonStore(ctx, conn)
+}
+
+// NewDaemonStore performs the worker protocol handshake on conn.
+func NewDaemonStore(ctx context.Context, conn net.Conn) (*DaemonStore, error) {
+	bw := bufio.NewWriter(conn)
+	s := &DaemonStore{
+		conn: conn,
+		r:    &reader{r: bufio.NewReader(conn)},
+		w:    &writer{w: bw},
+		bw:   bw,
+	}
+
+	if err := s.withContext(ctx, s.handshake); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *DaemonStore) handshake() error {
+	s.w.uint64(workerMagic1)
+	if err := s.flush(); err != nil {
+		return err
+	}
+
+	magic, err := s.r.uint64()
+	if err != nil {
+		return err
+	}
+	if magic != workerMagic2 {
+		return errProtocolMismatch
+	}
+
+	daemonVersion, err := s.r.uint64()
+	if err != nil {
+		return err
+	}
+	if daemonVersion>>8 != protocolVersion>>8 || daemonVersion < minProtocolVersion {
+		return fmt.Errorf(
+			"unsupported nix daemon protocol version %d.%d",
+			daemonVersion>>8, daemonVersion&0xff,
+		)
+	}
+
+	s.version = min(daemonVersion, protocolVersion)
+	s.w.uint64(protocolVersion)
+
+	// Obsolete CPU affinity
+	if s.minor() >= 14 {
+		s.w.uint64(0)
+	}
+	// Obsolete reserveSpace
+	if s.minor() >= 11 {
+		s.w.bool(false)
+	}
+	if err := s.flush(); err != nil {
+		return err
+	}
+
+	// Daemon's nix version
+	if s.minor() >= 33 {
+		if _, err := s.r.string(); err != nil {
+			return err
+		}
+	}
+	// Whether the daemon trusts us
+	if s.minor() >= 35 {
+		if _, err := s.r.uint64(); err != nil {
+			return err
+		}
+	}
+
+	return s.processStderr()
+}
+
+func (s *DaemonStore) minor() uint64 {
+	return s.version & 0xff
+}
+
+func (s *DaemonStore) flush() error {
+	if s.w.err != nil {
+		return s.w.err
+	}
+	return s.bw.Flush()
+}
+
+// withContext runs fn while making sure that cancellation of ctx
+// interrupts any blocked reads or writes on the connection.
+func (s *DaemonStore) withContext(ctx context.Context, fn func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	deadline, _ := ctx.Deadline()
+	if err := s.conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+
+	stop := context.AfterFunc(ctx, func() {
+		s.conn.SetDeadline(time.Unix(1, 0))
+	})
+	defer stop()
+
+	if err := fn(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+
+	return nil
+}
+
+// op sends an operation with its arguments and waits for the
+// daemon to finish working on it, before calling result to read
+// the response.
+func (s *DaemonStore) op(ctx context.Context, op uint64, args func(w *writer), result func(r *reader) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.withContext(ctx, func() error {
+		s.w.uint64(op)
+		if args != nil {
+			args(s.w)
+		}
+		if err := s.flush(); err != nil {
+			return err
+		}
+
+		if err := s.processStderr(); err != nil {
+			return err
+		}
+
+		return result(s.r)
+	})
+}
+
+// processStderr reads log messages from the daemon until it
+// signals that it's done working.
+func (s *DaemonStore) processStderr() error {
+	for {
+		msg, err := s.r.uint64()
+		if err != nil {
+			return err
+		}
+
+		switch msg {
+		case stderrLast:
+			return nil
+
+		case stderrError:
+			return s.readError()
+
+		case stderrNext, stderrWrite:
+			if _, err := s.r.bytes(); err != nil {
+				return err
+			}
+
+		case stderrStartActivity:
+			// id, level and type
+			for range 3 {
+				if _, err := s.r.uint64(); err != nil {
+					return err
+				}
+			}
+			// text
+			if _, err := s.r.bytes(); err != nil {
+				return err
+			}
+			if err := s.r.fields(); err != nil {
+				return err
+			}
+			// parent
+			if _, err := s.r.uint64(); err != nil {
+				return err
+			}
+
+		case stderrStopActivity:
+			if _, err := s.r.uint64(); err != nil {
+				return err
+			}
+
+		case stderrResult:
+			// id and type
+			for range 2 {
+				if _, err := s.r.uint64(); err != nil {
+					return err
+				}
+			}
+			if err := s.r.fields(); err != nil {
+				return err
+			}
+
+		case stderrRead:
+			// None of the supported operations send data
+			return fmt.Errorf("nix daemon unexpectedly requested data")
+
+		default:
+			return fmt.Errorf("unknown message type 0x%x from nix daemon", msg)
+		}
+	}
+}
+
+func (s *DaemonStore) readError() error {
+	if s.minor() < 26 {
+		msg, err := s.r.string()
+		if err != nil {
+			return err
+		}
+		// Exit status
+		if _, err := s.r.uint64(); err != nil {
+			return err
+		}
+		return &DaemonError{Message: msg}
+	}
+
+	// Type, level and name
+	if _, err := s.r.string(); err != nil {
+		return err
+	}
+	if _, err := s.r.uint64(); err != nil {
+		return err
+	}
+	if _, err := s.r.string(); err != nil {
+		return err
+	}
+
+	msg, err := s.r.string()
+	if err != nil {
+		return err
+	}
+
+	// Position is never sent
+	if _, err := s.r.uint64(); err != nil {
+		return err
+	}
+
+	n, err := s.r.uint64()
+	if err != nil {
+		return err
+	}
+
+	traces := []string{}
+	for range n {
+		if _, err := s.r.uint64(); err != nil {
+			return err
+		}
+		trace, err := s.r.string()
+		if err != nil {
+			return err
+		}
+		traces = append(traces, trace)
+	}
+
+	return &DaemonError{Message: msg, Traces: traces}
+}
+
+func (s *DaemonStore) IsValidPath(ctx context.Context, path string) (bool, error) {
+	var valid bool
+	err := s.op(ctx, opIsValidPath,
+		func(w *writer) {
+			w.string(path)
+		},
+		func(r *reader) (err error) {
+			valid, err = r.bool()
+			return
+		},
+	)
+	return valid, err
+}
+
+func (s *DaemonStore) QueryValidPaths(ctx context.Context, paths []string) ([]string, error) {
+	var valid []string
+	err := s.op(ctx, opQueryValidPaths,
+		func(w *writer) {
+			w.strings(paths)
+			// Don't try to substitute paths
+			if s.minor() >= 27 {
+				w.bool(false)
+			}
+		},
+		func(r *reader) (err error) {
+			valid, err = r.strings()
+			return
+		},
+	)
+	return valid, err
+}
+
+func (s *DaemonStore) QueryPathInfo(ctx context.Context, path string) (*PathInfo, error) {
+	var info *PathInfo
+	err := s.op(ctx, opQueryPathInfo,
+		func(w *writer) {
+			w.string(path)
+		},
+		func(r *reader) (err error) {
+			if s.minor() >= 17 {
+				valid, err := r.bool()
+				if err != nil {
+					return err
+				}
+				if !valid {
+					return ErrInvalidPath
+				}
+			}
+
+			info, err = s.readPathInfo(path)
+			return
+		},
+	)
+	if err != nil {
+		// Older daemons report invalid paths as errors
+		var derr *DaemonError
+		if errors.As(err, &derr) && strings.Contains(derr.Message, "is not valid") {
+			return nil, ErrInvalidPath
+		}
+		return nil, err
+	}
+	return info, nil
+}
+
+func (s *DaemonStore) readPathInfo(path string) (*PathInfo, error) {
+	var err error
+	info := &PathInfo{Path: path}
+
+	if info.Deriver, err = s.r.string(); err != nil {
+		return nil, err
+	}
+	if info.NarHash, err = s.r.string(); err != nil {
+		return nil, err
+	}
+	if info.References, err = s.r.strings(); err != nil {
+		return nil, err
+	}
+
+	regTime, err := s.r.uint64()
+	if err != nil {
+		return nil, err
+	}
+	info.RegistrationTime = time.Unix(int64(regTime), 0)
+
+	if info.NarSize, err = s.r.uint64(); err != nil {
+		return nil, err
+	}
+
+	if s.minor() >= 16 {
+		if info.Ultimate, err = s.r.bool(); err != nil {
+			return nil, err
+		}
+		if info.Signatures, err = s.r.strings(); err != nil {
+			return nil, err
+		}
+		if info.CA, err = s.r.string(); err != nil {
+			return nil, err
+		}
+	}
+
+	return info, nil
+}
+
+func (s *DaemonStore) QueryReferrers(ctx context.Context, path string) ([]string, error) {
+	var referrers []string
+	err := s.op(ctx, opQueryReferrers,
+		func(w *writer) {
+			w.string(path)
+		},
+		func(r *reader) (err error) {
+			referrers, err = r.strings()
+			return
+		},
+	)
+	return referrers, err
+}
+
+func (s *DaemonStore) FindRoots(ctx context.Context) (map[string]string, error) {
+	roots := map[string]string{}
+	err := s.op(ctx, opFindRoots, nil,
+		func(r *reader) error {
+			n, err := r.uint64()
+			if err != nil {
+				return err
+			}
+
+			for range n {
+				link, err := r.string()
+				if err != nil {
+					return err
+				}
+				target, err := r.string()
+				if err != nil {
+					return err
+				}
+				roots[link] = target
+			}
+
+			return nil
+		},
+	)
+	return roots, err
+}
+
+func (s *DaemonStore) Close() error {
+	return s.conn.Close()
+}
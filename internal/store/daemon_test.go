@@ -0,0 +1,384 @@
+package store
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"testing"
+	"time"
+)
+
+// fakeDaemon is an in-process nix daemon serving path infos
+// from memory.
+type fakeDaemon struct {
+	version uint64
+	paths   map[string]*PathInfo
+	roots   map[string]string
+}
+
+func (d *fakeDaemon) serve(t *testing.T, conn net.Conn) {
+	defer conn.Close()
+
+	bw := bufio.NewWriter(conn)
+	r := &reader{r: bufio.NewReader(conn)}
+	w := &writer{w: bw}
+
+	// Handshake
+	if magic, err := r.uint64(); err != nil || magic != workerMagic1 {
+		t.Errorf("unexpected handshake magic")
+		return
+	}
+	w.uint64(workerMagic2)
+	w.uint64(d.version)
+	bw.Flush()
+
+	clientVersion, err := r.uint64()
+	if err != nil {
+		t.Errorf("failed to read client version: %s", err)
+		return
+	}
+	minor := min(clientVersion, d.version) & 0xff
+
+	if minor >= 14 {
+		r.uint64()
+	}
+	if minor >= 11 {
+		r.uint64()
+	}
+	if minor >= 33 {
+		w.string("2.24.0")
+	}
+	if minor >= 35 {
+		w.uint64(1)
+	}
+
+	// Send a log line before the handshake is done
+	w.uint64(stderrNext)
+	w.string("hello from the fake daemon\n")
+	w.uint64(stderrLast)
+	bw.Flush()
+
+	for {
+		op, err := r.uint64()
+		if err != nil {
+			return
+		}
+
+		switch op {
+		case opIsValidPath:
+			p, _ := r.string()
+			_, ok := d.paths[p]
+			w.uint64(stderrLast)
+			w.bool(ok)
+
+		case opQueryValidPaths:
+			ps, _ := r.strings()
+			if minor >= 27 {
+				r.bool()
+			}
+			valid := []string{}
+			for _, p := range ps {
+				if _, ok := d.paths[p]; ok {
+					valid = append(valid, p)
+				}
+			}
+			w.uint64(stderrLast)
+			w.strings(valid)
+
+		case opQueryPathInfo:
+			p, _ := r.string()
+			info, ok := d.paths[p]
+
+			// Send an activity to make sure it's skipped
+			w.uint64(stderrStartActivity)
+			w.uint64(1)
+			w.uint64(0)
+			w.uint64(109)
+			w.string("querying info about " + p)
+			w.uint64(2)
+			w.uint64(fieldTypeString)
+			w.string(p)
+			w.uint64(fieldTypeInt)
+			w.uint64(42)
+			w.uint64(0)
+			w.uint64(stderrStopActivity)
+			w.uint64(1)
+
+			if !ok && minor < 17 {
+				writeError(w, minor, "path '"+p+"' is not valid", nil)
+				break
+			}
+
+			w.uint64(stderrLast)
+			if minor >= 17 {
+				w.bool(ok)
+				if !ok {
+					break
+				}
+			}
+			w.string(info.Deriver)
+			w.string(info.NarHash)
+			w.strings(info.References)
+			w.uint64(uint64(info.RegistrationTime.Unix()))
+			w.uint64(info.NarSize)
+			if minor >= 16 {
+				w.bool(info.Ultimate)
+				w.strings(info.Signatures)
+				w.string(info.CA)
+			}
+
+		case opQueryReferrers:
+			p, _ := r.string()
+			referrers := []string{}
+			for _, info := range d.paths {
+				if slices.Contains(info.References, p) && info.Path != p {
+					referrers = append(referrers, info.Path)
+				}
+			}
+			slices.Sort(referrers)
+			w.uint64(stderrLast)
+			w.strings(referrers)
+
+		case opFindRoots:
+			w.uint64(stderrLast)
+			w.uint64(uint64(len(d.roots)))
+			for link, target := range d.roots {
+				w.string(link)
+				w.string(target)
+			}
+
+		default:
+			writeError(w, minor, "unsupported operation", []string{"while testing"})
+		}
+
+		if err := bw.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func writeError(w *writer, minor uint64, msg string, traces []string) {
+	w.uint64(stderrError)
+
+	if minor < 26 {
+		w.string(msg)
+		w.uint64(1)
+		return
+	}
+
+	w.string("Error")
+	w.uint64(0)
+	w.string("Error")
+	w.string(msg)
+	w.uint64(0)
+	w.uint64(uint64(len(traces)))
+	for _, trace := range traces {
+		w.uint64(0)
+		w.string(trace)
+	}
+}
+
+const (
+	pathHello = "/nix/store/aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa-hello-2.12.1"
+	pathGlibc = "/nix/store/bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb-glibc-2.40"
+	pathLibc  = "/nix/store/cccccccccccccccccccccccccccccccc-libidn2-2.3.7"
+)
+
+func newFakeDaemon(version uint64) *fakeDaemon {
+	return &fakeDaemon{
+		version: version,
+		paths: map[string]*PathInfo{
+			pathHello: {
+				Path:             pathHello,
+				Deriver:          "/nix/store/dddddddddddddddddddddddddddddddd-hello-2.12.1.drv",
+				NarHash:          "sha256:abc",
+				References:       []string{pathHello, pathGlibc},
+				RegistrationTime: time.Unix(1700000000, 0),
+				NarSize:          100,
+				Signatures:       []string{"cache.nixos.org-1:xyz"},
+			},
+			pathGlibc: {
+				Path:             pathGlibc,
+				References:       []string{pathGlibc, pathLibc},
+				RegistrationTime: time.Unix(1700000000, 0),
+				NarSize:          1000,
+			},
+			pathLibc: {
+				Path:             pathLibc,
+				References:       []string{pathLibc},
+				RegistrationTime: time.Unix(1700000000, 0),
+				NarSize:          10,
+			},
+		},
+		roots: map[string]string{
+			"/nix/var/nix/profiles/system-1-link": pathHello,
+		},
+	}
+}
+
+func connectFake(t *testing.T, version uint64) *DaemonStore {
+	t.Helper()
+
+	client, server := net.Pipe()
+	go newFakeDaemon(version).serve(t, server)
+
+	s, err := NewDaemonStore(context.Background(), client)
+	if err != nil {
+		t.Fatalf("handshake failed: %s", err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	return s
+}
+
+var testVersions = []struct {
+	name    string
+	version uint64
+}{
+	{"protocol 1.37", 1<<8 | 37},
+	{"protocol 1.21", 1<<8 | 21},
+	{"protocol 1.15", 1<<8 | 15},
+}
+
+func TestQueryPathInfo(t *testing.T) {
+	for _, tv := range testVersions {
+		t.Run(tv.name, func(t *testing.T) {
+			s := connectFake(t, tv.version)
+
+			info, err := s.QueryPathInfo(context.Background(), pathHello)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if info.NarSize != 100 {
+				t.Errorf("nar size is '%d' but '%d' was expected", info.NarSize, 100)
+			}
+			if !slices.Equal(info.References, []string{pathHello, pathGlibc}) {
+				t.Errorf("unexpected references '%v'", info.References)
+			}
+			if !info.RegistrationTime.Equal(time.Unix(1700000000, 0)) {
+				t.Errorf("unexpected registration time '%s'", info.RegistrationTime)
+			}
+
+			_, err = s.QueryPathInfo(context.Background(), "/nix/store/eeeeeeeeeeeeeeeeeeeeeeeeeeeeeeee-missing")
+			if !errors.Is(err, ErrInvalidPath) {
+				t.Errorf("error is '%v' but '%v' was expected", err, ErrInvalidPath)
+			}
+		})
+	}
+}
+
+func TestClosure(t *testing.T) {
+	s := connectFake(t, protocolVersion)
+
+	closure, err := Closure(context.Background(), s, pathHello)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	paths := []string{}
+	for _, info := range closure {
+		paths = append(paths, info.Path)
+	}
+
+	expected := []string{pathHello, pathGlibc, pathLibc}
+	if !slices.Equal(paths, expected) {
+		t.Errorf("closure is '%v' but '%v' was expected", paths, expected)
+	}
+
+	if size := ClosureSize(closure); size != 1110 {
+		t.Errorf("closure size is '%d' but '%d' was expected", size, 1110)
+	}
+}
+
+func TestDiffClosures(t *testing.T) {
+	s := connectFake(t, protocolVersion)
+
+	diff, err := DiffClosures(context.Background(), s, pathGlibc, pathHello)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(diff.Changes) != 1 || diff.Changes[0].Name != "hello" || len(diff.Changes[0].Before) != 0 {
+		t.Errorf("changes are '%v' but only hello was expected to be added", diff.Changes)
+	}
+	if diff.SizeAfter-diff.SizeBefore != 100 {
+		t.Errorf("closure grew by '%d' but '%d' was expected", diff.SizeAfter-diff.SizeBefore, 100)
+	}
+}
+
+func TestQueries(t *testing.T) {
+	for _, tv := range testVersions {
+		t.Run(tv.name, func(t *testing.T) {
+			s := connectFake(t, tv.version)
+			ctx := context.Background()
+
+			valid, err := s.IsValidPath(ctx, pathGlibc)
+			if err != nil || !valid {
+				t.Errorf("expected '%s' to be valid, got '%v' (%v)", pathGlibc, valid, err)
+			}
+
+			paths, err := s.QueryValidPaths(ctx, []string{pathLibc, "/nix/store/eeeeeeeeeeeeeeeeeeeeeeeeeeeeeeee-missing"})
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !slices.Equal(paths, []string{pathLibc}) {
+				t.Errorf("valid paths are '%v' but '%v' was expected", paths, []string{pathLibc})
+			}
+
+			referrers, err := s.QueryReferrers(ctx, pathGlibc)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !slices.Equal(referrers, []string{pathHello}) {
+				t.Errorf("referrers are '%v' but '%v' was expected", referrers, []string{pathHello})
+			}
+
+			roots, err := s.FindRoots(ctx)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if roots["/nix/var/nix/profiles/system-1-link"] != pathHello {
+				t.Errorf("unexpected roots '%v'", roots)
+			}
+		})
+	}
+}
+
+func TestDaemonError(t *testing.T) {
+	s := connectFake(t, protocolVersion)
+
+	err := s.op(context.Background(), 9999, nil, func(r *reader) error { return nil })
+
+	var derr *DaemonError
+	if !errors.As(err, &derr) {
+		t.Fatalf("error is '%v' but a daemon error was expected", err)
+	}
+	if derr.Message != "unsupported operation" {
+		t.Errorf("error message is '%s' but '%s' was expected", derr.Message, "unsupported operation")
+	}
+	if !slices.Equal(derr.Traces, []string{"while testing"}) {
+		t.Errorf("unexpected traces '%v'", derr.Traces)
+	}
+}
+
+func TestContextCancel(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+
+	// Server never answers the handshake
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	go func() {
+		buf := make([]byte, 8)
+		server.Read(buf)
+	}()
+
+	_, err := NewDaemonStore(ctx, client)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error is '%v' but '%v' was expected", err, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,54 @@
+package store
+
+import (
+	"context"
+
+	"github.com/arnarg/lila/internal/nix"
+)
+
+// Diff is how the closure of a store path differs from the
+// closure of another.
+type Diff struct {
+	Changes []nix.VersionChange
+	// Closure sizes before and after
+	SizeBefore uint64
+	SizeAfter  uint64
+}
+
+// Paths returns the store paths of a closure.
+func Paths(closure []*PathInfo) []string {
+	paths := []string{}
+	for _, info := range closure {
+		paths = append(paths, info.Path)
+	}
+	return paths
+}
+
+// DiffClosures compares the package versions and sizes of the
+// closures of two store paths. Profiles and generations can be
+// given as well, their symlinks are followed to the store.
+func DiffClosures(ctx context.Context, s Store, before, after string) (*Diff, error) {
+	before, err := nix.StorePath(before)
+	if err != nil {
+		return nil, err
+	}
+	after, err = nix.StorePath(after)
+	if err != nil {
+		return nil, err
+	}
+
+	bc, err := Closure(ctx, s, before)
+	if err != nil {
+		return nil, err
+	}
+	ac, err := Closure(ctx, s, after)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Diff{
+		Changes:    nix.DiffVersions(nix.Versions(Paths(bc)), nix.Versions(Paths(ac))),
+		SizeBefore: ClosureSize(bc),
+		SizeAfter:  ClosureSize(ac),
+	}, nil
+}
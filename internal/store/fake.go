@@ -0,0 +1,66 @@
+package store
+
+import (
+	"context"
+	"slices"
+)
+
+// Fake is an in-memory Store with a fixed set of valid paths.
+type Fake struct {
+	Paths map[string]*PathInfo
+	Roots map[string]string
+}
+
+// NewFake creates a Fake where the paths are valid.
+func NewFake(paths ...*PathInfo) *Fake {
+	f := &Fake{
+		Paths: map[string]*PathInfo{},
+		Roots: map[string]string{},
+	}
+	for _, info := range paths {
+		f.Paths[info.Path] = info
+	}
+	return f
+}
+
+func (f *Fake) IsValidPath(ctx context.Context, path string) (bool, error) {
+	_, ok := f.Paths[path]
+	return ok, nil
+}
+
+func (f *Fake) QueryValidPaths(ctx context.Context, paths []string) ([]string, error) {
+	valid := []string{}
+	for _, p := range paths {
+		if _, ok := f.Paths[p]; ok {
+			valid = append(valid, p)
+		}
+	}
+	return valid, nil
+}
+
+func (f *Fake) QueryPathInfo(ctx context.Context, path string) (*PathInfo, error) {
+	info, ok := f.Paths[path]
+	if !ok {
+		return nil, ErrInvalidPath
+	}
+	return info, nil
+}
+
+func (f *Fake) QueryReferrers(ctx context.Context, path string) ([]string, error) {
+	referrers := []string{}
+	for p, info := range f.Paths {
+		if slices.Contains(info.References, path) {
+			referrers = append(referrers, p)
+		}
+	}
+	slices.Sort(referrers)
+	return referrers, nil
+}
+
+func (f *Fake) FindRoots(ctx context.Context) (map[string]string, error) {
+	return f.Roots, nil
+}
+
+func (f *Fake) Close() error {
+	return nil
+}
@@ -0,0 +1,103 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrInvalidPath = errors.New("path is not valid")
+
+// PathInfo is the metadata nix keeps about a valid store path.
+type PathInfo struct {
+	Path             string
+	Deriver          string
+	NarHash          string
+	References       []string
+	RegistrationTime time.Time
+	NarSize          uint64
+	Ultimate         bool
+	Signatures       []string
+	CA               string
+}
+
+// Store is a read-only view of a nix store.
+type Store interface {
+	// IsValidPath returns whether path is valid in the store.
+	IsValidPath(ctx context.Context, path string) (bool, error)
+	// QueryValidPaths returns the subset of paths that are valid
+	// in the store.
+	QueryValidPaths(ctx context.Context, paths []string) ([]string, error)
+	// QueryPathInfo returns the metadata of path, or ErrInvalidPath
+	// if it is not valid.
+	QueryPathInfo(ctx context.Context, path string) (*PathInfo, error)
+	// QueryReferrers returns the store paths referring to path.
+	QueryReferrers(ctx context.Context, path string) ([]string, error)
+	// FindRoots returns the garbage collector roots, mapping the
+	// location of the root to the store path it points to.
+	FindRoots(ctx context.Context) (map[string]string, error)
+
+	Close() error
+}
+
+// Closure returns the path info of all paths in the closure of
+// paths, in the order they are discovered.
+func Closure(ctx context.Context, s Store, paths ...string) ([]*PathInfo, error) {
+	seen := map[string]bool{}
+	queue := []string{}
+
+	for _, p := range paths {
+		if !seen[p] {
+			seen[p] = true
+			queue = append(queue, p)
+		}
+	}
+
+	res := []*PathInfo{}
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+
+		info, err := s.QueryPathInfo(ctx, p)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, info)
+
+		for _, ref := range info.References {
+			if !seen[ref] {
+				seen[ref] = true
+				queue = append(queue, ref)
+			}
+		}
+	}
+
+	return res, nil
+}
+
+// ClosureSize returns the sum of the NAR sizes of all paths in
+// the closure.
+func ClosureSize(closure []*PathInfo) uint64 {
+	var total uint64
+	for _, info := range closure {
+		total += info.NarSize
+	}
+	return total
+}
+
+type storeKey struct{}
+
+// WithStore returns a copy of ctx carrying s, which Open returns
+// instead of connecting to the nix daemon.
+func WithStore(ctx context.Context, s Store) context.Context {
+	return context.WithValue(ctx, storeKey{}, s)
+}
+
+// Open returns the store carried by ctx, or connects to the
+// nix daemon.
+func Open(ctx context.Context) (Store, error) {
+	if s, ok := ctx.Value(storeKey{}).(Store); ok {
+		return s, nil
+	}
+	return Connect(ctx)
+}
@@ -0,0 +1,150 @@
+package store
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Maximum length of a string read from the daemon, to avoid
+// allocating huge buffers on a corrupted stream.
+const maxStringLen = 64 << 20
+
+var errStringTooLong = errors.New("string from daemon too long")
+
+// reader decodes values in the nix worker protocol wire format,
+// where every value is padded to 8 bytes.
+type reader struct {
+	r   io.Reader
+	buf [8]byte
+}
+
+func (r *reader) uint64() (uint64, error) {
+	if _, err := io.ReadFull(r.r, r.buf[:]); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(r.buf[:]), nil
+}
+
+func (r *reader) bool() (bool, error) {
+	n, err := r.uint64()
+	return n != 0, err
+}
+
+func (r *reader) bytes() ([]byte, error) {
+	n, err := r.uint64()
+	if err != nil {
+		return nil, err
+	}
+	if n > maxStringLen {
+		return nil, errStringTooLong
+	}
+
+	// Read data including padding
+	b := make([]byte, n+padding(n))
+	if _, err := io.ReadFull(r.r, b); err != nil {
+		return nil, err
+	}
+
+	return b[:n], nil
+}
+
+func (r *reader) string() (string, error) {
+	b, err := r.bytes()
+	return string(b), err
+}
+
+func (r *reader) strings() ([]string, error) {
+	n, err := r.uint64()
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]string, 0, min(n, 1024))
+	for range n {
+		s, err := r.string()
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, s)
+	}
+
+	return res, nil
+}
+
+// fields skips over a list of activity fields.
+func (r *reader) fields() error {
+	n, err := r.uint64()
+	if err != nil {
+		return err
+	}
+
+	for range n {
+		typ, err := r.uint64()
+		if err != nil {
+			return err
+		}
+
+		switch typ {
+		case fieldTypeInt:
+			_, err = r.uint64()
+		case fieldTypeString:
+			_, err = r.bytes()
+		default:
+			err = fmt.Errorf("unknown field type %d", typ)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writer encodes values in the nix worker protocol wire format.
+type writer struct {
+	w   io.Writer
+	buf [8]byte
+	err error
+}
+
+func (w *writer) uint64(n uint64) {
+	if w.err != nil {
+		return
+	}
+	binary.LittleEndian.PutUint64(w.buf[:], n)
+	_, w.err = w.w.Write(w.buf[:])
+}
+
+func (w *writer) bool(b bool) {
+	if b {
+		w.uint64(1)
+	} else {
+		w.uint64(0)
+	}
+}
+
+func (w *writer) string(s string) {
+	w.uint64(uint64(len(s)))
+	if w.err != nil {
+		return
+	}
+	if _, w.err = io.WriteString(w.w, s); w.err != nil {
+		return
+	}
+	if p := padding(uint64(len(s))); p > 0 {
+		_, w.err = w.w.Write(make([]byte, p))
+	}
+}
+
+func (w *writer) strings(ss []string) {
+	w.uint64(uint64(len(ss)))
+	for _, s := range ss {
+		w.string(s)
+	}
+}
+
+func padding(n uint64) uint64 {
+	return (8 - n%8) % 8
+}
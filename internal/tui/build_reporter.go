@@ -5,8 +5,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"os"
+	"regexp"
 	"slices"
 	"strings"
+	"time"
 
 	"github.com/arnarg/lila/internal/nix"
 	"github.com/charmbracelet/bubbles/spinner"
@@ -15,15 +18,116 @@ import (
 )
 
 type BuildReporter struct {
-	verbose bool
+	verbose        bool
+	keepGoing      bool
+	summaryFile    string
+	evaluatedSince time.Time
+
+	errors   []string
+	failed   []string
+	warnings []Warning
 }
 
 func NewBuildReporter(verbose bool) *BuildReporter {
-	return &BuildReporter{verbose}
+	return &BuildReporter{verbose: verbose}
 }
 
-func (r *BuildReporter) Run(ctx context.Context, decoder *nix.ProgressDecoder) error {
-	return runTUIModel(ctx, initBuildModel(r.verbose), decoder)
+// SummaryFile sets a path to write the build summary to as JSON
+// once nix has exited, with the status and exit code of the build.
+func (r *BuildReporter) SummaryFile(path string) *BuildReporter {
+	r.summaryFile = path
+	return r
+}
+
+// KeepGoing makes the reporter collect errors and keep reporting
+// progress, for use with nix's --keep-going, instead of stopping
+// at the first error.
+func (r *BuildReporter) KeepGoing(keepGoing bool) *BuildReporter {
+	r.keepGoing = keepGoing
+	return r
+}
+
+// EvaluatedSince tells the reporter that evaluation started at
+// start and is done, for builds of derivations that were evaluated
+// before running nix build.
+func (r *BuildReporter) EvaluatedSince(start time.Time) *BuildReporter {
+	r.evaluatedSince = start
+	return r
+}
+
+// BuildAttrs builds attributes of the nilla project with the
+// reporter. Their derivations are evaluated first, so that
+// evaluation is shown and timed apart from building, and args are
+// passed to nix build after the installables.
+func BuildAttrs(ctx context.Context, attrs, args []string, r *BuildReporter) ([]byte, error) {
+	start := time.Now()
+	installables, err := nix.DrvInstallables(ctx, attrs, NewEvalReporter(r.verbose))
+	if err != nil {
+		return nil, err
+	}
+
+	return nix.Command("build").
+		Args(append(installables, args...)).
+		Reporter(r.EvaluatedSince(start)).
+		Run(ctx)
+}
+
+// Errors returns the errors collected when keeping going.
+func (r *BuildReporter) Errors() []string {
+	return r.errors
+}
+
+// FailedBuilds returns the derivations that nix failed to build.
+func (r *BuildReporter) FailedBuilds() []string {
+	return r.failed
+}
+
+// Warnings returns the warnings and traces nix emitted.
+func (r *BuildReporter) Warnings() []Warning {
+	return r.warnings
+}
+
+func (r *BuildReporter) Run(ctx context.Context, decoder *nix.ProgressDecoder) (nix.Summary, error) {
+	init := initBuildModel(r.verbose)
+	init.keepGoing = r.keepGoing
+	if !r.evaluatedSince.IsZero() {
+		init.start = r.evaluatedSince
+		init.stats.evaluation = time.Since(r.evaluatedSince)
+	}
+
+	m, err := runTUIModel(ctx, init, decoder)
+	r.warnings = init.warnings.list
+	r.failed = *init.failed
+	if err != nil {
+		// Warnings may explain the failure
+		printWarnings(os.Stderr, r.warnings)
+		return nil, err
+	}
+
+	bm := m.(buildModel)
+	r.errors = *bm.errors
+
+	// The summary is reported once nix has exited
+	summary := &buildReport{
+		summary: bm.stats.summary(bm.start, *bm.failed),
+		file:    r.summaryFile,
+	}
+
+	return summary, reportWarnings(ctx, os.Stderr, r.warnings)
+}
+
+// failedBuildRe matches the derivation in the errors nix logs
+// when a build fails.
+var failedBuildRe = regexp.MustCompile(`(?:builder for|Cannot build) '(/nix/store/[^']+\.drv)'`)
+
+// failedBuild returns the derivation of a failed build if the
+// message is the error of one.
+func failedBuild(text string) (string, bool) {
+	m := failedBuildRe.FindStringSubmatch(ansiEscape.ReplaceAllString(text, ""))
+	if m == nil {
+		return "", false
+	}
+	return m[1], true
 }
 
 func extractName(p string) string {
@@ -31,21 +135,32 @@ func extractName(p string) string {
 }
 
 type build struct {
+	drv   string
 	name  string
 	phase string
+	start time.Time
 }
 
 func (b *build) String() string {
-	if b.phase != "" {
-		return fmt.Sprintf("%s [%s]", b.name, b.phase)
+	return b.render(0)
+}
+
+func (b *build) render(width int) string {
+	elapsed := fmt.Sprintf(" %s", fmtDuration(time.Since(b.start)))
+	if b.phase == "" {
+		return fitLine(b.name, width, elapsed)
 	}
-	return b.name
+
+	return fitLine(b.name, width, fmt.Sprintf(" [%s]", b.phase)+elapsed, elapsed)
 }
 
 type buildModel struct {
 	spinner spinner.Model
 
+	w, h int
+
 	verbose     bool
+	keepGoing   bool
 	initialized bool
 
 	copyPathsProgs progresses
@@ -55,7 +170,18 @@ type buildModel struct {
 	transfers map[int64]int64
 	builds    map[int64]*build
 
-	lastMsg string
+	lastMsg line
+
+	start time.Time
+	stats *buildStats
+
+	// Errors collected when keeping going
+	errors *[]string
+
+	// Derivations that failed to build
+	failed *[]string
+
+	warnings *warnings
 
 	err error
 }
@@ -73,7 +199,23 @@ func initBuildModel(verbose bool) buildModel {
 		downloads:      map[int64]*copy{},
 		builds:         map[int64]*build{},
 		transfers:      map[int64]int64{},
-		lastMsg:        "Initializing build...",
+		start:          time.Now(),
+		stats:          &buildStats{},
+		errors:         &[]string{},
+		failed:         &[]string{},
+		warnings:       &warnings{},
+	}
+}
+
+// initialize marks that nix started building or substituting,
+// which ends the evaluation unless it was done before the build.
+func (m *buildModel) initialize() {
+	if m.initialized {
+		return
+	}
+	m.initialized = true
+	if m.stats.evaluation == 0 {
+		m.stats.evaluation = time.Since(m.start)
 	}
 }
 
@@ -87,6 +229,11 @@ func (m buildModel) Init() tea.Cmd {
 
 func (m buildModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.w = msg.Width
+		m.h = msg.Height
+		return m, nil
+
 	case spinner.TickMsg:
 		var cmd tea.Cmd
 		m.spinner, cmd = m.spinner.Update(msg)
@@ -112,9 +259,22 @@ func (m buildModel) handleEvent(ev nix.Event) (tea.Model, tea.Cmd) {
 		return m.handleResultEvent(ev)
 	case nix.ActionTypeMessage:
 		event := ev.(nix.MessageEvent)
+		isWarning := m.warnings.collect(event)
+
+		// error, but traces are logged with the same level
+		if event.Level == 0 && !isWarning {
+			if drv, ok := failedBuild(event.Text); ok && !slices.Contains(*m.failed, drv) {
+				*m.failed = append(*m.failed, drv)
+			}
+
+			if m.keepGoing {
+				*m.errors = append(*m.errors, event.Text)
+				if m.verbose {
+					return m, tea.Printf("%s", event.Text)
+				}
+				return m, nil
+			}
 
-		// error
-		if event.Level == 0 {
 			m.err = errors.New(event.Text)
 			return m, tea.Quit
 		}
@@ -123,7 +283,7 @@ func (m buildModel) handleEvent(ev nix.Event) (tea.Model, tea.Cmd) {
 		if m.verbose {
 			cmd = tea.Printf("%s", event.Text)
 		} else {
-			m.lastMsg = event.Text
+			m.lastMsg = message(event.Text)
 		}
 	}
 	return m, cmd
@@ -133,20 +293,16 @@ func (m buildModel) handleStartEvent(ev nix.Event) (tea.Model, tea.Cmd) {
 	switch ev := ev.(type) {
 	case nix.StartCopyPathsEvent:
 		m.copyPathsProgs[ev.ID] = progress{}
-		if !m.initialized {
-			m.initialized = true
-		}
+		m.initialize()
 		return m, nil
 
 	case nix.StartBuildsEvent:
 		m.buildsProgs[ev.ID] = progress{}
-		if !m.initialized {
-			m.initialized = true
-		}
+		m.initialize()
 		return m, nil
 
 	case nix.StartCopyPathEvent:
-		m.downloads[ev.ID] = &copy{name: extractName(ev.Path)}
+		m.downloads[ev.ID] = newCopy(extractName(ev.Path))
 
 		if m.verbose {
 			return m, tea.Println(ev.Text)
@@ -162,7 +318,11 @@ func (m buildModel) handleStartEvent(ev nix.Event) (tea.Model, tea.Cmd) {
 		return m, nil
 
 	case nix.StartBuildEvent:
-		m.builds[ev.ID] = &build{name: strings.TrimSuffix(extractName(ev.Path), ".drv")}
+		m.builds[ev.ID] = &build{
+			drv:   ev.Path,
+			name:  strings.TrimSuffix(extractName(ev.Path), ".drv"),
+			start: time.Now(),
+		}
 		return m, nil
 	}
 
@@ -171,15 +331,17 @@ func (m buildModel) handleStartEvent(ev nix.Event) (tea.Model, tea.Cmd) {
 
 func (m buildModel) handleStopEvent(ev nix.StopEvent) (tea.Model, tea.Cmd) {
 	// First check if ID is build
-	if _, ok := m.builds[ev.ID]; ok {
+	if b, ok := m.builds[ev.ID]; ok {
 		// Remove from builds map
 		delete(m.builds, ev.ID)
+		m.stats.addBuild(b)
 	}
 
 	// Then check if it's a download
-	if _, ok := m.downloads[ev.ID]; ok {
+	if d, ok := m.downloads[ev.ID]; ok {
 		// Remove from downloads map
 		delete(m.downloads, ev.ID)
+		m.stats.addDownload(d)
 	}
 
 	// Finally we want to also clean up transfer parent mapping
@@ -191,7 +353,7 @@ func (m buildModel) handleStopEvent(ev nix.StopEvent) (tea.Model, tea.Cmd) {
 	// Clear last message if all builds and downloads have stopped,
 	// but only after initialization
 	if m.initialized && len(m.builds) < 1 && len(m.downloads) < 1 {
-		m.lastMsg = ""
+		m.lastMsg = nil
 	}
 
 	return m, nil
@@ -207,7 +369,7 @@ func (m buildModel) handleResultEvent(ev nix.Event) (tea.Model, tea.Cmd) {
 		}
 
 		b.phase = ev.Phase
-		m.lastMsg = b.String()
+		m.lastMsg = b
 		return m, nil
 
 	case nix.ResultProgressEvent:
@@ -237,10 +399,9 @@ func (m buildModel) handleResultEvent(ev nix.Event) (tea.Model, tea.Cmd) {
 			return m, nil
 		}
 
-		d.done = ev.Done
-		d.total = ev.Expected
+		d.update(ev.Done, ev.Expected)
 
-		m.lastMsg = d.String()
+		m.lastMsg = d
 		return m, nil
 
 	case nix.ResultBuildLogLineEvent:
@@ -274,13 +435,47 @@ func (m buildModel) View() string {
 	return m.progressView()
 }
 
+// uninitializedView shows the evaluation, which lasts until nix
+// starts building or substituting.
 func (m buildModel) uninitializedView() string {
-	return fmt.Sprintf("%s%s\n", m.spinner.View(), m.lastMsg)
+	ev := evaluation{start: m.start}
+	if msg, ok := m.lastMsg.(message); ok {
+		ev.text = string(msg)
+	}
+
+	return fmt.Sprintf("%s%s\n", m.spinner.View(), m.renderLine(ev))
+}
+
+// renderLine renders a line of status output prefixed by the
+// spinner, fitted to the current terminal width.
+func (m buildModel) renderLine(l line) string {
+	if l == nil {
+		return ""
+	}
+
+	width := 0
+	if m.w > 0 {
+		width = m.w - lipgloss.Width(m.spinner.View())
+	}
+
+	return l.render(width)
 }
 
 type progressItem struct {
 	id   int64
-	text string
+	line line
+}
+
+// maxItems returns how many running builds and downloads fit
+// in the terminal alongside the status lines, or -1 if the
+// terminal height is not known yet.
+func (m buildModel) maxItems() int {
+	if m.h <= 0 {
+		return -1
+	}
+	// Leave room for the header and the status line, as well
+	// as the line the cursor ends up on
+	return max(m.h-3, 1)
 }
 
 func (m buildModel) progressView() string {
@@ -290,31 +485,41 @@ func (m buildModel) progressView() string {
 		items := []progressItem{}
 
 		for id, d := range m.downloads {
-			item := progressItem{
-				id:   id,
-				text: fmt.Sprintf("%s%s\n", m.spinner.View(), d.String()),
-			}
-			items = append(items, item)
+			items = append(items, progressItem{id, d})
 		}
 
 		for id, b := range m.builds {
-			item := progressItem{
-				id:   id,
-				text: fmt.Sprintf("%s%s\n", m.spinner.View(), b.String()),
-			}
-			items = append(items, item)
+			items = append(items, progressItem{id, b})
 		}
 
 		slices.SortFunc(items, func(a, b progressItem) int {
 			return cmp.Compare(a.id, b.id)
 		})
 
+		// Cap the number of shown items so that the view
+		// never grows taller than the terminal
+		more := 0
+		if limit := m.maxItems(); limit >= 0 && len(items) > limit {
+			more = len(items) - (limit - 1)
+			items = items[:limit-1]
+		}
+
 		for _, i := range items {
-			strb.WriteString(i.text)
+			strb.WriteString(fmt.Sprintf("%s%s\n", m.spinner.View(), m.renderLine(i.line)))
+		}
+
+		if more > 0 {
+			strb.WriteString(
+				lipgloss.NewStyle().
+					Faint(true).
+					SetString(fmt.Sprintf("  +%d more", more)).
+					String(),
+			)
+			strb.WriteString("\n")
 		}
 	} else {
-		if m.lastMsg != "" {
-			strb.WriteString(fmt.Sprintf("%s%s\n", m.spinner.View(), m.lastMsg))
+		if m.lastMsg != nil {
+			strb.WriteString(fmt.Sprintf("%s%s\n", m.spinner.View(), m.renderLine(m.lastMsg)))
 		} else {
 			strb.WriteString("\n")
 		}
@@ -322,6 +527,7 @@ func (m buildModel) progressView() string {
 
 	builds := fmtBuilds(m)
 	downloads := fmtDownloads(m)
+	elapsed := fmtDuration(time.Since(m.start))
 
 	bhdr := lipgloss.NewStyle().
 		Bold(true).
@@ -333,9 +539,21 @@ func (m buildModel) progressView() string {
 		Width(lipgloss.Width(downloads)).
 		SetString("Downloads:").
 		String()
+	ehdr := lipgloss.NewStyle().
+		Bold(true).
+		SetString("Time:").
+		String()
+
+	// Make sure the status lines never wrap on narrow terminals
+	status := lipgloss.NewStyle()
+	if m.w > 0 {
+		status = status.MaxWidth(m.w)
+	}
 
-	strb.WriteString(fmt.Sprintf("%s | %s\n", bhdr, dhdr))
-	strb.WriteString(fmt.Sprintf("%s | %s\n", builds, downloads))
+	strb.WriteString(status.Render(fmt.Sprintf("%s | %s | %s", bhdr, dhdr, ehdr)))
+	strb.WriteString("\n")
+	strb.WriteString(status.Render(fmt.Sprintf("%s | %s | %s", builds, downloads, elapsed)))
+	strb.WriteString("\n")
 
 	return strb.String()
 }
@@ -0,0 +1,72 @@
+package tui
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/arnarg/lila/internal/nix"
+)
+
+func TestBuildModelCollectsFailedBuilds(t *testing.T) {
+	m := initBuildModel(false)
+	m.keepGoing = true
+
+	for _, ev := range []nix.Event{
+		nix.MessageEvent{Level: 0, Text: "error: builder for '/nix/store/aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa-foo.drv' failed with exit code 1"},
+		nix.MessageEvent{Level: 0, Text: "error: \x1b[31;1mCannot build '\x1b[35;1m/nix/store/bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb-bar.drv\x1b[0m'.\x1b[0m\n       Reason: builder failed with exit code 2."},
+		nix.MessageEvent{Level: 0, Text: "error: builder for '/nix/store/aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa-foo.drv' failed with exit code 1"},
+		nix.MessageEvent{Level: 0, Text: "error: 1 dependencies of derivation '/nix/store/cccccccccccccccccccccccccccccccc-baz.drv' failed to build"},
+	} {
+		res, _ := m.Update(ev)
+		m = res.(buildModel)
+	}
+
+	expected := []string{
+		"/nix/store/aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa-foo.drv",
+		"/nix/store/bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb-bar.drv",
+	}
+	if !slices.Equal(*m.failed, expected) {
+		t.Errorf("failed builds are %v but %v was expected", *m.failed, expected)
+	}
+}
+
+func TestBuildModelKeepsEvaluationTime(t *testing.T) {
+	m := initBuildModel(false)
+	m.stats.evaluation = 40 * time.Second
+
+	res, _ := m.Update(nix.StartBuildsEvent{ID: 1})
+	m = res.(buildModel)
+
+	if !m.initialized {
+		t.Error("model should be initialized once nix starts building")
+	}
+	if m.stats.evaluation != 40*time.Second {
+		t.Errorf("evaluation took %s but 40s was expected", m.stats.evaluation)
+	}
+}
+
+func TestBuildModelSummaryLeavesOutFailedBuilds(t *testing.T) {
+	m := initBuildModel(false)
+	m.keepGoing = true
+
+	for _, ev := range []nix.Event{
+		nix.StartBuildsEvent{ID: 1},
+		nix.StartBuildEvent{ID: 2, Path: "/nix/store/aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa-foo.drv"},
+		nix.StartBuildEvent{ID: 3, Path: "/nix/store/bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb-bar.drv"},
+		nix.StopEvent{ID: 2},
+		nix.MessageEvent{Level: 0, Text: "error: builder for '/nix/store/bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb-bar.drv' failed with exit code 1"},
+		nix.StopEvent{ID: 3},
+	} {
+		res, _ := m.Update(ev)
+		m = res.(buildModel)
+	}
+
+	summary := m.stats.summary(m.start, *m.failed)
+	if summary.Built != 1 || summary.Failed != 1 {
+		t.Errorf("built %d and failed %d but 1 and 1 were expected", summary.Built, summary.Failed)
+	}
+	if len(summary.Builds) != 1 || summary.Builds[0].Name != "foo" {
+		t.Errorf("builds are %v but only foo was expected", summary.Builds)
+	}
+}
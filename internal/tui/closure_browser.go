@@ -0,0 +1,471 @@
+package tui
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/arnarg/lila/internal/nix"
+	"github.com/arnarg/lila/internal/store"
+	"github.com/arnarg/lila/internal/util"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// sizeColumnWidth is the width of each size column in the
+// closure browser.
+const sizeColumnWidth = 11
+
+type ClosureBrowser struct {
+	root    string
+	closure []*store.PathInfo
+}
+
+// NewClosureBrowser creates an interactive browser of the closure
+// of root, which must include root itself.
+func NewClosureBrowser(root string, closure []*store.PathInfo) *ClosureBrowser {
+	return &ClosureBrowser{root, closure}
+}
+
+func (b *ClosureBrowser) Run(ctx context.Context) error {
+	p := tea.NewProgram(
+		initClosureModel(b.root, b.closure),
+		tea.WithContext(ctx),
+		tea.WithAltScreen(),
+	)
+
+	_, err := p.Run()
+	return err
+}
+
+// fmtBytes formats a size for display.
+func fmtBytes(b uint64) string {
+	size, unit := util.ConvertBytes(int64(b))
+	return fmt.Sprintf("%.1f %s", size, unit)
+}
+
+// treeRow is a visible row of the closure tree. The same store
+// path can be shown in many places, so rows are identified by
+// the chain of paths leading to them.
+type treeRow struct {
+	key   string
+	path  string
+	depth int
+}
+
+func childKey(parent, path string) string {
+	return parent + "\x00" + path
+}
+
+type closureModel struct {
+	w, h int
+
+	root  string
+	infos map[string]*store.PathInfo
+
+	// Closure sizes of paths, computed when first needed
+	sizes map[string]uint64
+
+	// Sorted references of paths, computed when first needed
+	refs map[string][]string
+
+	// Parent of every path on the shortest chain of references
+	// from root, used to find search matches
+	parents map[string]string
+
+	expanded map[string]bool
+	rows     []treeRow
+
+	cursor int
+	offset int
+
+	searching bool
+	query     string
+	matches   []string
+	match     int
+}
+
+func initClosureModel(root string, closure []*store.PathInfo) closureModel {
+	m := closureModel{
+		root:     root,
+		infos:    map[string]*store.PathInfo{},
+		sizes:    map[string]uint64{},
+		refs:     map[string][]string{},
+		parents:  map[string]string{},
+		expanded: map[string]bool{root: true},
+	}
+
+	for _, info := range closure {
+		m.infos[info.Path] = info
+	}
+
+	// Breadth first, so that the first parent found is on
+	// the shortest chain
+	queue := []string{root}
+	seen := map[string]bool{root: true}
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+
+		for _, ref := range m.references(p) {
+			if !seen[ref] {
+				seen[ref] = true
+				m.parents[ref] = p
+				queue = append(queue, ref)
+			}
+		}
+	}
+
+	m.flatten()
+
+	return m
+}
+
+// references returns the references of a path in the closure,
+// excluding itself, largest closure first.
+func (m closureModel) references(path string) []string {
+	if refs, ok := m.refs[path]; ok {
+		return refs
+	}
+
+	info, ok := m.infos[path]
+	if !ok {
+		return nil
+	}
+
+	refs := []string{}
+	for _, ref := range info.References {
+		if _, ok := m.infos[ref]; ok && ref != path {
+			refs = append(refs, ref)
+		}
+	}
+
+	slices.SortFunc(refs, func(a, b string) int {
+		return cmp.Or(
+			cmp.Compare(m.closureSize(b), m.closureSize(a)),
+			strings.Compare(nix.StoreName(a), nix.StoreName(b)),
+		)
+	})
+
+	m.refs[path] = refs
+	return refs
+}
+
+// closureSize returns the sum of the NAR sizes of the closure of
+// a path.
+func (m closureModel) closureSize(path string) uint64 {
+	if size, ok := m.sizes[path]; ok {
+		return size
+	}
+
+	var size uint64
+	seen := map[string]bool{path: true}
+	stack := []string{path}
+	for len(stack) > 0 {
+		p := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		info, ok := m.infos[p]
+		if !ok {
+			continue
+		}
+		size += info.NarSize
+
+		for _, ref := range info.References {
+			if !seen[ref] {
+				seen[ref] = true
+				stack = append(stack, ref)
+			}
+		}
+	}
+
+	m.sizes[path] = size
+	return size
+}
+
+// flatten updates the visible rows from the expanded nodes.
+func (m *closureModel) flatten() {
+	m.rows = []treeRow{}
+
+	var walk func(key, path string, depth int)
+	walk = func(key, path string, depth int) {
+		m.rows = append(m.rows, treeRow{key, path, depth})
+		if !m.expanded[key] {
+			return
+		}
+		for _, ref := range m.references(path) {
+			walk(childKey(key, ref), ref, depth+1)
+		}
+	}
+	walk(m.root, m.root, 0)
+
+	m.cursor = min(m.cursor, len(m.rows)-1)
+}
+
+// listHeight returns how many rows fit between the header
+// and the footer.
+func (m closureModel) listHeight() int {
+	if m.h <= 0 {
+		return 10
+	}
+	return max(m.h-2, 1)
+}
+
+// scroll makes sure the cursor is visible.
+func (m *closureModel) scroll() {
+	height := m.listHeight()
+	if m.cursor < m.offset {
+		m.offset = m.cursor
+	} else if m.cursor >= m.offset+height {
+		m.offset = m.cursor - height + 1
+	}
+}
+
+func (m *closureModel) moveCursor(delta int) {
+	m.cursor = max(min(m.cursor+delta, len(m.rows)-1), 0)
+	m.scroll()
+}
+
+// jumpTo expands the nodes on the shortest chain from root to
+// path and moves the cursor to it.
+func (m *closureModel) jumpTo(path string) {
+	chain := []string{path}
+	for p := path; p != m.root; {
+		parent, ok := m.parents[p]
+		if !ok {
+			return
+		}
+		chain = append([]string{parent}, chain...)
+		p = parent
+	}
+
+	key := m.root
+	for _, p := range chain[1:] {
+		m.expanded[key] = true
+		key = childKey(key, p)
+	}
+
+	m.flatten()
+	for i, row := range m.rows {
+		if row.key == key {
+			m.cursor = i
+			break
+		}
+	}
+	m.scroll()
+}
+
+// search finds the paths in the closure with names containing
+// the query.
+func (m *closureModel) search() {
+	m.matches = []string{}
+	m.match = 0
+	if m.query == "" {
+		return
+	}
+
+	for p := range m.infos {
+		if strings.Contains(nix.StoreName(p), m.query) {
+			m.matches = append(m.matches, p)
+		}
+	}
+	slices.SortFunc(m.matches, func(a, b string) int {
+		return strings.Compare(nix.StoreName(a), nix.StoreName(b))
+	})
+
+	if len(m.matches) > 0 {
+		m.jumpTo(m.matches[0])
+	}
+}
+
+func (m *closureModel) nextMatch(delta int) {
+	if len(m.matches) < 1 {
+		return
+	}
+	m.match = (m.match + delta + len(m.matches)) % len(m.matches)
+	m.jumpTo(m.matches[m.match])
+}
+
+func (m closureModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m closureModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.w = msg.Width
+		m.h = msg.Height
+		m.scroll()
+		return m, nil
+
+	case tea.KeyMsg:
+		if m.searching {
+			return m.handleSearchKey(msg)
+		}
+		return m.handleKey(msg)
+	}
+
+	return m, nil
+}
+
+func (m closureModel) handleSearchKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyCtrlC:
+		return m, tea.Quit
+	case tea.KeyEsc:
+		m.searching = false
+		m.query = ""
+	case tea.KeyEnter:
+		m.searching = false
+		m.search()
+	case tea.KeyBackspace:
+		if query := []rune(m.query); len(query) > 0 {
+			m.query = string(query[:len(query)-1])
+		}
+	case tea.KeyRunes, tea.KeySpace:
+		m.query += string(msg.Runes)
+	}
+
+	return m, nil
+}
+
+func (m closureModel) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	row := m.rows[m.cursor]
+
+	switch msg.String() {
+	case "q", "ctrl+c":
+		return m, tea.Quit
+	case "esc":
+		if m.query == "" {
+			return m, tea.Quit
+		}
+		m.query = ""
+		m.matches = nil
+	case "up", "k":
+		m.moveCursor(-1)
+	case "down", "j":
+		m.moveCursor(1)
+	case "pgup":
+		m.moveCursor(-m.listHeight())
+	case "pgdown":
+		m.moveCursor(m.listHeight())
+	case "home", "g":
+		m.moveCursor(-len(m.rows))
+	case "end", "G":
+		m.moveCursor(len(m.rows))
+	case "enter", " ":
+		m.expanded[row.key] = !m.expanded[row.key]
+		m.flatten()
+	case "right", "l":
+		m.expanded[row.key] = true
+		m.flatten()
+	case "left", "h":
+		if m.expanded[row.key] {
+			m.expanded[row.key] = false
+			m.flatten()
+			break
+		}
+		// Move to the parent
+		for i := m.cursor - 1; i >= 0; i-- {
+			if m.rows[i].depth < row.depth {
+				m.cursor = i
+				m.scroll()
+				break
+			}
+		}
+	case "/":
+		m.searching = true
+		m.query = ""
+	case "n":
+		m.nextMatch(1)
+	case "N":
+		m.nextMatch(-1)
+	}
+
+	return m, nil
+}
+
+func (m closureModel) View() string {
+	strb := &strings.Builder{}
+
+	bold := lipgloss.NewStyle().Bold(true)
+	faint := lipgloss.NewStyle().Faint(true)
+	selected := lipgloss.NewStyle().Reverse(true)
+	highlight := lipgloss.NewStyle().Foreground(lipgloss.Color("11"))
+
+	width := m.w
+	if width <= 0 {
+		width = 80
+	}
+	nameWidth := max(width-2*sizeColumnWidth, 10)
+
+	// Header
+	strb.WriteString(bold.Render(fmt.Sprintf(
+		"%-*s%*s%*s",
+		nameWidth, truncateName(nix.StoreName(m.root), nameWidth),
+		sizeColumnWidth, "NAR", sizeColumnWidth, "Closure",
+	)))
+	strb.WriteString("\n")
+
+	// Rows
+	end := min(m.offset+m.listHeight(), len(m.rows))
+	for i := m.offset; i < end; i++ {
+		row := m.rows[i]
+
+		marker := "  "
+		if m.expanded[row.key] {
+			marker = "▾ "
+		} else if len(m.references(row.path)) > 0 {
+			marker = "▸ "
+		}
+
+		prefix := strings.Repeat("  ", row.depth) + marker
+		name := truncateName(nix.StoreName(row.path), max(nameWidth-len([]rune(prefix)), 1))
+
+		var nar uint64
+		if info, ok := m.infos[row.path]; ok {
+			nar = info.NarSize
+		}
+
+		line := fmt.Sprintf(
+			"%s%-*s%*s%*s",
+			prefix, max(nameWidth-len([]rune(prefix)), 1), name,
+			sizeColumnWidth, fmtBytes(nar),
+			sizeColumnWidth, fmtBytes(m.closureSize(row.path)),
+		)
+
+		switch {
+		case i == m.cursor:
+			line = selected.Render(line)
+		case m.query != "" && !m.searching && strings.Contains(nix.StoreName(row.path), m.query):
+			line = highlight.Render(line)
+		}
+
+		strb.WriteString(line)
+		strb.WriteString("\n")
+	}
+
+	// Fill the rest of the list so that the footer stays at
+	// the bottom
+	for i := end - m.offset; i < m.listHeight(); i++ {
+		strb.WriteString("\n")
+	}
+
+	// Footer
+	switch {
+	case m.searching:
+		strb.WriteString("/" + m.query + "█")
+	case m.query != "":
+		status := fmt.Sprintf("no paths match %q", m.query)
+		if len(m.matches) > 0 {
+			status = fmt.Sprintf("match %d of %d for %q", m.match+1, len(m.matches), m.query)
+		}
+		strb.WriteString(faint.Render(status + " • n/N next/previous • esc clear"))
+	default:
+		strb.WriteString(faint.Render("↑/↓ move • enter expand • ← collapse • / search • q quit"))
+	}
+
+	return strb.String()
+}
@@ -0,0 +1,115 @@
+package tui
+
+import (
+	"testing"
+
+	"github.com/arnarg/lila/internal/store"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const (
+	testRoot  = "/nix/store/aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa-nixos-system-laptop-25.05"
+	testBash  = "/nix/store/bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb-bash-5.2p37"
+	testGlibc = "/nix/store/cccccccccccccccccccccccccccccccc-glibc-2.40-66"
+	testHello = "/nix/store/dddddddddddddddddddddddddddddddd-hello-2.12.1"
+)
+
+func testClosureModel() closureModel {
+	return initClosureModel(testRoot, []*store.PathInfo{
+		{Path: testRoot, NarSize: 100, References: []string{testHello, testBash}},
+		{Path: testBash, NarSize: 1000, References: []string{testGlibc}},
+		{Path: testGlibc, NarSize: 5000, References: []string{testGlibc}},
+		{Path: testHello, NarSize: 200, References: []string{testGlibc}},
+	})
+}
+
+func sendKeys(m closureModel, keys ...tea.KeyMsg) closureModel {
+	for _, k := range keys {
+		res, _ := m.Update(k)
+		m = res.(closureModel)
+	}
+	return m
+}
+
+func runes(s string) tea.KeyMsg {
+	return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(s)}
+}
+
+func TestClosureModelSizes(t *testing.T) {
+	m := testClosureModel()
+
+	tests := []struct {
+		path     string
+		expected uint64
+	}{
+		{testRoot, 6300},
+		{testBash, 6000},
+		{testHello, 5200},
+		{testGlibc, 5000},
+	}
+
+	for _, test := range tests {
+		if size := m.closureSize(test.path); size != test.expected {
+			t.Errorf("closure size of '%s' is '%d' but '%d' was expected", test.path, size, test.expected)
+		}
+	}
+}
+
+func TestClosureModelExpand(t *testing.T) {
+	m := testClosureModel()
+
+	// Root is expanded with the largest reference first
+	expected := []string{testRoot, testBash, testHello}
+	if len(m.rows) != len(expected) {
+		t.Fatalf("got %d rows but %d were expected", len(m.rows), len(expected))
+	}
+	for i, row := range m.rows {
+		if row.path != expected[i] {
+			t.Errorf("row %d is '%s' but '%s' was expected", i, row.path, expected[i])
+		}
+	}
+
+	// Expand bash
+	m = sendKeys(m, runes("j"), tea.KeyMsg{Type: tea.KeyEnter})
+	if len(m.rows) != 4 || m.rows[2].path != testGlibc || m.rows[2].depth != 2 {
+		t.Fatalf("glibc was expected under bash but rows are '%v'", m.rows)
+	}
+
+	// Collapse it again
+	m = sendKeys(m, tea.KeyMsg{Type: tea.KeyLeft})
+	if len(m.rows) != 3 {
+		t.Errorf("got %d rows but 3 were expected", len(m.rows))
+	}
+	if m.cursor != 1 {
+		t.Errorf("cursor is '%d' but '%d' was expected", m.cursor, 1)
+	}
+}
+
+func TestClosureModelSearch(t *testing.T) {
+	m := testClosureModel()
+
+	m = sendKeys(m, runes("/"), runes("gli"), runes("bc"), tea.KeyMsg{Type: tea.KeyEnter})
+	if m.searching {
+		t.Fatal("search was expected to be done")
+	}
+	if len(m.matches) != 1 {
+		t.Fatalf("got %d matches but 1 was expected", len(m.matches))
+	}
+
+	row := m.rows[m.cursor]
+	if row.path != testGlibc {
+		t.Errorf("cursor is on '%s' but '%s' was expected", row.path, testGlibc)
+	}
+	if row.key != childKey(childKey(testRoot, testBash), testGlibc) {
+		t.Errorf("glibc was expected to be shown under bash")
+	}
+}
+
+func TestClosureModelSearchBackspace(t *testing.T) {
+	m := testClosureModel()
+
+	m = sendKeys(m, runes("/"), runes("glibč"), tea.KeyMsg{Type: tea.KeyBackspace}, runes("c"))
+	if m.query != "glibc" {
+		t.Errorf("query is %q but %q was expected", m.query, "glibc")
+	}
+}
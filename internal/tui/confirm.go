@@ -0,0 +1,32 @@
+package tui
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Confirm asks a yes/no question on out and reads the answer from in.
+// Anything other than "y" or "yes" is treated as no.
+func Confirm(in io.Reader, out io.Writer, question string) (bool, error) {
+	fmt.Fprintf(
+		out, "%s %s ",
+		lipgloss.NewStyle().Bold(true).Render(question),
+		lipgloss.NewStyle().Faint(true).Render("[y/N]"),
+	)
+
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true, nil
+	}
+
+	return false, nil
+}
@@ -20,8 +20,9 @@ func NewCopyReporter(verbose bool) *CopyReporter {
 	return &CopyReporter{verbose}
 }
 
-func (r *CopyReporter) Run(ctx context.Context, decoder *nix.ProgressDecoder) error {
-	return runTUIModel(ctx, initCopyModel(r.verbose), decoder)
+func (r *CopyReporter) Run(ctx context.Context, decoder *nix.ProgressDecoder) (nix.Summary, error) {
+	_, err := runTUIModel(ctx, initCopyModel(r.verbose), decoder)
+	return nil, err
 }
 
 type copyModel struct {
@@ -123,7 +124,7 @@ func (m copyModel) handleStartEvent(ev nix.Event) (tea.Model, tea.Cmd) {
 		return m, nil
 
 	case nix.StartCopyPathEvent:
-		m.copies[ev.ID] = &copy{name: ev.Path}
+		m.copies[ev.ID] = newCopy(ev.Path)
 
 		if m.verbose {
 			return m, tea.Println(ev.Text)
@@ -200,8 +201,7 @@ func (m copyModel) handleResultEvent(ev nix.Event) (tea.Model, tea.Cmd) {
 		}
 
 		if c != nil {
-			c.done = ev.Done
-			c.total = ev.Expected
+			c.update(ev.Done, ev.Expected)
 
 			m.lastMsg = c.String()
 		}
@@ -230,14 +230,8 @@ func (m copyModel) progressView() string {
 
 	if m.lastMsg != "" {
 		width := m.w - lipgloss.Width(m.spinner.View())
-		msg := m.lastMsg
-		if len(msg) > width {
-			p := "..."
-			l := (len(msg) - width) + len(p)
-			msg = fmt.Sprintf("%s%s", p, msg[l:])
-		}
 		strb.WriteString(
-			fmt.Sprintf("%s%s\n", m.spinner.View(), msg),
+			fmt.Sprintf("%s%s\n", m.spinner.View(), truncateLeft(m.lastMsg, width)),
 		)
 	} else {
 		strb.WriteString("\n")
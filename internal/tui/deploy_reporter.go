@@ -0,0 +1,287 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/spinner"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// HostState is the state of the deployment to a single host.
+type HostState int
+
+const (
+	HostPending HostState = iota
+	HostCopying
+	HostActivating
+	HostDone
+	HostFailed
+)
+
+func (s HostState) String() string {
+	switch s {
+	case HostCopying:
+		return "copying"
+	case HostActivating:
+		return "activating"
+	case HostDone:
+		return "done"
+	case HostFailed:
+		return "failed"
+	}
+	return "pending"
+}
+
+func (s HostState) finished() bool {
+	return s == HostDone || s == HostFailed
+}
+
+// HostUpdate reports a change in the deployment state of a host.
+type HostUpdate struct {
+	Host  string
+	State HostState
+	Err   error
+}
+
+// HostResult is the final result of the deployment to a host.
+type HostResult struct {
+	Host     string
+	State    HostState
+	Duration time.Duration
+	Err      error
+}
+
+type DeployReporter struct {
+	hosts []string
+}
+
+func NewDeployReporter(hosts []string) *DeployReporter {
+	return &DeployReporter{hosts}
+}
+
+// Run shows the state of every host until updates is closed and
+// prints the results of the deployment.
+func (r *DeployReporter) Run(ctx context.Context, updates <-chan HostUpdate) ([]HostResult, error) {
+	p := tea.NewProgram(
+		initDeployModel(r.hosts),
+		tea.WithoutSignalHandler(),
+		tea.WithOutput(os.Stderr),
+		tea.WithInput(nil),
+		tea.WithFPS(30),
+	)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		for {
+			select {
+			case <-ctx.Done():
+				p.Quit()
+				return
+			case u, ok := <-updates:
+				if !ok {
+					p.Quit()
+					return
+				}
+				p.Send(u)
+			}
+		}
+	}()
+
+	m, err := p.Run()
+	if err != nil {
+		return nil, err
+	}
+	<-done
+
+	// Updates sent after the program quit are lost,
+	// so the rest are applied here
+	dm := m.(deployModel)
+	for u := range updates {
+		dm.apply(u)
+	}
+
+	results := dm.results()
+	PrintDeployResults(os.Stderr, results)
+
+	return results, nil
+}
+
+// PrintDeployResults prints a table of the results of a deployment.
+func PrintDeployResults(w io.Writer, results []HostResult) {
+	width := 0
+	for _, res := range results {
+		width = max(width, len(res.Host))
+	}
+
+	hostStyle := lipgloss.NewStyle().Bold(true).Width(width + 2)
+	for _, res := range results {
+		status := fmtHostState(res.State)
+		if res.State.finished() {
+			status += " " + fmtDuration(res.Duration)
+		}
+		fmt.Fprintf(w, "%s%s\n", hostStyle.Render(res.Host), status)
+
+		if res.Err != nil {
+			for _, l := range strings.Split(strings.TrimSpace(res.Err.Error()), "\n") {
+				fmt.Fprintf(w, "%s%s\n", strings.Repeat(" ", width+4), l)
+			}
+		}
+	}
+}
+
+func fmtHostState(s HostState) string {
+	style := lipgloss.NewStyle()
+
+	switch s {
+	case HostCopying, HostActivating:
+		style = style.Foreground(lipgloss.Color("11"))
+	case HostDone:
+		return style.Foreground(lipgloss.Color("10")).Render("✓ done")
+	case HostFailed:
+		return style.Foreground(lipgloss.Color("9")).Render("✗ failed")
+	default:
+		style = style.Foreground(lipgloss.Color("12"))
+	}
+
+	return style.Render("⧗ " + s.String())
+}
+
+type hostStatus struct {
+	state HostState
+	err   error
+
+	start time.Time
+	end   time.Time
+}
+
+type deployModel struct {
+	spinner spinner.Model
+
+	w, h int
+
+	hosts  []string
+	status map[string]*hostStatus
+}
+
+func initDeployModel(hosts []string) deployModel {
+	s := spinner.New()
+	s.Spinner = spinner.Dot
+	s.Style = lipgloss.NewStyle().Foreground(lipgloss.Color("205"))
+
+	status := map[string]*hostStatus{}
+	for _, h := range hosts {
+		status[h] = &hostStatus{}
+	}
+
+	return deployModel{
+		spinner: s,
+		hosts:   hosts,
+		status:  status,
+	}
+}
+
+func (m deployModel) Init() tea.Cmd {
+	return m.spinner.Tick
+}
+
+func (m deployModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.w = msg.Width
+		m.h = msg.Height
+		return m, nil
+
+	case spinner.TickMsg:
+		var cmd tea.Cmd
+		m.spinner, cmd = m.spinner.Update(msg)
+		return m, cmd
+
+	case HostUpdate:
+		m.apply(msg)
+	}
+
+	return m, nil
+}
+
+func (m deployModel) apply(u HostUpdate) {
+	s, ok := m.status[u.Host]
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	if s.start.IsZero() {
+		s.start = now
+	}
+	if u.State.finished() {
+		s.end = now
+	}
+
+	s.state = u.State
+	s.err = u.Err
+}
+
+func (m deployModel) results() []HostResult {
+	results := []HostResult{}
+	for _, h := range m.hosts {
+		s := m.status[h]
+		results = append(results, HostResult{
+			Host:     h,
+			State:    s.state,
+			Duration: s.end.Sub(s.start),
+			Err:      s.err,
+		})
+	}
+	return results
+}
+
+func (m deployModel) View() string {
+	strb := &strings.Builder{}
+
+	width := 0
+	for _, h := range m.hosts {
+		width = max(width, len(h))
+	}
+
+	done := 0
+	hostStyle := lipgloss.NewStyle().Width(width + 2)
+	for _, h := range m.hosts {
+		s := m.status[h]
+		if s.state.finished() {
+			done++
+		}
+
+		prefix := "  "
+		elapsed := ""
+		switch {
+		case s.state == HostCopying || s.state == HostActivating:
+			prefix = m.spinner.View()
+			elapsed = " " + fmtDuration(time.Since(s.start))
+		case s.state.finished():
+			elapsed = " " + fmtDuration(s.end.Sub(s.start))
+		}
+
+		row := fmt.Sprintf("%s%s%s%s", prefix, hostStyle.Render(h), fmtHostState(s.state), elapsed)
+		if m.w > 0 {
+			row = lipgloss.NewStyle().MaxWidth(m.w).Render(row)
+		}
+		strb.WriteString(row + "\n")
+	}
+
+	strb.WriteString(
+		lipgloss.NewStyle().
+			Bold(true).
+			Render(fmt.Sprintf("Deployed %d/%d hosts", done, len(m.hosts))),
+	)
+	strb.WriteString("\n")
+
+	return strb.String()
+}
@@ -0,0 +1,62 @@
+package tui
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/arnarg/lila/internal/nix"
+	"github.com/arnarg/lila/internal/store"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// PrintVersionChanges prints a line for every package whose
+// versions changed.
+func PrintVersionChanges(w io.Writer, changes []nix.VersionChange) {
+	if len(changes) < 1 {
+		fmt.Fprintln(w, "  No version changes")
+		return
+	}
+
+	width := 0
+	for _, c := range changes {
+		width = max(width, len(c.Name))
+	}
+
+	name := lipgloss.NewStyle().Width(width + 2)
+	added := lipgloss.NewStyle().Foreground(lipgloss.Color("10"))
+	removed := lipgloss.NewStyle().Foreground(lipgloss.Color("9"))
+	changed := lipgloss.NewStyle().Foreground(lipgloss.Color("11"))
+
+	for _, c := range changes {
+		before := strings.Join(c.Before, ", ")
+		after := strings.Join(c.After, ", ")
+
+		switch {
+		case len(c.Before) < 1:
+			fmt.Fprintf(w, "  %s %s%s\n", added.Render("+"), name.Render(c.Name), after)
+		case len(c.After) < 1:
+			fmt.Fprintf(w, "  %s %s%s\n", removed.Render("-"), name.Render(c.Name), before)
+		default:
+			fmt.Fprintf(w, "  %s %s%s → %s\n", changed.Render("~"), name.Render(c.Name), before, after)
+		}
+	}
+}
+
+// PrintClosureDiff prints the package version changes between two
+// closures and how the closure size changed.
+func PrintClosureDiff(w io.Writer, diff *store.Diff) {
+	PrintVersionChanges(w, diff.Changes)
+
+	sign := "+"
+	delta := diff.SizeAfter - diff.SizeBefore
+	if diff.SizeAfter < diff.SizeBefore {
+		sign = "-"
+		delta = diff.SizeBefore - diff.SizeAfter
+	}
+
+	fmt.Fprintf(
+		w, "Closure size: %s → %s (%s%s)\n",
+		fmtBytes(diff.SizeBefore), fmtBytes(diff.SizeAfter), sign, fmtBytes(delta),
+	)
+}
@@ -0,0 +1,114 @@
+package tui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/arnarg/lila/internal/nix"
+	"github.com/charmbracelet/bubbles/spinner"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+type EvalReporter struct {
+	verbose bool
+}
+
+// NewEvalReporter creates a reporter for nix commands that only
+// evaluate, showing the time spent evaluating.
+func NewEvalReporter(verbose bool) *EvalReporter {
+	return &EvalReporter{verbose: verbose}
+}
+
+func (r *EvalReporter) Run(ctx context.Context, decoder *nix.ProgressDecoder) (nix.Summary, error) {
+	init := initEvalModel(r.verbose)
+
+	_, err := runTUIModel(ctx, init, decoder)
+	if err != nil {
+		printWarnings(os.Stderr, init.warnings.list)
+		return nil, err
+	}
+
+	return nil, reportWarnings(ctx, os.Stderr, init.warnings.list)
+}
+
+type evalModel struct {
+	spinner spinner.Model
+
+	w int
+
+	verbose bool
+
+	eval evaluation
+
+	warnings *warnings
+
+	err error
+}
+
+func initEvalModel(verbose bool) evalModel {
+	s := spinner.New()
+	s.Spinner = spinner.Dot
+	s.Style = lipgloss.NewStyle().Foreground(lipgloss.Color("205"))
+
+	return evalModel{
+		verbose:  verbose,
+		spinner:  s,
+		eval:     evaluation{start: time.Now()},
+		warnings: &warnings{},
+	}
+}
+
+func (m evalModel) error() error {
+	return m.err
+}
+
+func (m evalModel) Init() tea.Cmd {
+	return m.spinner.Tick
+}
+
+func (m evalModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.w = msg.Width
+		return m, nil
+
+	case spinner.TickMsg:
+		var cmd tea.Cmd
+		m.spinner, cmd = m.spinner.Update(msg)
+		return m, cmd
+
+	case nix.MessageEvent:
+		isWarning := m.warnings.collect(msg)
+
+		// error, but traces are logged with the same level
+		if msg.Level == 0 && !isWarning {
+			m.err = errors.New(msg.Text)
+			return m, tea.Quit
+		}
+
+		// Just display the message
+		if m.verbose {
+			return m, tea.Printf("%s", msg.Text)
+		}
+		m.eval.text = msg.Text
+	}
+
+	return m, nil
+}
+
+func (m evalModel) View() string {
+	if m.err != nil {
+		return ""
+	}
+
+	width := 0
+	if m.w > 0 {
+		width = m.w - lipgloss.Width(m.spinner.View())
+	}
+
+	return fmt.Sprintf("%s%s\n", m.spinner.View(), m.eval.render(width))
+}
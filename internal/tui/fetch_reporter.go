@@ -0,0 +1,176 @@
+package tui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/arnarg/lila/internal/nix"
+	"github.com/charmbracelet/bubbles/spinner"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+type FetchReporter struct {
+	verbose bool
+	title   string
+}
+
+// NewFetchReporter creates a reporter for fetching sources, showing
+// title until nix starts fetching.
+func NewFetchReporter(verbose bool, title string) *FetchReporter {
+	return &FetchReporter{verbose: verbose, title: title}
+}
+
+func (r *FetchReporter) Run(ctx context.Context, decoder *nix.ProgressDecoder) (nix.Summary, error) {
+	init := initFetchModel(r.verbose, r.title)
+
+	_, err := runTUIModel(ctx, init, decoder)
+	if err != nil {
+		printWarnings(os.Stderr, init.warnings.list)
+		return nil, err
+	}
+
+	return nil, reportWarnings(ctx, os.Stderr, init.warnings.list)
+}
+
+type fetchModel struct {
+	spinner spinner.Model
+
+	w, h int
+
+	verbose bool
+
+	// Sources being fetched in the order they started
+	fetches []int64
+	texts   map[int64]string
+
+	downloads map[int64]*copy
+
+	lastMsg string
+
+	warnings *warnings
+
+	err error
+}
+
+func initFetchModel(verbose bool, title string) fetchModel {
+	s := spinner.New()
+	s.Spinner = spinner.Dot
+	s.Style = lipgloss.NewStyle().Foreground(lipgloss.Color("205"))
+
+	return fetchModel{
+		verbose:   verbose,
+		spinner:   s,
+		texts:     map[int64]string{},
+		downloads: map[int64]*copy{},
+		lastMsg:   title,
+		warnings:  &warnings{},
+	}
+}
+
+func (m fetchModel) error() error {
+	return m.err
+}
+
+func (m fetchModel) Init() tea.Cmd {
+	return m.spinner.Tick
+}
+
+func (m fetchModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.w = msg.Width
+		m.h = msg.Height
+		return m, nil
+
+	case spinner.TickMsg:
+		var cmd tea.Cmd
+		m.spinner, cmd = m.spinner.Update(msg)
+		return m, cmd
+
+	case nix.Event:
+		return m.handleEvent(msg)
+	}
+
+	return m, nil
+}
+
+func (m fetchModel) handleEvent(ev nix.Event) (tea.Model, tea.Cmd) {
+	switch ev := ev.(type) {
+	case nix.StartFetchTreeEvent:
+		m.fetches = append(m.fetches, ev.ID)
+		m.texts[ev.ID] = ev.Text
+
+		if m.verbose {
+			return m, tea.Println(ev.Text)
+		}
+
+	case nix.StartFileTransferEvent:
+		m.downloads[ev.ID] = newCopy(ev.Path)
+
+	case nix.ResultProgressEvent:
+		if d, ok := m.downloads[ev.ID]; ok {
+			d.update(ev.Done, ev.Expected)
+		}
+
+	case nix.StopEvent:
+		delete(m.downloads, ev.ID)
+		if _, ok := m.texts[ev.ID]; ok {
+			delete(m.texts, ev.ID)
+			m.fetches = slices.DeleteFunc(m.fetches, func(id int64) bool {
+				return id == ev.ID
+			})
+		}
+
+	case nix.MessageEvent:
+		isWarning := m.warnings.collect(ev)
+
+		// error, but traces are logged with the same level
+		if ev.Level == 0 && !isWarning {
+			m.err = errors.New(ev.Text)
+			return m, tea.Quit
+		}
+
+		// Just display the message
+		if m.verbose {
+			return m, tea.Printf("%s", ev.Text)
+		} else {
+			m.lastMsg = ev.Text
+		}
+	}
+
+	return m, nil
+}
+
+func (m fetchModel) View() string {
+	if m.err != nil {
+		return ""
+	}
+
+	strb := &strings.Builder{}
+
+	// Show the latest source being fetched
+	text := m.lastMsg
+	if len(m.fetches) > 0 {
+		text = m.texts[m.fetches[len(m.fetches)-1]]
+	}
+
+	width := m.w - lipgloss.Width(m.spinner.View())
+	strb.WriteString(fmt.Sprintf("%s%s\n", m.spinner.View(), truncateLeft(text, width)))
+
+	ids := []int64{}
+	for id := range m.downloads {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	for _, id := range ids {
+		strb.WriteString(fmt.Sprintf("  ↓ %s\n", m.downloads[id].render(m.w-4)))
+	}
+
+	return strb.String()
+}
@@ -0,0 +1,184 @@
+package tui
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/arnarg/lila/internal/runner"
+	"github.com/arnarg/lila/internal/util"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// slowestBuilds is the number of builds listed in the printed summary.
+const slowestBuilds = 5
+
+// BuildTiming is the time it took to build a single derivation.
+type BuildTiming struct {
+	Name     string  `json:"name"`
+	Duration float64 `json:"durationSeconds"`
+
+	drv string
+}
+
+// Statuses of a build in the summary.
+const (
+	BuildSucceeded = "succeeded"
+	BuildFailed    = "failed"
+)
+
+// BuildSummary describes what happened during a nix build.
+type BuildSummary struct {
+	Status          string        `json:"status"`
+	ExitCode        int           `json:"exitCode"`
+	Built           int           `json:"built"`
+	Failed          int           `json:"failed"`
+	Substituted     int           `json:"substituted"`
+	DownloadedBytes int64         `json:"downloadedBytes"`
+	CacheHitRatio   float64       `json:"cacheHitRatio"`
+	Evaluation      float64       `json:"evaluationSeconds"`
+	Duration        float64       `json:"durationSeconds"`
+	Builds          []BuildTiming `json:"builds"`
+}
+
+// buildStats collects statistics about finished builds and
+// downloads while the build reporter is running.
+type buildStats struct {
+	builds      []BuildTiming
+	substituted int
+	downloaded  int64
+
+	// Time from starting nix until it started building or
+	// substituting
+	evaluation time.Duration
+}
+
+func (s *buildStats) addBuild(b *build) {
+	s.builds = append(s.builds, BuildTiming{
+		Name:     b.name,
+		Duration: time.Since(b.start).Seconds(),
+		drv:      b.drv,
+	})
+}
+
+func (s *buildStats) addDownload(c *copy) {
+	s.substituted++
+	s.downloaded += c.done
+}
+
+// summary summarises the builds, where only the builds that did not
+// fail count as built.
+func (s *buildStats) summary(start time.Time, failed []string) BuildSummary {
+	builds := []BuildTiming{}
+	for _, b := range s.builds {
+		if !slices.Contains(failed, b.drv) {
+			builds = append(builds, b)
+		}
+	}
+	slices.SortFunc(builds, func(a, b BuildTiming) int {
+		return cmp.Compare(b.Duration, a.Duration)
+	})
+
+	ratio := 0.0
+	if total := len(builds) + s.substituted; total > 0 {
+		ratio = float64(s.substituted) / float64(total)
+	}
+
+	// Nothing was built or substituted so nix only evaluated
+	evaluation := s.evaluation
+	if evaluation == 0 {
+		evaluation = time.Since(start)
+	}
+
+	return BuildSummary{
+		Built:           len(builds),
+		Failed:          len(failed),
+		Substituted:     s.substituted,
+		DownloadedBytes: s.downloaded,
+		CacheHitRatio:   ratio,
+		Evaluation:      evaluation.Seconds(),
+		Duration:        time.Since(start).Seconds(),
+		Builds:          builds,
+	}
+}
+
+// Print writes a human readable summary to w. Nothing is written
+// if nothing was built or substituted.
+func (s BuildSummary) Print(w io.Writer) {
+	if s.Built+s.Failed+s.Substituted < 1 {
+		return
+	}
+
+	downloaded, unit := util.ConvertBytes(s.DownloadedBytes)
+	duration := time.Duration(s.Duration * float64(time.Second))
+	evaluation := time.Duration(s.Evaluation * float64(time.Second))
+
+	if s.Status == BuildFailed {
+		fmt.Fprint(w, lipgloss.NewStyle().Foreground(lipgloss.Color("9")).Render("Build failed: "))
+	}
+
+	failed := ""
+	if s.Failed > 0 {
+		failed = fmt.Sprintf(", %d failed", s.Failed)
+	}
+
+	fmt.Fprintf(
+		w,
+		"Built %d%s, substituted %d (%.0f%% cache hits), downloaded %.2f %s in %s (%s evaluating)\n",
+		s.Built, failed, s.Substituted, s.CacheHitRatio*100, downloaded, unit, fmtDuration(duration), fmtDuration(evaluation),
+	)
+
+	if len(s.Builds) < 1 {
+		return
+	}
+
+	fmt.Fprintln(w, lipgloss.NewStyle().Bold(true).Render("Slowest builds:"))
+	for _, b := range s.Builds[:min(len(s.Builds), slowestBuilds)] {
+		fmt.Fprintf(
+			w, "  %s %s\n",
+			lipgloss.NewStyle().Foreground(lipgloss.Color("12")).Render(
+				fmt.Sprintf("%7s", fmtDuration(time.Duration(b.Duration*float64(time.Second)))),
+			),
+			b.Name,
+		)
+	}
+}
+
+// buildReport is the summary of a build, reported once the exit
+// status of nix is known.
+type buildReport struct {
+	summary BuildSummary
+	file    string
+}
+
+func (r *buildReport) Report(exitErr error) error {
+	r.summary.Status = BuildSucceeded
+	if exitErr != nil {
+		r.summary.Status = BuildFailed
+		r.summary.ExitCode = 1
+		if code, ok := runner.ExitCode(exitErr); ok {
+			r.summary.ExitCode = code
+		}
+	}
+
+	r.summary.Print(os.Stderr)
+
+	if r.file != "" {
+		return r.summary.WriteFile(r.file)
+	}
+	return nil
+}
+
+// WriteFile writes the summary as JSON to the file at path.
+func (s BuildSummary) WriteFile(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
@@ -4,11 +4,14 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/arnarg/lila/internal/nix"
 	"github.com/arnarg/lila/internal/util"
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
 )
 
 type tuiModel interface {
@@ -16,7 +19,7 @@ type tuiModel interface {
 	error() error
 }
 
-func runTUIModel(ctx context.Context, init tuiModel, decoder *nix.ProgressDecoder) error {
+func runTUIModel(ctx context.Context, init tuiModel, decoder *nix.ProgressDecoder) (tuiModel, error) {
 	var wg sync.WaitGroup
 
 	p := tea.NewProgram(
@@ -57,13 +60,14 @@ func runTUIModel(ctx context.Context, init tuiModel, decoder *nix.ProgressDecode
 	// Run bubbletea program
 	m, err := p.Run()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Wait for waitgroup
 	wg.Wait()
 
-	return m.(tuiModel).error()
+	tm := m.(tuiModel)
+	return tm, tm.error()
 }
 
 type progress struct {
@@ -106,14 +110,196 @@ type copy struct {
 	name  string
 	done  int64
 	total int64
+
+	start time.Time
+
+	// Used to compute throughput from the progress deltas
+	updated time.Time
+	rate    float64
+}
+
+func newCopy(name string) *copy {
+	now := time.Now()
+	return &copy{
+		name:    name,
+		start:   now,
+		updated: now,
+	}
+}
+
+// rateSmoothing is the weight given to the latest throughput
+// sample when updating the moving average.
+const rateSmoothing = 0.3
+
+// update records new progress for the copy and updates the
+// throughput estimate.
+func (c *copy) update(done, total int64) {
+	now := time.Now()
+
+	if dt := now.Sub(c.updated).Seconds(); dt > 0 && done >= c.done {
+		rate := float64(done-c.done) / dt
+		if c.rate == 0 {
+			c.rate = rate
+		} else {
+			c.rate = rateSmoothing*rate + (1-rateSmoothing)*c.rate
+		}
+	}
+
+	c.done = done
+	c.total = total
+	c.updated = now
+}
+
+// eta returns the estimated time remaining based on the
+// current throughput.
+func (c *copy) eta() (time.Duration, bool) {
+	if c.rate <= 0 || c.total <= c.done {
+		return 0, false
+	}
+	return time.Duration(float64(c.total-c.done) / c.rate * float64(time.Second)), true
 }
 
 func (c *copy) String() string {
-	if c.total > 0 {
-		total, unit := util.ConvertBytes(c.total)
-		done := util.ConvertBytesToUnit(c.done, unit)
+	return c.render(0)
+}
+
+func (c *copy) render(width int) string {
+	elapsed := fmt.Sprintf(" %s", fmtDuration(time.Since(c.start)))
+	if c.total <= 0 {
+		return fitLine(c.name, width, elapsed)
+	}
+
+	total, unit := util.ConvertBytes(c.total)
+	done := util.ConvertBytesToUnit(c.done, unit)
+	progress := fmt.Sprintf(" [%.2f/%.2f %s]", done, total, unit)
+
+	details := ""
+	if c.rate > 0 {
+		rate, unit := util.ConvertBytes(int64(c.rate))
+		details += fmt.Sprintf(" %.2f %s/s", rate, unit)
+	}
+	if eta, ok := c.eta(); ok {
+		details += fmt.Sprintf(" ETA %s", fmtDuration(eta))
+	}
+
+	return fitLine(
+		c.name, width,
+		progress+details+elapsed,
+		progress+elapsed,
+		elapsed,
+	)
+}
+
+// minNameWidth is the least width a name is given before the
+// details after it are shortened.
+const minNameWidth = 12
+
+// fitLine renders a name followed by the first of the suffixes,
+// ordered from most to least detailed, that leaves room for the
+// name within width. The line never grows wider than width.
+func fitLine(name string, width int, suffixes ...string) string {
+	if width <= 0 {
+		return name + suffixes[0]
+	}
+
+	suffix := suffixes[len(suffixes)-1]
+	for _, s := range suffixes {
+		if width-len(s) >= minNameWidth {
+			suffix = s
+			break
+		}
+	}
 
-		return fmt.Sprintf("%s [%.2f/%.2f %s]", c.name, done, total, unit)
+	line := truncateName(name, max(width-len(suffix), 1)) + suffix
+	if len(line) > width {
+		line = line[:width]
+	}
+	return line
+}
+
+// fmtDuration formats a duration for display next to running items.
+func fmtDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+
+	h := d / time.Hour
+	m := (d % time.Hour) / time.Minute
+	s := (d % time.Minute) / time.Second
+
+	if h > 0 {
+		return fmt.Sprintf("%dh%02dm", h, m)
+	} else if m > 0 {
+		return fmt.Sprintf("%dm%02ds", m, s)
+	}
+	return fmt.Sprintf("%ds", s)
+}
+
+// line is a single line of status output that can be
+// rendered to fit within a given terminal width.
+type line interface {
+	render(width int) string
+}
+
+// message is a plain text line, usually a log message from nix.
+type message string
+
+func (m message) render(width int) string {
+	text, _, _ := strings.Cut(string(m), "\n")
+	if width <= 0 {
+		return text
+	}
+	return lipgloss.NewStyle().MaxWidth(width).Render(text)
+}
+
+// evaluation is the status line shown while nix evaluates, with
+// the latest message from nix and the time spent evaluating.
+type evaluation struct {
+	start time.Time
+	text  string
+}
+
+func (e evaluation) render(width int) string {
+	text := e.text
+	if text == "" {
+		text = "Evaluating..."
+	}
+	suffix := fmt.Sprintf(" %s", fmtDuration(time.Since(e.start)))
+
+	if width <= 0 {
+		return message(text).render(0) + suffix
+	}
+	return message(text).render(max(width-len(suffix), 1)) + suffix
+}
+
+const ellipsis = "..."
+
+// truncateName shortens a store path name to fit within width,
+// preferring to cut the package name so that the version stays
+// visible.
+func truncateName(name string, width int) string {
+	if width <= 0 || len(name) <= width {
+		return name
+	}
+
+	pname, version := nix.ParseDrvName(name)
+	if version != "" {
+		version = "-" + version
+	}
+	keep := width - len(version) - len(ellipsis)
+	if keep < 1 {
+		return truncateLeft(name, width)
+	}
+
+	return pname[:keep] + ellipsis + version
+}
+
+// truncateLeft shortens a string to fit within width by cutting
+// from the start.
+func truncateLeft(s string, width int) string {
+	if width <= 0 || len(s) <= width {
+		return s
+	}
+	if width <= len(ellipsis) {
+		return s[len(s)-width:]
 	}
-	return c.name
+	return ellipsis + s[len(s)-width+len(ellipsis):]
 }
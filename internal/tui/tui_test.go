@@ -0,0 +1,98 @@
+package tui
+
+import "testing"
+
+func TestTruncateName(t *testing.T) {
+	tests := []struct {
+		name    string
+		inName  string
+		inWidth int
+		outName string
+	}{
+		{
+			name:    "unchanged when it fits",
+			inName:  "hello-2.12.1",
+			inWidth: 20,
+			outName: "hello-2.12.1",
+		},
+		{
+			name:    "unchanged with unknown width",
+			inName:  "hello-2.12.1",
+			inWidth: 0,
+			outName: "hello-2.12.1",
+		},
+		{
+			name:    "keeps version",
+			inName:  "python3.12-some-long-package-name-1.2.3",
+			inWidth: 20,
+			outName: "python3.12-...-1.2.3",
+		},
+		{
+			name:    "without version",
+			inName:  "some-very-long-package-name",
+			inWidth: 12,
+			outName: "some-very...",
+		},
+		{
+			name:    "falls back to cutting the start",
+			inName:  "foo-1.2.3-with-a-very-long-version",
+			inWidth: 10,
+			outName: "...version",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := truncateName(tt.inName, tt.inWidth)
+
+			if out != tt.outName {
+				t.Errorf("truncated name is '%s' but '%s' was expected", out, tt.outName)
+			}
+		})
+	}
+}
+
+func TestFitLine(t *testing.T) {
+	tests := []struct {
+		name     string
+		inName   string
+		inWidth  int
+		suffixes []string
+		outLine  string
+	}{
+		{
+			name:     "full suffix when it fits",
+			inName:   "hello-2.12.1",
+			inWidth:  50,
+			suffixes: []string{" [1.00/2.00 MiB] 1.00 MiB/s 3s", " 3s"},
+			outLine:  "hello-2.12.1 [1.00/2.00 MiB] 1.00 MiB/s 3s",
+		},
+		{
+			name:     "shorter suffix on narrow terminals",
+			inName:   "hello-2.12.1",
+			inWidth:  20,
+			suffixes: []string{" [1.00/2.00 MiB] 1.00 MiB/s 3s", " 3s"},
+			outLine:  "hello-2.12.1 3s",
+		},
+		{
+			name:     "never wider than the terminal",
+			inName:   "python3.12-some-long-package-name-1.2.3",
+			inWidth:  8,
+			suffixes: []string{" [configurePhase] 1m02s", " 1m02s"},
+			outLine:  ".3 1m02s",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := fitLine(tt.inName, tt.inWidth, tt.suffixes...)
+
+			if out != tt.outLine {
+				t.Errorf("line is '%s' but '%s' was expected", out, tt.outLine)
+			}
+			if len(out) > tt.inWidth {
+				t.Errorf("line is %d wide but the width is %d", len(out), tt.inWidth)
+			}
+		})
+	}
+}
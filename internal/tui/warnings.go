@@ -0,0 +1,182 @@
+package tui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/arnarg/lila/internal/nix"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// ErrWarnings is returned by reporters when warnings are treated
+// as errors and nix emitted any.
+var ErrWarnings = errors.New("nix emitted warnings")
+
+type warningsAsErrorsKey struct{}
+
+// WithWarningsAsErrors returns a copy of ctx that makes reporters
+// run with it fail with ErrWarnings if nix emitted any warnings or
+// traces. Evaluations run without a reporter, such as looking up
+// the names of systems, discard what nix prints on stderr and are
+// not covered, but their warnings are reported again when the
+// configurations are built.
+func WithWarningsAsErrors(ctx context.Context, asErrors bool) context.Context {
+	return context.WithValue(ctx, warningsAsErrorsKey{}, asErrors)
+}
+
+// WarningsAsErrors returns true if warnings are treated as errors
+// in ctx.
+func WarningsAsErrors(ctx context.Context) bool {
+	asErrors, _ := ctx.Value(warningsAsErrorsKey{}).(bool)
+	return asErrors
+}
+
+// WarningKind is the kind of a collected message.
+type WarningKind int
+
+const (
+	KindWarning WarningKind = iota
+	KindDeprecation
+	KindTrace
+)
+
+func (k WarningKind) String() string {
+	switch k {
+	case KindDeprecation:
+		return "deprecation"
+	case KindTrace:
+		return "trace"
+	}
+	return "warning"
+}
+
+// Warning is a warning or trace emitted by nix, with the number
+// of times it was emitted.
+type Warning struct {
+	Kind  WarningKind
+	Text  string
+	Count int
+}
+
+var ansiEscape = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// deprecationWords are looked for in warnings to tell if they
+// are about deprecations.
+var deprecationWords = []string{"deprecated", "obsolete", "renamed", "has been removed"}
+
+// classifyMessage returns the kind and text of a message from nix
+// if it is a warning or a trace. Traces are logged with the level
+// of errors so they must be told apart before handling errors.
+func classifyMessage(ev nix.MessageEvent) (WarningKind, string, bool) {
+	text := strings.TrimSpace(ansiEscape.ReplaceAllString(ev.Text, ""))
+
+	kind := KindWarning
+	if rest, ok := strings.CutPrefix(text, "trace: "); ok {
+		// lib.warn traces its warnings in older nixpkgs
+		text = strings.TrimSpace(rest)
+		if !strings.HasPrefix(text, "warning: ") && !strings.HasPrefix(text, "evaluation warning: ") {
+			return KindTrace, text, true
+		}
+	} else if ev.Level != 1 {
+		return 0, "", false
+	}
+
+	if rest, ok := strings.CutPrefix(text, "evaluation warning: "); ok {
+		text = rest
+	} else if rest, ok := strings.CutPrefix(text, "warning: "); ok {
+		text = rest
+	} else {
+		return 0, "", false
+	}
+
+	lower := strings.ToLower(text)
+	for _, w := range deprecationWords {
+		if strings.Contains(lower, w) {
+			kind = KindDeprecation
+			break
+		}
+	}
+
+	return kind, text, true
+}
+
+// warnings collects warnings and traces, deduplicated, in the
+// order they were first emitted.
+type warnings struct {
+	list []Warning
+}
+
+func (w *warnings) add(kind WarningKind, text string) {
+	for i := range w.list {
+		if w.list[i].Kind == kind && w.list[i].Text == text {
+			w.list[i].Count++
+			return
+		}
+	}
+	w.list = append(w.list, Warning{kind, text, 1})
+}
+
+// collect adds the message to the collected warnings if it is a
+// warning or a trace and reports whether it was.
+func (w *warnings) collect(ev nix.MessageEvent) bool {
+	kind, text, ok := classifyMessage(ev)
+	if ok {
+		w.add(kind, text)
+	}
+	return ok
+}
+
+// printWarnings writes a summary of the warnings to out, grouped
+// by kind. Nothing is written if there are no warnings.
+func printWarnings(out io.Writer, ws []Warning) {
+	if len(ws) < 1 {
+		return
+	}
+
+	styles := map[WarningKind]lipgloss.Style{
+		KindWarning:     lipgloss.NewStyle().Foreground(lipgloss.Color("11")),
+		KindDeprecation: lipgloss.NewStyle().Foreground(lipgloss.Color("13")),
+		KindTrace:       lipgloss.NewStyle().Foreground(lipgloss.Color("12")),
+	}
+	headers := map[WarningKind]string{
+		KindWarning:     "Warnings:",
+		KindDeprecation: "Deprecations:",
+		KindTrace:       "Traces:",
+	}
+	faint := lipgloss.NewStyle().Faint(true)
+
+	for _, kind := range []WarningKind{KindWarning, KindDeprecation, KindTrace} {
+		header := false
+		for _, w := range ws {
+			if w.Kind != kind {
+				continue
+			}
+			if !header {
+				fmt.Fprintln(out, lipgloss.NewStyle().Bold(true).Render(headers[kind]))
+				header = true
+			}
+
+			text, _, _ := strings.Cut(w.Text, "\n")
+			fmt.Fprintf(out, "  %s %s", styles[kind].Render("•"), text)
+			if w.Count > 1 {
+				fmt.Fprint(out, faint.Render(fmt.Sprintf(" (%d×)", w.Count)))
+			}
+			fmt.Fprintln(out)
+		}
+	}
+}
+
+// reportWarnings prints the warnings and returns ErrWarnings if
+// there are any and they are treated as errors.
+func reportWarnings(ctx context.Context, out io.Writer, ws []Warning) error {
+	printWarnings(out, ws)
+
+	if WarningsAsErrors(ctx) && len(ws) > 0 {
+		return fmt.Errorf("%w (%d)", ErrWarnings, len(ws))
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package tui
+
+import (
+	"testing"
+
+	"github.com/arnarg/lila/internal/nix"
+)
+
+func TestClassifyMessage(t *testing.T) {
+	tests := []struct {
+		name         string
+		event        nix.MessageEvent
+		expectedKind WarningKind
+		expectedText string
+		expectedOk   bool
+	}{
+		{
+			name:         "evaluation warning",
+			event:        nix.MessageEvent{Level: 1, Text: "\x1b[35;1mevaluation warning:\x1b[0m The option `services.foo.bar' is unused"},
+			expectedKind: KindWarning,
+			expectedText: "The option `services.foo.bar' is unused",
+			expectedOk:   true,
+		},
+		{
+			name:         "deprecation",
+			event:        nix.MessageEvent{Level: 1, Text: "evaluation warning: The option `hardware.opengl.enable' has been renamed to `hardware.graphics.enable'."},
+			expectedKind: KindDeprecation,
+			expectedText: "The option `hardware.opengl.enable' has been renamed to `hardware.graphics.enable'.",
+			expectedOk:   true,
+		},
+		{
+			name:         "trace",
+			event:        nix.MessageEvent{Level: 0, Text: "trace: hello"},
+			expectedKind: KindTrace,
+			expectedText: "hello",
+			expectedOk:   true,
+		},
+		{
+			name:         "warning traced by lib.warn",
+			event:        nix.MessageEvent{Level: 0, Text: "trace: \x1b[1;31mwarning: foo is deprecated\x1b[0m"},
+			expectedKind: KindDeprecation,
+			expectedText: "foo is deprecated",
+			expectedOk:   true,
+		},
+		{
+			name:       "error",
+			event:      nix.MessageEvent{Level: 0, Text: "error: attribute 'foo' missing"},
+			expectedOk: false,
+		},
+		{
+			name:       "info",
+			event:      nix.MessageEvent{Level: 3, Text: "warning: not a real warning at this level"},
+			expectedOk: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			kind, text, ok := classifyMessage(test.event)
+			if ok != test.expectedOk {
+				t.Fatalf("ok is '%t' but '%t' was expected", ok, test.expectedOk)
+			}
+			if !ok {
+				return
+			}
+			if kind != test.expectedKind {
+				t.Errorf("kind is '%s' but '%s' was expected", kind, test.expectedKind)
+			}
+			if text != test.expectedText {
+				t.Errorf("text is '%s' but '%s' was expected", text, test.expectedText)
+			}
+		})
+	}
+}
+
+func TestBuildModelCollectsWarnings(t *testing.T) {
+	m := initBuildModel(false)
+
+	for _, ev := range []nix.Event{
+		nix.MessageEvent{Level: 0, Text: "trace: hello"},
+		nix.MessageEvent{Level: 1, Text: "evaluation warning: foo"},
+		nix.MessageEvent{Level: 0, Text: "trace: hello"},
+	} {
+		res, _ := m.Update(ev)
+		m = res.(buildModel)
+	}
+
+	if m.err != nil {
+		t.Fatalf("unexpected error: %s", m.err)
+	}
+
+	expected := []Warning{
+		{KindTrace, "hello", 2},
+		{KindWarning, "foo", 1},
+	}
+	if len(m.warnings.list) != len(expected) {
+		t.Fatalf("got %d warnings but %d were expected", len(m.warnings.list), len(expected))
+	}
+	for i, w := range m.warnings.list {
+		if w != expected[i] {
+			t.Errorf("warning %d is '%v' but '%v' was expected", i, w, expected[i])
+		}
+	}
+
+	// Errors still stop the build
+	res, _ := m.Update(nix.MessageEvent{Level: 0, Text: "error: build failed"})
+	if res.(buildModel).err == nil {
+		t.Error("expected an error but got none")
+	}
+}
@@ -0,0 +1,59 @@
+package util
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	Day  = 24 * time.Hour
+	Week = 7 * Day
+)
+
+// ParseDuration parses a duration like time.ParseDuration, but
+// also accepts days and weeks with the "d" and "w" units, e.g.
+// "30d" or "1w12h".
+func ParseDuration(s string) (time.Duration, error) {
+	var d time.Duration
+	rest := s
+
+	for rest != "" {
+		i := strings.IndexFunc(rest, func(r rune) bool {
+			return r < '0' || r > '9'
+		})
+		if i < 1 {
+			break
+		}
+
+		var unit time.Duration
+		switch rest[i] {
+		case 'd':
+			unit = Day
+		case 'w':
+			unit = Week
+		}
+		if unit == 0 {
+			break
+		}
+
+		n, err := strconv.Atoi(rest[:i])
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+
+		d += time.Duration(n) * unit
+		rest = rest[i+1:]
+	}
+
+	if rest != "" {
+		rd, err := time.ParseDuration(rest)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		d += rd
+	}
+
+	return d, nil
+}
@@ -0,0 +1,66 @@
+package util
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		name  string
+		in    string
+		out   time.Duration
+		fails bool
+	}{
+		{
+			name: "days correct",
+			in:   "30d",
+			out:  30 * 24 * time.Hour,
+		},
+		{
+			name: "weeks correct",
+			in:   "2w",
+			out:  14 * 24 * time.Hour,
+		},
+		{
+			name: "combined correct",
+			in:   "1w2d12h",
+			out:  9*24*time.Hour + 12*time.Hour,
+		},
+		{
+			name: "standard units correct",
+			in:   "90m",
+			out:  90 * time.Minute,
+		},
+		{
+			name:  "unknown unit fails",
+			in:    "3y",
+			fails: true,
+		},
+		{
+			name:  "empty fails",
+			in:    "d",
+			fails: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := ParseDuration(tt.in)
+
+			if tt.fails {
+				if err == nil {
+					t.Errorf("parsing '%s' was expected to fail", tt.in)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parsing '%s' failed: %s", tt.in, err)
+			}
+
+			if out != tt.out {
+				t.Errorf("parsed duration is '%s' but '%s' was expected", out, tt.out)
+			}
+		})
+	}
+}
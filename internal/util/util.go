@@ -1,5 +1,11 @@
 package util
 
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
 const (
 	_ = 1 << (10 * iota)
 	KiB
@@ -43,3 +49,43 @@ func ConvertBytesToUnit(b int64, unit string) float64 {
 		return float64(b)
 	}
 }
+
+// byteUnits maps the units accepted by ParseBytes to their size,
+// with the decimal units of SI as well as the binary ones.
+var byteUnits = map[string]float64{
+	"":             1,
+	BytesUnitBytes: 1,
+	BytesUnitKiB:   KiB,
+	BytesUnitMiB:   MiB,
+	BytesUnitGiB:   GiB,
+	BytesUnitTiB:   TiB,
+	"KB":           1e3,
+	"MB":           1e6,
+	"GB":           1e9,
+	"TB":           1e12,
+}
+
+// ParseBytes parses a size with an optional unit, e.g. "2GiB",
+// "1.5 GB" or "512".
+func ParseBytes(s string) (int64, error) {
+	str := strings.TrimSpace(s)
+
+	i := strings.IndexFunc(str, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if i < 0 {
+		i = len(str)
+	}
+
+	n, err := strconv.ParseFloat(str[:i], 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+
+	unit, ok := byteUnits[strings.TrimSpace(str[i:])]
+	if !ok {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+
+	return int64(n * unit), nil
+}
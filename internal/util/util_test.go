@@ -105,3 +105,42 @@ func TestConvertBytesToUnit(t *testing.T) {
 		})
 	}
 }
+
+func TestParseBytes(t *testing.T) {
+	tests := []struct {
+		in          string
+		out         int64
+		expectError bool
+	}{
+		{in: "512", out: 512},
+		{in: "512B", out: 512},
+		{in: "2GiB", out: 2 * GiB},
+		{in: "1.5 MiB", out: 1536 * KiB},
+		{in: "10KiB", out: 10 * KiB},
+		{in: "2GB", out: 2000000000},
+		{in: "1TiB", out: TiB},
+		{in: "GiB", expectError: true},
+		{in: "2 GiBs", expectError: true},
+		{in: "-1GiB", expectError: true},
+		{in: "", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			out, err := ParseBytes(tt.in)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("expected an error but got '%d'", out)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if out != tt.out {
+				t.Errorf("parsed size is '%d' but '%d' was expected", out, tt.out)
+			}
+		})
+	}
+}
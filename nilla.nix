@@ -36,14 +36,12 @@ in
           mkShellNoCC,
           npins,
           gomod2nix,
-          nvd,
           ...
         }:
           mkShellNoCC {
             packages = [
               npins
               gomod2nix
-              nvd
             ];
           };
       };